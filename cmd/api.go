@@ -0,0 +1,348 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"strconv"
+
+	_ "embed"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+//go:embed assets/openapi.json
+var openAPISpec []byte
+
+// apiPrefix is the path prefix of the current version of the JSON API
+const apiPrefix = "/api/v1"
+
+// requestError is a malformed API request
+type requestError struct {
+	status int
+	kind   string
+	err    error
+}
+
+func (e *requestError) Error() string {
+	return e.err.Error()
+}
+
+// errorKind returns the machine-readable kind of err, as listed in the
+// Error schema of openapi.json
+func errorKind(err error) string {
+	var re *requestError
+	switch {
+	case errors.As(err, &re):
+		return re.kind
+	case errors.Is(err, utils.ErrNotPDF):
+		return "not_pdf"
+	case errors.Is(err, utils.ErrNotImage):
+		return "not_image"
+	case errors.Is(err, utils.ErrEncrypted):
+		return "encrypted"
+	case errors.Is(err, utils.ErrCorrupt):
+		return "corrupt"
+	case errors.Is(err, utils.ErrPageOutOfRange):
+		return "page_out_of_range"
+	case errors.Is(err, utils.ErrInvalidOption):
+		return "invalid_option"
+	case errors.Is(err, utils.ErrRangeOverlap):
+		return "range_overlap"
+	case errors.Is(err, utils.ErrUnknownMatter):
+		return "unknown_matter"
+	case errors.Is(err, utils.ErrUnknownJob):
+		return "unknown_job"
+	}
+	return "internal"
+}
+
+// apiError replies to the request with err as a JSON error
+func apiError(w http.ResponseWriter, err error) {
+	status := errorStatus(err)
+	var re *requestError
+	if errors.As(err, &re) {
+		status = re.status
+	}
+	log.Printf("Error: %s", err)
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"error": map[string]interface{}{
+			"status":  status,
+			"kind":    errorKind(err),
+			"message": err.Error(),
+		},
+	})
+}
+
+// apiRequest is the document and options of an API request
+type apiRequest struct {
+	doc      io.ReadSeeker
+	filename string
+	options  []byte
+}
+
+// readAPIRequest reads the document and options of r, either a
+// multipart form with the document in `file` and the options in
+// `options`, or a raw application/pdf body with the options in the
+// `options` query parameter
+func readAPIRequest(w http.ResponseWriter, r *http.Request) (*apiRequest, error) {
+	if r.Method != http.MethodPost {
+		return nil, &requestError{http.StatusMethodNotAllowed, "method_not_allowed", fmt.Errorf("method %s not allowed", r.Method)}
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, MAX_UPLOAD_SIZE)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(MAX_UPLOAD_SIZE); err != nil {
+			return nil, &requestError{http.StatusRequestEntityTooLarge, "too_large", err}
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			return nil, &requestError{http.StatusBadRequest, "missing_file", err}
+		}
+		return &apiRequest{file, header.Filename, []byte(r.FormValue("options"))}, nil
+	case "application/pdf":
+		b, err := io.ReadAll(r.Body)
+		if err != nil {
+			return nil, &requestError{http.StatusRequestEntityTooLarge, "too_large", err}
+		}
+		return &apiRequest{bytes.NewReader(b), r.URL.Query().Get("filename"), []byte(r.URL.Query().Get("options"))}, nil
+	}
+	return nil, &requestError{
+		http.StatusUnsupportedMediaType,
+		"unsupported_media_type",
+		fmt.Errorf("unsupported content type `%s` (expected multipart/form-data or application/pdf)", mediaType),
+	}
+}
+
+// decode unmarshals the options of req into v, leaving the fields they
+// do not mention as they are
+func (req *apiRequest) decode(v interface{}) error {
+	if len(bytes.TrimSpace(req.options)) == 0 {
+		return nil
+	}
+	d := json.NewDecoder(bytes.NewReader(req.options))
+	d.DisallowUnknownFields()
+	if err := d.Decode(v); err != nil {
+		return &utils.Error{Op: "decode options", Kind: utils.ErrInvalidOption, Err: err}
+	}
+	return nil
+}
+
+// writePDF replies with the PDF in out
+func writePDF(w http.ResponseWriter, out *bytes.Buffer, pageCount int) {
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("X-Page-Count", strconv.Itoa(pageCount))
+	out.WriteTo(w)
+}
+
+// apiBatesRequest are the options of /api/v1/bates
+type apiBatesRequest struct {
+	Prefix      string           `json:"prefix"`
+	Separator   string           `json:"separator"`
+	Width       int              `json:"width"`
+	Start       int64            `json:"start"`
+	Matter      string           `json:"matter"`
+	Designation string           `json:"designation"`
+	Style       utils.BatesStyle `json:"style"`
+	Scrub       bool             `json:"scrub"`
+}
+
+func apiBatesHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := readAPIRequest(w, r)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	opts := apiBatesRequest{Prefix: "Bates", Separator: "-", Width: 8, Start: 1, Style: batesStyle()}
+	if err := req.decode(&opts); err != nil {
+		apiError(w, err)
+		return
+	}
+	pageCount, err := utils.PageCount(req.doc)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+
+	fmtString := utils.GenerateFmtString(opts.Prefix, opts.Separator, opts.Width)
+	startno := opts.Start
+	served := false
+	if opts.Matter != "" {
+		defaults := utils.Matter{Prefix: opts.Prefix, Separator: opts.Separator, Width: opts.Width}
+		m, issued, err := matterRegistry().Reserve(opts.Matter, 0, int64(pageCount), defaults, requestUser(r), req.filename)
+		if err != nil {
+			apiError(w, err)
+			return
+		}
+		defer func() {
+			if !served {
+				releaseBates(m.Name, issued)
+			}
+		}()
+		startno = issued.Start
+		fmtString = m.FmtString()
+	}
+
+	var out bytes.Buffer
+	endorse := utils.BatesEndorseRS
+	if opts.Scrub {
+		endorse = utils.ScrubBatesEndorseRS
+	}
+	if err := endorse(req.doc, &out, fmtString, startno, opts.Designation, opts.Style); err != nil {
+		apiError(w, err)
+		return
+	}
+	begBates := fmt.Sprintf(fmtString, startno)
+	endBates := fmt.Sprintf(fmtString, startno+int64(pageCount)-1)
+	if err := auditDocument(r, "bates", req.filename, req.doc, pageCount, begBates, endBates); err != nil {
+		apiError(w, err)
+		return
+	}
+	served = true
+	w.Header().Set("X-Bates-Start", begBates)
+	w.Header().Set("X-Bates-Stop", endBates)
+	writePDF(w, &out, pageCount)
+}
+
+// apiStampRequest are the options of /api/v1/stamp
+type apiStampRequest struct {
+	Preset string `json:"preset"`
+	utils.WatermarkOptions
+}
+
+func apiStampHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := readAPIRequest(w, r)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	// the preset gives the defaults of the other options
+	var opts apiStampRequest
+	if err := req.decode(&opts); err != nil {
+		apiError(w, err)
+		return
+	}
+	if opts.Preset != "" {
+		preset, _, err := stampPreset(opts.Preset)
+		if err != nil {
+			apiError(w, &requestError{http.StatusBadRequest, "invalid_option", err})
+			return
+		}
+		opts.WatermarkOptions = preset
+	} else {
+		opts.WatermarkOptions = utils.DefaultWatermarkOptions("")
+	}
+	if err := req.decode(&opts); err != nil {
+		apiError(w, err)
+		return
+	}
+	if opts.Text == "" {
+		apiError(w, &requestError{http.StatusBadRequest, "invalid_option", errors.New("no stamp text given. Set text or preset")})
+		return
+	}
+	pageCount, err := utils.PageCount(req.doc)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+
+	var out bytes.Buffer
+	if err := utils.TextStampRS(req.doc, &out, opts.WatermarkOptions); err != nil {
+		apiError(w, err)
+		return
+	}
+	if err := auditDocument(r, "stamp", req.filename, req.doc, pageCount, "", ""); err != nil {
+		apiError(w, err)
+		return
+	}
+	writePDF(w, &out, pageCount)
+}
+
+// apiExhibitRequest are the options of /api/v1/exhibit
+type apiExhibitRequest struct {
+	Label string `json:"label"`
+	utils.ExhibitScheme
+	utils.ExhibitOptions
+}
+
+func apiExhibitHandler(w http.ResponseWriter, r *http.Request) {
+	req, err := readAPIRequest(w, r)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	opts := apiExhibitRequest{
+		ExhibitScheme:  utils.DefaultExhibitScheme(),
+		ExhibitOptions: utils.DefaultExhibitOptions(),
+	}
+	if err := req.decode(&opts); err != nil {
+		apiError(w, err)
+		return
+	}
+	label := opts.Label
+	if label == "" {
+		label, err = opts.ExhibitScheme.Label(0)
+		if err != nil {
+			apiError(w, err)
+			return
+		}
+	}
+
+	var out bytes.Buffer
+	if err := utils.ExhibitStampRS(req.doc, &out, label, opts.ExhibitOptions); err != nil {
+		apiError(w, err)
+		return
+	}
+	pageCount, err := utils.PageCount(bytes.NewReader(out.Bytes()))
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	inputPages, err := utils.PageCount(req.doc)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	if err := auditDocument(r, "exhibit", req.filename, req.doc, inputPages, "", ""); err != nil {
+		apiError(w, err)
+		return
+	}
+	w.Header().Set("X-Exhibit-Label", label)
+	writePDF(w, &out, pageCount)
+}
+
+func apiOpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPISpec)
+}
+
+// addAPIRoutes registers the JSON API on mux
+func addAPIRoutes(mux *http.ServeMux) {
+	mux.HandleFunc(apiPrefix+"/bates", apiBatesHandler)
+	mux.HandleFunc(apiPrefix+"/stamp", apiStampHandler)
+	mux.HandleFunc(apiPrefix+"/exhibit", apiExhibitHandler)
+	mux.HandleFunc(apiPrefix+"/openapi.json", apiOpenAPIHandler)
+}
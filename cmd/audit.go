@@ -0,0 +1,122 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var auditFilter utils.AuditFilter
+var auditSince string
+var auditUntil string
+var auditJSON bool
+var auditLogPath string
+
+// parseAuditTime parses a date (2006-01-02, local time) or an RFC 3339
+// timestamp
+func parseAuditTime(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// auditCmd represents the audit command
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Query the audit log of the server",
+	Long: `
+audit lists the documents processed by "pdftool server", with the
+user on whose behalf each was processed, its SHA-256 hash, page
+count and Bates range. The records may be filtered, e.g.
+
+  $ pdftool audit --user alice --since 2023-05-01
+  $ pdftool audit --bates ABC-00001234
+
+The audit log is --audit-log, else the "server.audit" config key, by
+default .pdftool-audit.log next to the config file.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		var err error
+		if auditSince != "" {
+			if auditFilter.Since, err = parseAuditTime(auditSince); err != nil {
+				log.Fatalf("invalid --since `%s`", auditSince)
+			}
+		}
+		if auditUntil != "" {
+			if auditFilter.Until, err = parseAuditTime(auditUntil); err != nil {
+				log.Fatalf("invalid --until `%s`", auditUntil)
+			}
+		}
+		audit := serverAuditLog()
+		if auditLogPath != "" {
+			audit = utils.NewAuditLog(auditLogPath)
+		}
+		records, err := audit.Records(auditFilter)
+		if err != nil {
+			log.Fatalf("Error reading audit log `%s`\n%s\n", audit.Path, err)
+		}
+
+		if auditJSON {
+			enc := json.NewEncoder(os.Stdout)
+			for _, rec := range records {
+				enc.Encode(rec)
+			}
+			return
+		}
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		defer tw.Flush()
+		fmt.Fprintln(tw, "TIME\tUSER\tACTION\tFILE\tPAGES\tBATES\tSHA256")
+		for _, rec := range records {
+			bates := ""
+			if rec.BegBates != "" {
+				bates = rec.BegBates + "-" + rec.EndBates
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+				rec.Time.Local().Format("2006-01-02 15:04:05"),
+				rec.User,
+				rec.Action,
+				rec.FileName,
+				rec.PageCount,
+				bates,
+				rec.SHA256,
+			)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(auditCmd)
+
+	auditCmd.Flags().StringVar(&auditFilter.User, "user", "", "only documents processed for this user")
+	auditCmd.Flags().StringVar(&auditFilter.Action, "action", "", "only documents processed by this action (bates, draft, stamp, exhibit)")
+	auditCmd.Flags().StringVar(&auditFilter.FileName, "file", "", "only documents whose filename contains this")
+	auditCmd.Flags().StringVar(&auditFilter.SHA256, "sha256", "", "only documents with this SHA-256 hash")
+	auditCmd.Flags().StringVar(&auditFilter.Bates, "bates", "", "only the document stamped with this Bates number")
+	auditCmd.Flags().StringVar(&auditSince, "since", "", "only documents processed from this date or time on")
+	auditCmd.Flags().StringVar(&auditUntil, "until", "", "only documents processed before this date or time")
+	auditCmd.Flags().BoolVar(&auditJSON, "json", false, "print the records as JSON lines")
+	auditCmd.Flags().StringVar(&auditLogPath, "audit-log", "", "audit log (default is the server.audit config key, or .pdftool-audit.log next to the config file)")
+}
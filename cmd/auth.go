@@ -0,0 +1,237 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var auditLog *utils.AuditLog
+var auditLogOnce sync.Once
+
+// serverAuditLog returns the audit log of the server. Its location is
+// the `server.audit` config key, or .pdftool-audit.log next to the
+// config file.
+func serverAuditLog() *utils.AuditLog {
+	auditLogOnce.Do(func() {
+		path := viper.GetString("server.audit")
+		if path == "" {
+			path = configSiblingPath(".pdftool-audit.log")
+		}
+		auditLog = utils.NewAuditLog(path)
+	})
+	return auditLog
+}
+
+// tokenEntry is an API token of the `server.tokens` list. Tokens are
+// values, not keys, as the config keys are not case sensitive.
+type tokenEntry struct {
+	User  string `mapstructure:"user"`
+	Token string `mapstructure:"token"`
+}
+
+// serverTokens reads the API tokens of the `server.tokens` list
+func serverTokens() (utils.TokenAuth, error) {
+	entries := []tokenEntry{}
+	if err := viper.UnmarshalKey("server.tokens", &entries); err != nil {
+		return nil, fmt.Errorf("`server.tokens` must be a list of user and token entries: %w", err)
+	}
+	tokens := utils.TokenAuth{}
+	for i, e := range entries {
+		if e.User == "" || e.Token == "" {
+			return nil, fmt.Errorf("`server.tokens` entry %d needs a user and a token", i+1)
+		}
+		tokens[e.Token] = e.User
+	}
+	return tokens, nil
+}
+
+// serverAuthenticator returns the authenticator selected by the
+// `server.auth` config key (or --auth), or nil for none
+func serverAuthenticator() (utils.Authenticator, error) {
+	switch mode := viper.GetString("server.auth"); mode {
+	case "", "none":
+		return nil, nil
+	case "token":
+		tokens, err := serverTokens()
+		if err != nil {
+			return nil, err
+		}
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("no API tokens under `server.tokens` in the config file")
+		}
+		return tokens, nil
+	case "basic":
+		path := viper.GetString("server.users")
+		if path == "" {
+			return nil, fmt.Errorf("no users file given. Use --users")
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return utils.ReadUsers(f)
+	case "proxy":
+		return utils.NewProxyAuth(viper.GetString("server.proxy.header"), viper.GetStringSlice("server.proxy.trusted"))
+	default:
+		return nil, fmt.Errorf("unknown auth mode `%s` (expected none, token, basic or proxy)", mode)
+	}
+}
+
+// userKey is the request context key of the authenticated user
+type userKey struct{}
+
+// withAuth requires the requests to next to be authenticated by auth
+func withAuth(auth utils.Authenticator, next http.Handler) http.Handler {
+	_, basic := auth.(utils.BasicAuth)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, err := auth.Authenticate(r)
+		if err != nil {
+			log.Printf("Rejected %s %s from %s: %s", r.Method, r.URL.Path, r.RemoteAddr, err)
+			if basic {
+				w.Header().Set("WWW-Authenticate", `Basic realm="pdftool", charset="UTF-8"`)
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), userKey{}, user)))
+	})
+}
+
+// requestUser returns the authenticated user making r, or "anonymous"
+// if the server does not authenticate
+func requestUser(r *http.Request) string {
+	if user, ok := r.Context().Value(userKey{}).(string); ok {
+		return user
+	}
+	return "anonymous"
+}
+
+// hashReader returns the hex SHA-256 hash of rs, leaving it at its
+// beginning
+func hashReader(rs io.ReadSeeker) (string, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, rs); err != nil {
+		return "", err
+	}
+	_, err := rs.Seek(0, io.SeekStart)
+	return fmt.Sprintf("%x", h.Sum(nil)), err
+}
+
+// audit records rec, made on behalf of r, in the audit log
+func audit(r *http.Request, rec utils.AuditRecord) error {
+	rec.User = requestUser(r)
+	rec.Remote = r.RemoteAddr
+	if err := serverAuditLog().Append(rec); err != nil {
+		return fmt.Errorf("error writing audit log: %w", err)
+	}
+	countStamped(rec)
+	return nil
+}
+
+// auditDocument records that the document rs, named name, was processed
+// by action on behalf of r
+func auditDocument(r *http.Request, action string, name string, rs io.ReadSeeker, pages int, begBates string, endBates string) error {
+	hash, err := hashReader(rs)
+	if err != nil {
+		return err
+	}
+	return audit(r, utils.AuditRecord{
+		Action:    action,
+		FileName:  name,
+		SHA256:    hash,
+		PageCount: pages,
+		BegBates:  begBates,
+		EndBates:  endBates,
+	})
+}
+
+// adduserCmd represents the server adduser command
+var adduserCmd = &cobra.Command{
+	Use:   "adduser user",
+	Short: "Add a user to the users file of the server",
+	Long: `
+adduser reads a password from standard input and appends the user,
+with the bcrypt hash of the password, to the users file given by
+--users (or the "server.users" config key), used by
+"pdftool server --auth basic". For example,
+
+  $ pdftool server adduser --users users.txt alice`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		path := viper.GetString("server.users")
+		if path == "" {
+			log.Fatal("no users file given. Use --users")
+		}
+		fmt.Fprintf(os.Stderr, "Password for %s: ", args[0])
+		password, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && err != io.EOF {
+			log.Fatal(err)
+		}
+		password = strings.TrimRight(password, "\r\n")
+		if password == "" {
+			log.Fatal("empty password")
+		}
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+		if err != nil {
+			log.Fatalf("Error opening users file `%s`\n%s\n", path, err)
+		}
+		defer f.Close()
+		if err := utils.WriteUser(f, args[0], password); err != nil {
+			log.Fatalf("Error adding user `%s`\n%s\n", args[0], err)
+		}
+		if err := f.Close(); err != nil {
+			log.Fatalf("Error writing users file `%s`\n%s\n", path, err)
+		}
+	},
+}
+
+func init() {
+	serverCmd.AddCommand(adduserCmd)
+
+	serverCmd.PersistentFlags().String("users", "", "users file of user:bcrypt-hash lines for --auth basic")
+	viper.BindPFlag("server.users", serverCmd.PersistentFlags().Lookup("users"))
+	serverCmd.Flags().String("auth", "none", "authentication: none, token (server.tokens in the config file), basic (--users) or proxy")
+	serverCmd.Flags().String("proxy-header", "X-Forwarded-User", "header naming the user authenticated by a reverse proxy, for --auth proxy")
+	serverCmd.Flags().StringSlice("trusted-proxy", []string{"127.0.0.1", "::1"}, "addresses or CIDR ranges of the reverse proxies trusted for --auth proxy")
+	serverCmd.Flags().String("audit-log", "", "audit log (default is .pdftool-audit.log next to the config file)")
+	for key, flag := range map[string]string{
+		"server.auth":          "auth",
+		"server.proxy.header":  "proxy-header",
+		"server.proxy.trusted": "trusted-proxy",
+		"server.audit":         "audit-log",
+	} {
+		viper.BindPFlag(key, serverCmd.Flags().Lookup(flag))
+	}
+}
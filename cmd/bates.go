@@ -16,12 +16,18 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
+	"crypto/md5"
 	"fmt"
+	"io"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/kjinho/pdftool/src/utils"
 )
@@ -30,10 +36,205 @@ var prefix string
 var separator string
 var buffer int
 var startNo int64
+var loadFiles []string
+var loadFileName string
+var volumeLabel string
+var datDelimiter string
+var datQuote string
+var datNewline string
+var matterName string
+var designation string
+var designationMap string
+var batesScrub bool
+var batesManifest string
+
+// batesStyle returns the Bates endorsement style from the flags of
+// batesCmd, falling back to the `bates` section of the config file.
+func batesStyle() utils.BatesStyle {
+	return utils.BatesStyle{
+		FontName:    viper.GetString("bates.font"),
+		FontSize:    viper.GetInt("bates.fontsize"),
+		Position:    viper.GetString("bates.position"),
+		MarginX:     viper.GetFloat64("bates.marginx"),
+		MarginY:     viper.GetFloat64("bates.marginy"),
+		Padding:     viper.GetInt("bates.padding"),
+		FillColor:   viper.GetString("bates.color"),
+		BgColor:     viper.GetString("bates.bgcolor"),
+		Opacity:     viper.GetFloat64("bates.opacity"),
+		BorderWidth: viper.GetInt("bates.border"),
+		BorderColor: viper.GetString("bates.bordercolor"),
+
+		DesignationPosition: viper.GetString("bates.designationposition"),
+	}
+}
+
+// loadDesignations reads the --designation-map file, if any
+func loadDesignations() utils.Designations {
+	if designationMap == "" {
+		return utils.Designations{}
+	}
+	f, err := os.Open(designationMap)
+	if err != nil {
+		log.Fatalf("Error opening designation map `%s`\n%s\n", designationMap, err)
+	}
+	defer f.Close()
+	d, err := utils.ReadDesignations(f)
+	if err != nil {
+		log.Fatalf("Error reading designation map `%s`\n%s\n", designationMap, err)
+	}
+	return d
+}
+
+// countPages returns the page count of each of files and their total,
+// exiting if any of them is not a readable PDF
+func countPages(files []string) ([]int, int64) {
+	pageCounts := make([]int, len(files))
+	totalPages := int64(0)
+	for i := range files {
+		_, err := os.Stat(files[i])
+		if err != nil {
+			log.Fatalf("inFile `%s` does not exist", files[i])
+		}
+		pageCounts[i], err = api.PageCountFile(files[i])
+		if err != nil {
+			log.Fatalf("error with inFile `%s`: %s", files[i], err)
+		}
+		totalPages += int64(pageCounts[i])
+	}
+	return pageCounts, totalPages
+}
+
+// isNative reports whether file is to be produced natively, being
+// neither a PDF, by its header, nor an image. It exits if file is of no
+// format known to be produced natively.
+func isNative(file string) bool {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("inFile `%s` does not exist", file)
+	}
+	defer f.Close()
+	pdf, err := utils.IsPDF(f)
+	if err != nil {
+		log.Fatalf("Error reading file `%s`\n%s\n", file, err)
+	}
+	switch {
+	case pdf, utils.IsImage(file):
+		return false
+	case utils.IsNative(file):
+		return true
+	}
+	log.Fatalf("inFile `%s` is not a PDF, an image or a native format (spreadsheet, presentation, document, email, audio or video). To produce a placeholder for it, give it a native slip sheet in a --manifest", file)
+	return false
+}
+
+// entryPageCounts returns the page count of each of entries and their
+// total as countPages does, counting a page for each slip sheet and
+// native placeholder and the pages of images
+func entryPageCounts(entries []utils.BinderEntry) ([]int, int64) {
+	pageCounts := make([]int, len(entries))
+	totalPages := int64(0)
+	for i, e := range entries {
+		pageCounts[i] = 1
+		switch {
+		case e.SlipSheet != "":
+		case isNative(e.Path):
+		case utils.IsImage(e.Path):
+			pageCounts[i] = imagePageCount(e.Path)
+		default:
+			counts, _ := countPages([]string{e.Path})
+			pageCounts[i] = counts[0]
+		}
+		totalPages += int64(pageCounts[i])
+	}
+	return pageCounts, totalPages
+}
+
+// entryPDF returns the PDF of a manifest entry: its file, converted if an
+// image, or the slip sheet or native placeholder standing in for it
+func entryPDF(e utils.BinderEntry) []byte {
+	var b bytes.Buffer
+	switch {
+	case e.SlipSheet != "":
+		if err := utils.SlipSheet(&b, e.SlipSheet); err != nil {
+			log.Fatalf("Error creating slip sheet for `%s`\n%s\n", e.Path, err)
+		}
+		return b.Bytes()
+	case isNative(e.Path):
+		hash, err := utils.HashFile(e.Path, md5.New())
+		if err != nil {
+			log.Fatalf("Error hashing file `%s`\n%s\n", e.Path, err)
+		}
+		if err := utils.NativePlaceholder(&b, filepath.Base(e.Path), hash); err != nil {
+			log.Fatalf("Error creating placeholder for `%s`\n%s\n", e.Path, err)
+		}
+		return b.Bytes()
+	case utils.IsImage(e.Path):
+		return imagePDF(e.Path)
+	}
+	pdf, err := os.ReadFile(e.Path)
+	if err != nil {
+		log.Fatalf("Error opening file `%s`\n%s\n", e.Path, err)
+	}
+	return pdf
+}
+
+// copyNative copies the native file to dest
+func copyNative(file string, dest string) {
+	if _, err := os.Stat(dest); !Overwrite && err == nil {
+		log.Fatalf("outFile `%s` already exists. To overwrite, use --force", dest)
+	}
+	fIn, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("Error opening file `%s`\n%s\n", file, err)
+	}
+	defer fIn.Close()
+	fOut, err := os.Create(dest)
+	if err != nil {
+		log.Fatalf("Error creating file `%s`\n%s\n", dest, err)
+	}
+	defer fOut.Close()
+	if _, err := io.Copy(fOut, fIn); err != nil {
+		log.Fatalf("Error copying `%s` to `%s`\n%s\n", file, dest, err)
+	}
+	if err := fOut.Close(); err != nil {
+		log.Fatalf("Error creating file `%s`\n%s\n", dest, err)
+	}
+}
+
+// nextBates returns the matter's format string and the first of the
+// totalPages Bates numbers next for --matter, without reserving them.
+// The command reserves them by commitBates once its outputs are written,
+// so that a failure leaves them to the next production.
+func nextBates(cmd *cobra.Command, totalPages int64) (string, int64) {
+	start := int64(0)
+	if cmd.Flags().Changed("number") {
+		start = startNo
+	}
+	defaults := utils.Matter{Prefix: prefix, Separator: separator, Width: buffer}
+	m, next, err := matterRegistry().Next(matterName, start, totalPages, defaults)
+	if err != nil {
+		log.Fatalf("Error reserving bates numbers for matter `%s`\n%s\n", matterName, err)
+	}
+	return m.FmtString(), next.Start
+}
+
+// commitBates reserves for --matter the totalPages Bates numbers from
+// start given by nextBates. If they were issued meanwhile to another
+// production, the outputs written with them are removed.
+func commitBates(start, totalPages int64, note string, outputs ...string) {
+	defaults := utils.Matter{Prefix: prefix, Separator: separator, Width: buffer}
+	_, _, err := matterRegistry().Reserve(matterName, start, totalPages, defaults, currentUser(), note)
+	if err != nil {
+		for _, output := range outputs {
+			os.RemoveAll(output)
+		}
+		log.Fatalf("Error reserving bates numbers for matter `%s`\n%s\n", matterName, err)
+	}
+}
 
 // batesCmd represents the bates command
 var batesCmd = &cobra.Command{
-	Use:   "bates inFile1 ...",
+	Use:   "bates [inFile1 ...]",
 	Short: "Bates stamp PDF files",
 	Long: `
 bates provides a tool to Bates stamp PDFs. Mandatory arguments are the 
@@ -49,32 +250,148 @@ For example, given a 10-page PDF infile.pdf,
 takes infile.pdf and writes a new PDF with bates numbers starting with
 ABCD_0000000101 on the first page of the PDF. The output filename will
 be infile-ABCD_0000000101-ABCD_0000000110.pdf.
+
+The appearance of the endorsement (position, font, colors, border and
+margins) may be set with flags or in the "bates" section of the config
+file, e.g.
+
+  bates:
+    position: bc
+    font: Courier
+    fontsize: 10
+    border: 0
+
+Use --loadfile to also write production load files (Concordance DAT,
+Opticon OPT and/or CSV) describing the stamped documents, e.g.
+
+  $ pdftool bates *.pdf -p ABCD --loadfile dat,opt
+
+By default the load files are written next to the first output file and
+named after the overall Bates range.
+
+Use --matter to continue the numbering of a matter where its last
+production ended. The matter registry remembers the numbering format
+and every range issued, and refuses to issue overlapping ranges:
+
+  $ pdftool bates --matter ACME -p ACME -s _ infile.pdf
+
+The prefix, separator and width given when a matter is first used are
+kept for all later productions. List the issued ranges with
+
+  $ pdftool bates ranges ACME
+
+Use --designation to place a confidentiality legend on every page in
+the corner opposite the Bates number (or at --designation-position):
+
+  $ pdftool bates --designation "CONFIDENTIAL" infile.pdf
+
+Per-document designations may be given in a CSV file of
+"filename,designation" records with --designation-map; documents not
+listed in the file receive --designation.
+
+Use --scrub to also remove metadata (author, XMP, comments, JavaScript,
+attachments and so on; see the scrub command) in the same pass:
+
+  $ pdftool bates --scrub -p ABCD infile.pdf
+
+The documents may also be given by a --manifest, as for the binder
+command, in which entries with a slipsheet stand for documents withheld
+or produced natively. Each gets a one-page slip sheet bearing the next
+Bates number and the slipsheet text, "withheld" and "native" standing
+for "Document Withheld – Privileged" and "Produced in Native Format":
+
+  path,slipsheet
+  email-0001.pdf,
+  email-0002.msg,withheld
+  budget.xlsx,native
+  memo.docx,Withheld – Work Product
+
+  $ pdftool bates -m production.csv -p ABCD --loadfile dat,opt
+
+Slip sheets are numbered in sequence with the other documents. A slip
+sheet for a native is written as a PDF named after the native and
+listed in the load files under its filename. One for a document
+withheld is named after its Bates number (e.g. ABCD_00001235.pdf) and
+listed without a filename or hash, so that nothing of the privileged
+document is disclosed.
+
+Files other than PDFs (spreadsheets, audio, video and so on) are
+produced natively: each gets a placeholder page bearing "Produced in
+Native Format" with its original filename and MD5 hash, stamped with
+its Bates number and designation, and the native is copied next to it
+named after its Bates number (e.g. ABCD_00001234.xlsx). The load files
+give its path in a NATIVEPATH column, added to the load files of
+productions with natives. Files are taken for PDFs by their %PDF- header
+and for images by their extension; files of other formats are produced
+natively only if of a known native format (spreadsheets, presentations,
+documents, email, audio and video), and are otherwise an error.
+
+  $ pdftool bates -p ABCD -s _ report.pdf budget.xlsx interview.mp3
+
+Images (JPEG, PNG and TIFF, including multipage TIFFs) are converted to
+PDFs and stamped like them, fit to Letter pages unless --page-size
+gives a4 or native (see the convert command):
+
+  $ pdftool bates -p ABCD --page-size native scan.tif photo.jpg
   `,
-	Args: cobra.MinimumNArgs(1),
 	Run: func(cmd *cobra.Command, args []string) {
-		nargs := len(args)
+		entries := []utils.BinderEntry{}
+		if batesManifest != "" {
+			entries = readManifest(batesManifest)
+		}
+		for _, arg := range args {
+			entries = append(entries, utils.BinderEntry{Path: arg})
+		}
+		if len(entries) == 0 {
+			log.Fatal("no inFiles given. Give inFiles or --manifest")
+		}
 		xstartNo := startNo
-		for i := 0; i < nargs; i++ {
-			_, err := os.Stat(args[i])
-			if err != nil {
-				log.Fatalf("inFile `%s` does not exist", args[i])
-			}
-			pageCount, err := api.PageCountFile(args[i])
-			if err != nil {
-				log.Fatalf("error with inFile `%s`: %s", args[i], err)
-			}
-			fmtString := utils.GenerateFmtString(prefix, separator, buffer)
+		fmtString := utils.GenerateFmtString(prefix, separator, buffer)
+		style := batesStyle()
+		designations := loadDesignations()
+		if err := checkLoadFileFormats(loadFiles); err != nil {
+			log.Fatal(err)
+		}
+
+		pageCounts, totalPages := entryPageCounts(entries)
+		if matterName != "" {
+			fmtString, xstartNo = nextBates(cmd, totalPages)
+		}
+		firstNo := xstartNo
+		written := []string{}
+		natives := utils.Natives{}
+
+		docs := []utils.ProductionDocument{}
+		for i, e := range entries {
+			pageCount := pageCounts[i]
 			startBates := fmt.Sprintf(fmtString, xstartNo)
 			stopBates := fmt.Sprintf(fmtString, xstartNo+int64(pageCount)-1)
 
-			newFilename := generateNewFilename(args[i], "-"+startBates+"-"+stopBates)
-			_, err = os.Stat(newFilename)
+			// slip sheets, placeholders and converted images are PDFs
+			// whatever they stand for
+			native := e.SlipSheet == "" && isNative(e.Path)
+			outFile := e.Path
+			if e.SlipSheet != "" || native || !strings.EqualFold(filepath.Ext(e.Path), ".pdf") {
+				outFile = pdfFilename(e.Path)
+			}
+			newFilename := generateNewFilename(outFile, "-"+startBates+"-"+stopBates)
+			if e.Withheld() {
+				newFilename = filepath.Join(filepath.Dir(e.Path), startBates+".pdf")
+			}
+			_, err := os.Stat(newFilename)
 			if !Overwrite && err == nil {
 				log.Fatalf("outFile `%s` already exists. To overwrite, use --force", newFilename)
 			}
+			input := e.Path
+			switch {
+			case e.SlipSheet != "":
+				input = fmt.Sprintf("slip sheet for %s (%s)", e.Path, utils.SlipSheetText(e.SlipSheet))
+			case native:
+				input = fmt.Sprintf("placeholder for native %s", e.Path)
+			}
 			log.Printf(
 				"Performing bates numbering\nInput:\t%s\nOutput:\t%s\nStart:\t%s\nStop:\t%s\n",
-				args[i],
+				input,
 				newFilename,
 				startBates,
 				stopBates,
@@ -85,20 +402,96 @@ be infile-ABCD_0000000101-ABCD_0000000110.pdf.
 				log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
 			}
 			defer fOut.Close()
-			fIn, err := os.Open(args[i])
+			written = append(written, newFilename)
+			endorse := utils.BatesEndorseRS
+			if batesScrub {
+				endorse = utils.ScrubBatesEndorseRS
+			}
+			err = endorse(bytes.NewReader(entryPDF(e)), fOut, fmtString, xstartNo, designations.For(e.Path, designation), style)
 			if err != nil {
-				log.Fatalf("Error opening file `%s`\n%s\n", args[i], err)
+				log.Fatalf("Error stamping `%s`\n%s\n", e.Path, err)
 			}
-			defer fIn.Close()
-			utils.BatesStampRS(fIn, fOut, fmtString, xstartNo)
+
+			doc := utils.ProductionDocument{
+				FmtString: fmtString,
+				StartNo:   xstartNo,
+				PageCount: pageCount,
+				Path:      newFilename,
+			}
+			// nothing of a document withheld is disclosed; the hash of a
+			// native stood for by a slip sheet is recorded if it is at hand
+			if !e.Withheld() {
+				hash, err := utils.HashFile(e.Path, md5.New())
+				if err != nil && e.SlipSheet == "" {
+					log.Fatalf("Error hashing file `%s`\n%s\n", e.Path, err)
+				}
+				doc.FileName = filepath.Base(e.Path)
+				doc.MD5 = hash
+			}
+			if native {
+				// the native is renamed to its Bates number
+				nativePath := filepath.Join(filepath.Dir(newFilename), startBates+filepath.Ext(e.Path))
+				copyNative(e.Path, nativePath)
+				written = append(written, nativePath)
+				natives[startBates] = nativePath
+				log.Printf("Copied native %s to %s", e.Path, nativePath)
+			}
+			docs = append(docs, doc)
 
 			xstartNo += int64(pageCount)
 		}
+
+		if len(loadFiles) > 0 {
+			base := loadFileName
+			if base == "" {
+				dir := filepath.Dir(docs[0].Path)
+				base = filepath.Join(dir, docs[0].BegBates()+"-"+docs[len(docs)-1].EndBates())
+			}
+			for i := range docs {
+				rel, err := filepath.Rel(filepath.Dir(base), docs[i].Path)
+				if err == nil {
+					docs[i].Path = rel
+				}
+			}
+			for beg, path := range natives {
+				if rel, err := filepath.Rel(filepath.Dir(base), path); err == nil {
+					natives[beg] = rel
+				}
+			}
+			opts := utils.DATOptions{
+				Delimiter: utils.ParseDelimiter(datDelimiter),
+				Quote:     utils.ParseDelimiter(datQuote),
+				Newline:   utils.ParseDelimiter(datNewline),
+			}
+			if err := writeLoadFiles(base, loadFiles, docs, natives, volumeLabel, opts); err != nil {
+				log.Fatalf("Error writing load files\n%s\n", err)
+			}
+			for _, format := range loadFiles {
+				written = append(written, base+"."+format)
+			}
+		}
+
+		if matterName != "" {
+			files := make([]string, len(entries))
+			for i, e := range entries {
+				files[i] = e.Path
+			}
+			commitBates(firstNo, totalPages, strings.Join(files, ", "), written...)
+		}
 	},
 }
 
+// batesOperation offers the bates command and the Bates form and route
+// of the server
+var batesOperation = &operation{
+	Name:    "bates",
+	Title:   "Bates Stamp",
+	Short:   batesCmd.Short,
+	Cmd:     batesCmd,
+	Handler: batesHandler,
+}
+
 func init() {
-	rootCmd.AddCommand(batesCmd)
 
 	// Here you will define your flags and configuration settings.
 
@@ -114,4 +507,48 @@ func init() {
 	batesCmd.Flags().IntVarP(&buffer, "width", "w", 8, "number of characters for number")
 	batesCmd.Flags().Int64VarP(&startNo, "number", "n", 1, "number to start on")
 	batesCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output file (default: error on existing output file)")
+
+	batesCmd.Flags().StringVar(&matterName, "matter", "", "continue the numbering of this matter (see `bates ranges`)")
+	batesCmd.Flags().StringVar(&designation, "designation", "", "confidentiality designation to place on each page")
+	batesCmd.Flags().StringVar(&designationMap, "designation-map", "", "CSV file of filename,designation records")
+	batesCmd.Flags().BoolVar(&batesScrub, "scrub", false, "also remove metadata, as by the scrub command")
+	batesCmd.Flags().StringVarP(&batesManifest, "manifest", "m", "", "CSV or YAML file listing the documents and slip sheets")
+	addConvertFlags(batesCmd)
+	batesCmd.Flags().StringSliceVar(&loadFiles, "loadfile", nil, "load files to write (dat, opt, csv)")
+	batesCmd.Flags().StringVar(&loadFileName, "loadfile-name", "", "path of the load files without extension (default: named after the Bates range)")
+	batesCmd.Flags().StringVar(&volumeLabel, "volume", "", "volume label for the OPT load file")
+	batesCmd.Flags().StringVar(&datDelimiter, "dat-delimiter", `\x14`, "DAT field delimiter (Concordance ¶)")
+	batesCmd.Flags().StringVar(&datQuote, "dat-quote", "þ", "DAT field quote character")
+	batesCmd.Flags().StringVar(&datNewline, "dat-newline", "®", "DAT replacement for line breaks within a field")
+
+	def := utils.DefaultBatesStyle()
+	batesCmd.Flags().String("position", def.Position, "position of the stamp (tl, tc, tr, l, c, r, bl, bc, br)")
+	batesCmd.Flags().String("font", def.FontName, "font name")
+	batesCmd.Flags().Int("font-size", def.FontSize, "font size in points")
+	batesCmd.Flags().String("color", def.FillColor, "text color")
+	batesCmd.Flags().String("bgcolor", def.BgColor, "background color (empty for none)")
+	batesCmd.Flags().Float64("opacity", def.Opacity, "opacity between 0 and 1")
+	batesCmd.Flags().Int("border", def.BorderWidth, "border width in points (0 for none)")
+	batesCmd.Flags().String("border-color", def.BorderColor, "border color")
+	batesCmd.Flags().Float64("margin-x", def.MarginX, "horizontal distance from the page edge in points")
+	batesCmd.Flags().Float64("margin-y", def.MarginY, "vertical distance from the page edge in points")
+	batesCmd.Flags().Int("padding", def.Padding, "space between the text and the border in points")
+	batesCmd.Flags().String("designation-position", "", "position of the designation (default: opposite the Bates number)")
+	for key, flag := range map[string]string{
+		"bates.position":    "position",
+		"bates.font":        "font",
+		"bates.fontsize":    "font-size",
+		"bates.color":       "color",
+		"bates.bgcolor":     "bgcolor",
+		"bates.opacity":     "opacity",
+		"bates.border":      "border",
+		"bates.bordercolor": "border-color",
+		"bates.marginx":     "margin-x",
+		"bates.marginy":     "margin-y",
+		"bates.padding":     "padding",
+
+		"bates.designationposition": "designation-position",
+	} {
+		cobra.CheckErr(viper.BindPFlag(key, batesCmd.Flags().Lookup(flag)))
+	}
 }
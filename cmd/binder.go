@@ -0,0 +1,199 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var binderOut string
+var binderManifest string
+var binderBates bool
+var binderLabel bool
+var binderOptions = utils.DefaultBinderOptions()
+
+// readManifest reads the entries of the manifest file, a CSV or YAML
+// binder manifest, with paths made relative to it
+func readManifest(manifest string) []utils.BinderEntry {
+	f, err := os.Open(manifest)
+	if err != nil {
+		log.Fatalf("Error opening manifest `%s`\n%s\n", manifest, err)
+	}
+	defer f.Close()
+	format := strings.TrimPrefix(filepath.Ext(manifest), ".")
+	entries, err := utils.ReadBinderManifest(f, format)
+	if err != nil {
+		log.Fatalf("Error reading manifest `%s`\n%s\n", manifest, err)
+	}
+	// paths are relative to the manifest
+	for i := range entries {
+		if !filepath.IsAbs(entries[i].Path) {
+			entries[i].Path = filepath.Join(filepath.Dir(manifest), entries[i].Path)
+		}
+	}
+	return entries
+}
+
+// binderEntries returns the entries of the binder, read from
+// --manifest or else made from args
+func binderEntries(args []string) []utils.BinderEntry {
+	entries := []utils.BinderEntry{}
+	if binderManifest != "" {
+		entries = readManifest(binderManifest)
+	}
+	for _, arg := range args {
+		entries = append(entries, utils.BinderEntry{Path: arg})
+	}
+
+	scheme := utils.DefaultExhibitScheme()
+	for i := range entries {
+		if entries[i].Label == "" {
+			label, err := scheme.Label(i)
+			if err != nil {
+				log.Fatal(err)
+			}
+			entries[i].Label = label
+		}
+		if entries[i].Description == "" {
+			base := filepath.Base(entries[i].Path)
+			entries[i].Description = strings.TrimSuffix(base, filepath.Ext(base))
+		}
+	}
+	return entries
+}
+
+// binderCmd represents the binder command
+var binderCmd = &cobra.Command{
+	Use:   "binder [inFile1 ...]",
+	Short: "Compile exhibits into a binder with an index",
+	Long: `
+binder merges a list of PDFs into a single binder, preceded by an index
+listing each exhibit with its description and its page (or Bates)
+range. Index entries link to the first page of their exhibit, and each
+exhibit gets a bookmark.
+
+The exhibits are given as arguments and/or by a --manifest, a CSV file
+with a header row or a YAML list, with the fields path, label,
+description, begbates, endbates and slipsheet (only path is required;
+paths are relative to the manifest, entries with a slipsheet are slip
+sheets and images are converted, as for the bates command). For
+example,
+
+  path,label,description
+  decl.pdf,Exhibit A,Declaration of J. Smith
+  contract.pdf,Exhibit B,Master Services Agreement
+
+Missing labels are Exhibit A, Exhibit B, ..., and missing descriptions
+are the filenames.
+
+With --bates, the exhibits are Bates stamped with continuous numbering
+(using the same flags and "bates" configuration as the bates command)
+and the index shows the Bates ranges. With --label, each exhibit is
+also labeled on its first page as by the exhibit command.
+
+  $ pdftool binder --manifest exhibits.csv --bates -p ABC -o binder.pdf`,
+	Run: func(cmd *cobra.Command, args []string) {
+		entries := binderEntries(args)
+		if len(entries) == 0 {
+			log.Fatal("no exhibits given. Give inFiles or --manifest")
+		}
+		_, err := os.Stat(binderOut)
+		if !Overwrite && err == nil {
+			log.Fatalf("outFile `%s` already exists. To overwrite, use --force", binderOut)
+		}
+
+		pageCounts, totalPages := entryPageCounts(entries)
+
+		xstartNo := startNo
+		fmtString := utils.GenerateFmtString(prefix, separator, buffer)
+		if binderBates && matterName != "" {
+			fmtString, xstartNo = nextBates(cmd, totalPages)
+		}
+		firstNo := xstartNo
+		style := batesStyle()
+		designations := loadDesignations()
+
+		docs := make([]io.ReadSeeker, len(entries))
+		for i, e := range entries {
+			b := entryPDF(e)
+			if binderBates {
+				var out bytes.Buffer
+				err := utils.BatesEndorseRS(bytes.NewReader(b), &out, fmtString, xstartNo, designations.For(e.Path, designation), style)
+				if err != nil {
+					log.Fatalf("Error stamping `%s`\n%s\n", e.Path, err)
+				}
+				b = out.Bytes()
+				entries[i].BegBates = fmt.Sprintf(fmtString, xstartNo)
+				entries[i].EndBates = fmt.Sprintf(fmtString, xstartNo+int64(pageCounts[i])-1)
+				xstartNo += int64(pageCounts[i])
+			}
+			if binderLabel {
+				var out bytes.Buffer
+				if err := utils.ExhibitStampRS(bytes.NewReader(b), &out, e.Label, utils.DefaultExhibitOptions()); err != nil {
+					log.Fatalf("Error labeling `%s`\n%s\n", e.Path, err)
+				}
+				b = out.Bytes()
+			}
+			docs[i] = bytes.NewReader(b)
+		}
+
+		fOut, err := os.Create(binderOut)
+		if err != nil {
+			log.Fatalf("Error creating file `%s`\n%s\n", binderOut, err)
+		}
+		defer fOut.Close()
+		if err := utils.BinderRS(docs, fOut, entries, binderOptions); err != nil {
+			log.Fatalf("Error compiling binder\n%s\n", err)
+		}
+		if err := fOut.Close(); err != nil {
+			log.Fatalf("Error writing file `%s`\n%s\n", binderOut, err)
+		}
+		if binderBates && matterName != "" {
+			commitBates(firstNo, totalPages, "binder "+filepath.Base(binderOut), binderOut)
+		}
+		log.Printf("Compiled %d exhibits (%d pages) into %s", len(entries), totalPages, binderOut)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(binderCmd)
+
+	binderCmd.Flags().StringVarP(&binderOut, "out", "o", "binder.pdf", "output file")
+	binderCmd.Flags().StringVarP(&binderManifest, "manifest", "m", "", "CSV or YAML file describing the exhibits")
+	binderCmd.Flags().StringVar(&binderOptions.Title, "title", binderOptions.Title, "heading of the index")
+	binderCmd.Flags().IntVar(&binderOptions.FontSize, "font-size", binderOptions.FontSize, "font size of the index in points")
+	binderCmd.Flags().BoolVar(&binderLabel, "label", false, "label the first page of each exhibit")
+	binderCmd.Flags().BoolVar(&binderBates, "bates", false, "Bates stamp the exhibits and show Bates ranges in the index")
+	binderCmd.Flags().StringVarP(&prefix, "prefix", "p", "Bates", "bates numbering prefix")
+	binderCmd.Flags().StringVarP(&separator, "separator", "s", "-", "separator")
+	binderCmd.Flags().IntVarP(&buffer, "width", "w", 8, "number of characters for number")
+	binderCmd.Flags().Int64VarP(&startNo, "number", "n", 1, "number to start on")
+	binderCmd.Flags().StringVar(&matterName, "matter", "", "continue the numbering of this matter (see `bates ranges`)")
+	binderCmd.Flags().StringVar(&designation, "designation", "", "confidentiality designation to place on each page")
+	binderCmd.Flags().StringVar(&designationMap, "designation-map", "", "CSV file of filename,designation records")
+	addConvertFlags(binderCmd)
+	binderCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output file (default: error on existing output file)")
+}
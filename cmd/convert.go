@@ -0,0 +1,154 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var convertOptions = utils.DefaultConvertOptions()
+var convertOut string
+
+// addConvertFlags adds to cmd the flags converting its image inputs
+func addConvertFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&convertOptions.PageSize, "page-size", convertOptions.PageSize, "page size of images: letter or a4 to fit them to the page, or native for their own size")
+	cmd.Flags().Float64Var(&convertOptions.DPI, "dpi", convertOptions.DPI, "resolution of images in dots per inch (default: as recorded in each image, or 72)")
+}
+
+// imagePDF returns the PDF of the image file, exiting if it cannot be
+// converted
+func imagePDF(file string) []byte {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("inFile `%s` does not exist", file)
+	}
+	defer f.Close()
+	var out bytes.Buffer
+	if err := utils.ImagesToPDF([]io.Reader{f}, &out, convertOptions); err != nil {
+		log.Fatalf("Error converting `%s`\n%s\n", file, err)
+	}
+	return out.Bytes()
+}
+
+// imagePageCount returns the number of pages of the image file, exiting
+// if it is not a readable image
+func imagePageCount(file string) int {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("inFile `%s` does not exist", file)
+	}
+	defer f.Close()
+	count, err := utils.ImagePageCount(f)
+	if err != nil {
+		log.Fatalf("error with inFile `%s`: %s", file, err)
+	}
+	return count
+}
+
+// pdfFilename returns the name of the PDF converted from file
+func pdfFilename(file string) string {
+	return strings.TrimSuffix(file, filepath.Ext(file)) + ".pdf"
+}
+
+// convertCmd represents the convert command
+var convertCmd = &cobra.Command{
+	Use:   "convert inFile1 ...",
+	Short: "Convert JPEG, PNG and TIFF images to PDF",
+	Long: `
+convert converts images (JPEG, PNG and TIFF, including multipage TIFFs
+such as scanned productions) to PDFs, with a page for each image or
+TIFF page, each written next to its image with the extension .pdf:
+
+  $ pdftool convert scan.tif photo1.jpg
+
+or, with --out, all to one PDF in the order given:
+
+  $ pdftool convert -o photos.pdf photo1.jpg photo2.jpg
+
+Images are fit to Letter pages, centered and turned to landscape where
+wider than tall, or, with --page-size, to A4 pages or (native) to pages
+of their own size at their resolution. The resolution is that recorded
+in each image (72 dots per inch where none is) unless given by --dpi.
+Photos are turned upright as their camera records.
+
+The bates, merge, binder and stamp commands take images as they do
+PDFs, converting them with the same flags, e.g.
+
+  $ pdftool bates -p ABCD --page-size native scan.tif photo1.jpg`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		for _, file := range args {
+			if !utils.IsImage(file) {
+				log.Fatalf("inFile `%s` is not a JPEG, PNG or TIFF image", file)
+			}
+		}
+		outputs := map[string][]string{}
+		newFilenames := []string{}
+		for _, file := range args {
+			newFilename := pdfFilename(file)
+			if convertOut != "" {
+				newFilename = convertOut
+			}
+			if _, ok := outputs[newFilename]; !ok {
+				newFilenames = append(newFilenames, newFilename)
+			}
+			outputs[newFilename] = append(outputs[newFilename], file)
+		}
+		for _, newFilename := range newFilenames {
+			if _, err := os.Stat(newFilename); !Overwrite && err == nil {
+				log.Fatalf("outFile `%s` already exists. To overwrite, use --force", newFilename)
+			}
+		}
+
+		for _, newFilename := range newFilenames {
+			files := outputs[newFilename]
+			images := []io.Reader{}
+			for _, file := range files {
+				f, err := os.Open(file)
+				if err != nil {
+					log.Fatalf("inFile `%s` does not exist", file)
+				}
+				defer f.Close()
+				images = append(images, f)
+			}
+			var out bytes.Buffer
+			if err := utils.ImagesToPDF(images, &out, convertOptions); err != nil {
+				log.Fatalf("Error converting `%s`\n%s\n", strings.Join(files, "`, `"), err)
+			}
+			if err := os.WriteFile(newFilename, out.Bytes(), 0o644); err != nil {
+				log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
+			}
+			log.Printf("Wrote %s", newFilename)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(convertCmd)
+
+	convertCmd.Flags().StringVarP(&convertOut, "out", "o", "", "write all images to this PDF (default: a PDF next to each image)")
+	addConvertFlags(convertCmd)
+	convertCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output files (default: error on existing output files)")
+}
@@ -0,0 +1,104 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+// exhibitOperation labels exhibits
+var exhibitOperation = &operation{
+	Name:  "exhibit",
+	Title: "Exhibit Label",
+	Short: "Label exhibits",
+	Long: `
+exhibit labels each of an ordered list of PDFs as an exhibit, stamping
+the label in the corner of the first page (or, with --all-pages, of
+every page). With --cover, a cover sheet reading the label is inserted
+before the first page.
+
+Labels follow --scheme:
+
+  letters    Exhibit A, Exhibit B, ..., Exhibit Z, Exhibit AA, ...
+  numbers    Exhibit 1, Exhibit 2, ...
+  prefixed   PX-0001, PX-0002, ... (see --prefix and --width)
+
+For example,
+
+  $ pdftool exhibit --scheme numbers --start 12 --cover decl.pdf contract.pdf
+
+writes decl-Exhibit_12.pdf and contract-Exhibit_13.pdf.`,
+	Options: exhibitFlags(),
+	Run:     exhibitRun,
+}
+
+// exhibitFlags returns the options of the exhibit operation
+func exhibitFlags() []option {
+	scheme, opts := utils.DefaultExhibitScheme(), utils.DefaultExhibitOptions()
+	return []option{
+		{Name: "scheme", Label: "Scheme", Usage: "labeling scheme (letters, numbers, prefixed)", Value: scheme.Style, Choices: []string{"letters", "numbers", "prefixed"}},
+		{Name: "start", Short: "n", Label: "Exhibit number", Usage: "number of the first exhibit (1 for A)", Kind: "int", Value: strconv.Itoa(scheme.Start), Aliases: []string{"number"}},
+		{Name: "caption", Label: "Caption", Usage: "word preceding letters and numbers", Value: scheme.Caption},
+		{Name: "prefix", Short: "p", Label: "Prefix", Usage: "prefix of prefixed labels", Value: scheme.Prefix},
+		{Name: "width", Short: "w", Label: "Width", Usage: "number of digits of prefixed labels", Kind: "int", Value: strconv.Itoa(scheme.Width)},
+		{Name: "label", Label: "Label (overrides the scheme)", Usage: "label of the exhibit, overriding the scheme"},
+		{Name: "all-pages", Label: "Label every page", Usage: "label every page rather than only the first", Kind: "bool", Value: "false", Aliases: []string{"allpages"}},
+		{Name: "cover", Label: "Insert a cover sheet", Usage: "insert a cover sheet before each exhibit", Kind: "bool", Value: "false"},
+		{Name: "position", Label: "Position", Usage: "position of the label (tl, tc, tr, l, c, r, bl, bc, br)", Value: opts.Style.Position, Choices: []string{"tl", "tc", "tr", "l", "c", "r", "bl", "bc", "br"}},
+		{Name: "font", Label: "Font", Usage: "font name", Value: opts.Style.FontName, Choices: []string{"Helvetica-Bold", "Helvetica", "Times-Bold", "Times-Roman", "Courier-Bold", "Courier"}},
+		{Name: "font-size", Label: "Size", Usage: "font size in points", Kind: "int", Value: strconv.Itoa(opts.Style.FontSize), Aliases: []string{"fontsize"}},
+		{Name: "color", Label: "Color", Usage: "text color", Kind: "color", Value: opts.Style.FillColor},
+	}
+}
+
+// exhibitRun labels rs as the nth exhibit of those given
+func exhibitRun(rs io.ReadSeeker, w io.Writer, name string, v optionValues, n int) (string, error) {
+	var err error
+	scheme := utils.DefaultExhibitScheme()
+	scheme.Style = v.String("scheme")
+	scheme.Caption = v.String("caption")
+	scheme.Prefix = v.String("prefix")
+	if scheme.Width, err = v.Int("width"); err != nil {
+		return "", err
+	}
+	if scheme.Start, err = v.Int("start"); err != nil {
+		return "", err
+	}
+	label := v.String("label")
+	if label == "" {
+		if label, err = scheme.Label(n); err != nil {
+			return "", err
+		}
+	}
+
+	opts := utils.DefaultExhibitOptions()
+	opts.AllPages = v.Bool("all-pages")
+	opts.Cover = v.Bool("cover")
+	opts.Style.Position = v.String("position")
+	opts.Style.FontName = v.String("font")
+	if opts.Style.FontSize, err = v.Int("font-size"); err != nil {
+		return "", err
+	}
+	opts.Style.FillColor = v.String("color")
+
+	log.Printf("Labeling as %s", label)
+	return "-" + strings.ReplaceAll(label, " ", "_"), utils.ExhibitStampRS(rs, w, label, opts)
+}
@@ -0,0 +1,340 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var jobQueue *utils.JobQueue
+var jobDir string
+var jobWorkers int
+var jobRetention time.Duration
+var jobMaxSize int64
+
+// job spool subdirectories
+const (
+	jobInputDir  = "in"
+	jobOutputDir = "stamped"
+)
+
+// maxFieldSize is the maximum size of a non-file form field of a job
+const maxFieldSize = 1 << 20
+
+// jobStatus is the JSON representation of a job
+type jobStatus struct {
+	utils.Job
+	URL       string `json:"url"`
+	ResultURL string `json:"result_url,omitempty"`
+}
+
+func newJobStatus(j utils.Job) jobStatus {
+	s := jobStatus{Job: j, URL: "/jobs/" + j.ID}
+	if j.State == utils.JobDone {
+		s.ResultURL = s.URL + "/result"
+	}
+	return s
+}
+
+// writeJSON replies with v as JSON
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// spoolJobInputs streams the multipart body of r into the spool
+// directory of job, keeping the files in the order they were given, and
+// returns the other form fields along with the original filenames
+func spoolJobInputs(w http.ResponseWriter, r *http.Request, job utils.Job) (url.Values, []string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, jobMaxSize)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, nil, &requestError{http.StatusUnsupportedMediaType, "unsupported_media_type", err}
+	}
+	in := filepath.Join(job.Dir, jobInputDir)
+	if err := os.Mkdir(in, 0o700); err != nil {
+		return nil, nil, err
+	}
+
+	form := url.Values{}
+	names := []string{}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, &requestError{http.StatusRequestEntityTooLarge, "too_large", err}
+		}
+		if part.FileName() == "" {
+			b, err := io.ReadAll(io.LimitReader(part, maxFieldSize))
+			if err != nil {
+				return nil, nil, &requestError{http.StatusBadRequest, "invalid_option", err}
+			}
+			form.Add(part.FormName(), string(b))
+			continue
+		}
+
+		f, err := os.Create(filepath.Join(in, fmt.Sprintf("%04d.pdf", len(names))))
+		if err != nil {
+			return nil, nil, err
+		}
+		_, err = io.Copy(f, part)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return nil, nil, &requestError{http.StatusRequestEntityTooLarge, "too_large", err}
+		}
+		names = append(names, filepath.Base(part.FileName()))
+	}
+	if len(names) == 0 {
+		return nil, nil, &requestError{http.StatusBadRequest, "missing_file", errors.New("no file uploaded")}
+	}
+	return form, names, nil
+}
+
+// batesJob returns the work of a Bates stamping job over the spooled
+// files originally named names, numbered continuously in their order.
+// The result is the stamped PDF, or a ZIP of them if there are several.
+func batesJob(r *http.Request, names []string) utils.JobFunc {
+	prefix := r.FormValue("prefix")
+	width, err := strconv.Atoi(r.FormValue("width"))
+	if err != nil {
+		width = 10
+	}
+	divider := r.FormValue("divider")
+	startno, err := strconv.ParseInt(r.FormValue("startno"), 10, 0)
+	if err != nil {
+		startno = 1
+	}
+	matter := r.FormValue("matter")
+	designation := r.FormValue("designation")
+	style := batesStyleFromForm(r)
+	user := requestUser(r)
+	remote := r.RemoteAddr
+
+	return func(dir string, progress func(float64)) (result string, err error) {
+		in := filepath.Join(dir, jobInputDir)
+		out := filepath.Join(dir, jobOutputDir)
+		if err := os.Mkdir(out, 0o700); err != nil {
+			return "", err
+		}
+
+		pageCounts := make([]int, len(names))
+		totalPages := int64(0)
+		for i := range names {
+			f, err := os.Open(filepath.Join(in, fmt.Sprintf("%04d.pdf", i)))
+			if err != nil {
+				return "", err
+			}
+			pageCounts[i], err = utils.PageCount(f)
+			f.Close()
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", names[i], err)
+			}
+			totalPages += int64(pageCounts[i])
+		}
+
+		fmtString := utils.GenerateFmtString(prefix, divider, width)
+		if matter != "" {
+			defaults := utils.Matter{Prefix: prefix, Separator: divider, Width: width}
+			m, issued, rerr := matterRegistry().Reserve(matter, 0, totalPages, defaults, user, strings.Join(names, ", "))
+			if rerr != nil {
+				return "", rerr
+			}
+			// the numbers of a job that fails are issued again
+			defer func() {
+				if err != nil {
+					releaseBates(m.Name, issued)
+				}
+			}()
+			startno = issued.Start
+			fmtString = m.FmtString()
+		}
+
+		results := make([]string, len(names))
+		for i, name := range names {
+			startBates := fmt.Sprintf(fmtString, startno)
+			stopBates := fmt.Sprintf(fmtString, startno+int64(pageCounts[i])-1)
+			results[i] = generateNewFilename(name, "-"+startBates+"-"+stopBates)
+			err := utils.BatesEndorse(
+				filepath.Join(in, fmt.Sprintf("%04d.pdf", i)),
+				filepath.Join(out, results[i]),
+				fmtString, startno, designation, style,
+			)
+			if err != nil {
+				return "", fmt.Errorf("%s: %w", name, err)
+			}
+			hash, err := utils.HashFile(filepath.Join(in, fmt.Sprintf("%04d.pdf", i)), sha256.New())
+			if err != nil {
+				return "", err
+			}
+			rec := utils.AuditRecord{
+				User:      user,
+				Remote:    remote,
+				Action:    "bates",
+				FileName:  name,
+				SHA256:    hash,
+				PageCount: pageCounts[i],
+				BegBates:  startBates,
+				EndBates:  stopBates,
+			}
+			if err := serverAuditLog().Append(rec); err != nil {
+				return "", fmt.Errorf("error writing audit log: %w", err)
+			}
+			countStamped(rec)
+			startno += int64(pageCounts[i])
+			progress(float64(i+1) / float64(len(names)+1))
+		}
+
+		if len(results) == 1 {
+			return filepath.Join(jobOutputDir, results[0]), nil
+		}
+		f, err := os.Create(filepath.Join(dir, "result.zip"))
+		if err != nil {
+			return "", err
+		}
+		defer f.Close()
+		if err := utils.ZipDirectory(f, out, ""); err != nil {
+			return "", err
+		}
+		return "result.zip", f.Close()
+	}
+}
+
+// userJob returns the job id if it was submitted by the user making r.
+// The jobs of other users are unknown to it.
+func userJob(r *http.Request, id string) (utils.Job, error) {
+	j, err := jobQueue.Job(id)
+	if err != nil {
+		return j, err
+	}
+	if j.User != requestUser(r) {
+		return utils.Job{}, fmt.Errorf("%w: %s", utils.ErrUnknownJob, id)
+	}
+	return j, nil
+}
+
+// jobsHandler serves the jobs of the user making the request:
+//
+//	GET    /jobs              list of jobs
+//	POST   /jobs/bates        submit a Bates stamping job
+//	GET    /jobs/{id}         status of a job
+//	GET    /jobs/{id}/result  result of a finished job
+//	DELETE /jobs/{id}         remove a job
+func jobsHandler(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/jobs"), "/"), "/")
+	switch {
+	case parts[0] == "" && r.Method == http.MethodGet:
+		jobs := []jobStatus{}
+		for _, j := range jobQueue.Jobs() {
+			if j.User == requestUser(r) {
+				jobs = append(jobs, newJobStatus(j))
+			}
+		}
+		writeJSON(w, http.StatusOK, jobs)
+	case len(parts) == 1 && parts[0] == "bates" && r.Method == http.MethodPost:
+		submitBatesJob(w, r)
+	case len(parts) == 1 && r.Method == http.MethodGet:
+		j, err := userJob(r, parts[0])
+		if err != nil {
+			apiError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, newJobStatus(j))
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if _, err := userJob(r, parts[0]); err != nil {
+			apiError(w, err)
+			return
+		}
+		if err := jobQueue.Remove(parts[0]); err != nil {
+			apiError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && parts[1] == "result" && r.Method == http.MethodGet:
+		if _, err := userJob(r, parts[0]); err != nil {
+			apiError(w, err)
+			return
+		}
+		path, err := jobQueue.ResultPath(parts[0])
+		if errors.Is(err, utils.ErrUnknownJob) {
+			apiError(w, err)
+			return
+		} else if err != nil {
+			apiError(w, &requestError{http.StatusConflict, "not_done", err})
+			return
+		}
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filepath.Base(path)))
+		http.ServeFile(w, r, path)
+	default:
+		apiError(w, &requestError{http.StatusNotFound, "not_found", fmt.Errorf("no route for %s %s", r.Method, r.URL.Path)})
+	}
+}
+
+func submitBatesJob(w http.ResponseWriter, r *http.Request) {
+	job, err := jobQueue.Create("bates", requestUser(r))
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	form, names, err := spoolJobInputs(w, r, job)
+	if err != nil {
+		jobQueue.Remove(job.ID)
+		apiError(w, err)
+		return
+	}
+	r.Form = form
+	log.Printf("Bates job %s: %d files", job.ID, len(names))
+	if err := jobQueue.Start(job.ID, batesJob(r, names)); err != nil {
+		apiError(w, &requestError{http.StatusServiceUnavailable, "unavailable", err})
+		return
+	}
+	job, err = jobQueue.Job(job.ID)
+	if err != nil {
+		apiError(w, err)
+		return
+	}
+	w.Header().Set("Location", "/jobs/"+job.ID)
+	writeJSON(w, http.StatusAccepted, newJobStatus(job))
+}
+
+// startJobQueue starts the job queue and registers its routes on mux
+func startJobQueue(mux *http.ServeMux) {
+	var err error
+	jobQueue, err = utils.NewJobQueue(jobDir, jobWorkers, jobRetention)
+	if err != nil {
+		log.Fatalf("Error starting job queue in `%s`\n%s\n", jobDir, err)
+	}
+	mux.HandleFunc("/jobs", jobsHandler)
+	mux.HandleFunc("/jobs/", jobsHandler)
+}
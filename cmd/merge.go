@@ -0,0 +1,153 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var mergeManifest string
+var mergeDuplex bool
+var mergeBates bool
+
+// mergeTitle returns the bookmark title of a merged document
+func mergeTitle(e utils.BinderEntry) string {
+	switch {
+	case e.Label != "" && e.Description != "":
+		return e.Label + ": " + e.Description
+	case e.Label != "":
+		return e.Label
+	case e.Description != "":
+		return e.Description
+	}
+	base := filepath.Base(e.Path)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+// mergeCmd represents the merge command
+var mergeCmd = &cobra.Command{
+	Use:   "merge outFile [inFile1 ...]",
+	Short: "Merge PDFs with bookmarks",
+	Long: `
+merge combines PDFs, in order, into outFile. Each document gets a
+bookmark named after its file, with the bookmarks it already has nested
+below it.
+
+The documents may also be given by a --manifest, as for the binder
+command; their bookmarks are then named "label: description", or
+whichever of the two is given. Entries with a slipsheet are merged as
+slip sheets (see the bates command), and images are converted as by the
+convert command, with its --page-size and --dpi flags.
+
+With --duplex, a blank page is added after each document ending on an
+odd page, so that each document starts on an odd page when printed
+double-sided.
+
+With --bates, the merged PDF is Bates stamped with continuous numbering
+(using the same flags and "bates" configuration as the bates command),
+and the range of each document is printed. Blank pages added by
+--duplex are numbered with the document before them.
+
+  $ pdftool merge --duplex --bates -p ABC merged.pdf motion.pdf decl.pdf`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		outFile := args[0]
+		entries := []utils.BinderEntry{}
+		if mergeManifest != "" {
+			entries = readManifest(mergeManifest)
+		}
+		for _, arg := range args[1:] {
+			entries = append(entries, utils.BinderEntry{Path: arg})
+		}
+		if len(entries) == 0 {
+			log.Fatal("no inFiles given. Give inFiles or --manifest")
+		}
+		_, err := os.Stat(outFile)
+		if !Overwrite && err == nil {
+			log.Fatalf("outFile `%s` already exists. To overwrite, use --force", outFile)
+		}
+
+		pageCounts, totalPages := entryPageCounts(entries)
+		if mergeDuplex {
+			for _, n := range pageCounts[:len(pageCounts)-1] {
+				totalPages += int64(n % 2)
+			}
+		}
+
+		opts := utils.MergeOptions{Duplex: mergeDuplex}
+		designations := loadDesignations()
+		docs := make([]io.ReadSeeker, len(entries))
+		for i, e := range entries {
+			docs[i] = bytes.NewReader(entryPDF(e))
+			opts.Titles = append(opts.Titles, mergeTitle(e))
+			opts.Designations = append(opts.Designations, designations.For(e.Path, designation))
+		}
+		if mergeBates {
+			opts.FmtString = utils.GenerateFmtString(prefix, separator, buffer)
+			opts.StartNo = startNo
+			if matterName != "" {
+				opts.FmtString, opts.StartNo = nextBates(cmd, totalPages)
+			}
+			opts.Style = batesStyle()
+		}
+
+		var out bytes.Buffer
+		merged, err := utils.MergeRS(docs, &out, opts)
+		if err != nil {
+			log.Fatalf("Error merging\n%s\n", err)
+		}
+		if err := os.WriteFile(outFile, out.Bytes(), 0o644); err != nil {
+			log.Fatalf("Error creating file `%s`\n%s\n", outFile, err)
+		}
+		for i, m := range merged {
+			if mergeBates {
+				log.Printf("%s: pages %d-%d, %s - %s", entries[i].Path, m.FirstPage, m.LastPage, m.BegBates, m.EndBates)
+			} else {
+				log.Printf("%s: pages %d-%d", entries[i].Path, m.FirstPage, m.LastPage)
+			}
+		}
+		if mergeBates && matterName != "" {
+			commitBates(opts.StartNo, totalPages, "merge "+filepath.Base(outFile), outFile)
+		}
+		log.Printf("Merged %d files (%d pages) into %s", len(entries), totalPages, outFile)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mergeCmd)
+
+	mergeCmd.Flags().StringVarP(&mergeManifest, "manifest", "m", "", "CSV or YAML file listing the documents")
+	mergeCmd.Flags().BoolVar(&mergeDuplex, "duplex", false, "start each document on an odd page")
+	mergeCmd.Flags().BoolVar(&mergeBates, "bates", false, "Bates stamp the merged PDF")
+	mergeCmd.Flags().StringVarP(&prefix, "prefix", "p", "Bates", "bates numbering prefix")
+	mergeCmd.Flags().StringVarP(&separator, "separator", "s", "-", "separator")
+	mergeCmd.Flags().IntVarP(&buffer, "width", "w", 8, "number of characters for number")
+	mergeCmd.Flags().Int64VarP(&startNo, "number", "n", 1, "number to start on")
+	mergeCmd.Flags().StringVar(&matterName, "matter", "", "continue the numbering of this matter (see `bates ranges`)")
+	mergeCmd.Flags().StringVar(&designation, "designation", "", "confidentiality designation to place on each page")
+	mergeCmd.Flags().StringVar(&designationMap, "designation-map", "", "CSV file of filename,designation records")
+	addConvertFlags(mergeCmd)
+	mergeCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output file (default: error on existing output file)")
+}
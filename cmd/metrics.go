@@ -0,0 +1,173 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+// serverMetrics are the metrics of the server, served at /metrics
+var serverMetrics utils.Metrics
+
+var (
+	requestsTotal = serverMetrics.Counter("pdftool_requests_total",
+		"HTTP requests served, by operation and status code.", "operation", "status")
+	requestDuration = serverMetrics.Histogram("pdftool_request_duration_seconds",
+		"Time taken to serve HTTP requests, by operation.", utils.DefaultBuckets, "operation")
+	requestsInFlight = serverMetrics.Gauge("pdftool_requests_in_flight",
+		"HTTP requests being served.")
+	requestBytes = serverMetrics.Counter("pdftool_request_bytes_total",
+		"Bytes received in HTTP request bodies, by operation.", "operation")
+	responseBytes = serverMetrics.Counter("pdftool_response_bytes_total",
+		"Bytes sent in HTTP response bodies, by operation.", "operation")
+	documentsStamped = serverMetrics.Counter("pdftool_documents_stamped_total",
+		"Documents processed, by action.", "action")
+	pagesStamped = serverMetrics.Counter("pdftool_pages_stamped_total",
+		"Pages of the documents processed, by action.", "action")
+	jobsGauge = serverMetrics.Gauge("pdftool_jobs",
+		"Jobs known to the job queue, by state.", "state")
+)
+
+// serverReady is 1 while the server accepts requests, and 0 before it
+// starts and once it shuts down
+var serverReady int32
+
+// countStamped records rec, a processed document, in the metrics
+func countStamped(rec utils.AuditRecord) {
+	documentsStamped.Inc(rec.Action)
+	pagesStamped.Add(float64(rec.PageCount), rec.Action)
+}
+
+// operationName returns the operation label of a request routed to the
+// mux pattern, e.g. "api/v1/bates" for /api/v1/bates
+func operationName(pattern string) string {
+	if op := strings.Trim(pattern, "/"); op != "" {
+		return op
+	}
+	return "index"
+}
+
+// metricsWriter records the status and size of a response
+type metricsWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *metricsWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *metricsWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read from a request body
+type countingReader struct {
+	io.ReadCloser
+	bytes int64
+}
+
+func (r *countingReader) Read(b []byte) (int, error) {
+	n, err := r.ReadCloser.Read(b)
+	r.bytes += int64(n)
+	return n, err
+}
+
+// withMetrics records the requests to next, labeled by the operation
+// they are routed to by mux
+func withMetrics(mux *http.ServeMux, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, pattern := mux.Handler(r)
+		op := operationName(pattern)
+		requestsInFlight.Add(1)
+		defer requestsInFlight.Add(-1)
+
+		start := time.Now()
+		mw := &metricsWriter{ResponseWriter: w}
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+		next.ServeHTTP(mw, r)
+		if mw.status == 0 {
+			mw.status = http.StatusOK
+		}
+
+		requestsTotal.Inc(op, strconv.Itoa(mw.status))
+		requestDuration.Observe(time.Since(start).Seconds(), op)
+		requestBytes.Add(float64(body.bytes), op)
+		responseBytes.Add(float64(mw.bytes), op)
+	})
+}
+
+// withHealth serves /healthz and /readyz, without authentication, and
+// passes other requests to next
+func withHealth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/healthz":
+			fmt.Fprintln(w, "ok")
+		case "/readyz":
+			if err := serverReadiness(); err != nil {
+				http.Error(w, err.Error(), http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprintln(w, "ok")
+		default:
+			next.ServeHTTP(w, r)
+		}
+	})
+}
+
+// serverReadiness returns why the server cannot take requests, if so
+func serverReadiness() error {
+	if atomic.LoadInt32(&serverReady) == 0 {
+		return fmt.Errorf("not serving")
+	}
+	if _, err := os.Stat(jobQueue.Dir); err != nil {
+		return fmt.Errorf("job directory unavailable: %s", err)
+	}
+	return nil
+}
+
+// metricsHandler serves the metrics in the Prometheus text format
+func metricsHandler(w http.ResponseWriter, r *http.Request) {
+	counts := map[utils.JobState]int{}
+	for _, j := range jobQueue.Jobs() {
+		counts[j.State]++
+	}
+	for _, state := range []utils.JobState{utils.JobPending, utils.JobQueued, utils.JobRunning, utils.JobDone, utils.JobFailed} {
+		jobsGauge.Set(float64(counts[state]), string(state))
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	serverMetrics.Write(w)
+}
@@ -0,0 +1,299 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+// option is an option of an operation, offered as a flag of its
+// command and as a field of its form
+type option struct {
+	Name    string   // flag and form field name, e.g. "font-size"
+	Short   string   // flag shorthand, if any
+	Label   string   // form label
+	Usage   string   // flag usage
+	Kind    string   // "string", "int", "float", "bool" or "color"
+	Value   string   // default
+	Choices []string // values allowed, if limited
+	Aliases []string // former form field names, still accepted
+}
+
+// clearable reports whether the option may be given empty, clearing its
+// default; other options left empty in a form take their default
+func (o option) clearable() bool {
+	return (o.Kind == "" || o.Kind == "string") && o.Choices == nil
+}
+
+// optionValues are the options given to an operation, by name
+type optionValues struct {
+	op    *operation
+	given map[string]string
+}
+
+// Given reports whether the option name was given
+func (v optionValues) Given(name string) bool {
+	_, ok := v.given[name]
+	return ok
+}
+
+// String returns the option name as given, or its default
+func (v optionValues) String(name string) string {
+	if s, ok := v.given[name]; ok {
+		return s
+	}
+	for _, o := range v.op.Options {
+		if o.Name == name {
+			return o.Value
+		}
+	}
+	panic(fmt.Sprintf("operation %s has no option %s", v.op.Name, name))
+}
+
+// Int returns the integer option name
+func (v optionValues) Int(name string) (int, error) {
+	i, err := strconv.Atoi(v.String(name))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s must be a whole number", utils.ErrInvalidOption, name)
+	}
+	return i, nil
+}
+
+// Float returns the number option name
+func (v optionValues) Float(name string) (float64, error) {
+	f, err := strconv.ParseFloat(v.String(name), 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %s must be a number", utils.ErrInvalidOption, name)
+	}
+	return f, nil
+}
+
+// Bool returns the on/off option name
+func (v optionValues) Bool(name string) bool {
+	s := v.String(name)
+	b, err := strconv.ParseBool(s)
+	if err != nil {
+		// a checkbox without a value sends "on"
+		return s == "on"
+	}
+	return b
+}
+
+// operation is a single-document operation. Each operation is offered as
+// a command, at /<name> on the server, and as a form of the web
+// interface, all with the same options.
+type operation struct {
+	Name    string // command name and route, e.g. "draft"
+	Title   string // heading of the form, e.g. "Draft Stamp"
+	Short   string
+	Long    string
+	Options []option
+
+	// Run processes the document rs, named name and the nth (from 0) of
+	// those given at once, and writes the result to w. It returns the
+	// suffix of the output filename.
+	Run func(rs io.ReadSeeker, w io.Writer, name string, v optionValues, n int) (suffix string, err error)
+
+	// Cmd and Handler are the command and handler of an operation that
+	// is not run document by document, such as Bates numbering, which
+	// continues across documents and matters. They stand in for those
+	// made from Run and Options, and its form is the template named
+	// after it.
+	Cmd     *cobra.Command
+	Handler http.HandlerFunc
+}
+
+// operations are the operations offered by the commands, the server and
+// its web interface
+var operations = append([]*operation{batesOperation}, append(presetOperations(), stampOperation, exhibitOperation, paginateOperation)...)
+
+// handler returns the handler of op
+func (op *operation) handler() http.HandlerFunc {
+	if op.Handler != nil {
+		return op.Handler
+	}
+	return operationHandler(op)
+}
+
+// operationNames returns the names of the operations run document by
+// document, e.g. "draft, copy and stamp"
+func operationNames() string {
+	names := []string{}
+	for _, op := range operations {
+		if op.Run != nil {
+			names = append(names, op.Name)
+		}
+	}
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
+
+// newOperationCmd returns the command running op on each of its arguments
+func newOperationCmd(op *operation) *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   op.Name + " inFile1 ...",
+		Short: op.Short,
+		Long:  op.Long,
+		Args:  cobra.MinimumNArgs(1),
+		Run: func(cmd *cobra.Command, args []string) {
+			v := optionValues{op, map[string]string{}}
+			for _, o := range op.Options {
+				if f := cmd.Flags().Lookup(o.Name); f.Changed {
+					v.given[o.Name] = f.Value.String()
+				}
+			}
+			for i, file := range args {
+				runOperationFile(op, file, v, i)
+			}
+		},
+	}
+	for _, o := range op.Options {
+		switch o.Kind {
+		case "int":
+			i, _ := strconv.Atoi(o.Value)
+			cmd.Flags().IntP(o.Name, o.Short, i, o.Usage)
+		case "float":
+			f, _ := strconv.ParseFloat(o.Value, 64)
+			cmd.Flags().Float64P(o.Name, o.Short, f, o.Usage)
+		case "bool":
+			b, _ := strconv.ParseBool(o.Value)
+			cmd.Flags().BoolP(o.Name, o.Short, b, o.Usage)
+		default:
+			cmd.Flags().StringP(o.Name, o.Short, o.Value, o.Usage)
+		}
+	}
+	addConvertFlags(cmd)
+	cmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output files (default: error on existing output files)")
+	return cmd
+}
+
+// runOperationFile runs op on file, the nth of those given, writing next
+// to it. Images are converted to PDF first.
+func runOperationFile(op *operation, file string, v optionValues, n int) {
+	var in io.ReadSeeker
+	outFile := file
+	if utils.IsImage(file) {
+		in = bytes.NewReader(imagePDF(file))
+		outFile = pdfFilename(file)
+	} else {
+		fIn, err := os.Open(file)
+		if err != nil {
+			log.Fatalf("inFile `%s` does not exist", file)
+		}
+		defer fIn.Close()
+		in = fIn
+	}
+
+	var out bytes.Buffer
+	suffix, err := op.Run(in, &out, filepath.Base(file), v, n)
+	if err != nil {
+		log.Fatalf("Error processing `%s`\n%s\n", file, err)
+	}
+
+	newFilename := generateNewFilename(outFile, suffix)
+	if _, err := os.Stat(newFilename); !Overwrite && err == nil {
+		log.Fatalf("outFile `%s` already exists. To overwrite, use --force", newFilename)
+	}
+	if err := os.WriteFile(newFilename, out.Bytes(), 0o644); err != nil {
+		log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
+	}
+	log.Printf("Wrote %s", newFilename)
+}
+
+// operationHandler returns the handler running op on the file uploaded
+// in the form field `file`, with options from the other fields
+func operationHandler(op *operation) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		log.Printf("%s processing.", op.Title)
+		if r.Method != "POST" {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, MAX_UPLOAD_SIZE)
+		if err := r.ParseMultipartForm(MAX_UPLOAD_SIZE); err != nil {
+			http.Error(w, "The uploaded file is too big. Please choose a file that's less than 50MB in size.", http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+
+		v := optionValues{op, map[string]string{}}
+		for _, o := range op.Options {
+			for _, name := range append([]string{o.Name}, o.Aliases...) {
+				values, ok := r.MultipartForm.Value[name]
+				if !ok || len(values) == 0 {
+					continue
+				}
+				if values[0] != "" || o.clearable() {
+					v.given[o.Name] = values[0]
+				}
+				break
+			}
+		}
+
+		var out bytes.Buffer
+		suffix, err := op.Run(file, &out, header.Filename, v, 0)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		pageCount, err := utils.PageCount(file)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		if err := auditDocument(r, op.Name, header.Filename, file, pageCount, "", ""); err != nil {
+			httpError(w, err)
+			return
+		}
+
+		w.Header().Add("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{
+			"filename": generateNewFilename(header.Filename, suffix),
+		}))
+		out.WriteTo(w)
+	}
+}
+
+func init() {
+	for _, op := range operations {
+		if op.Cmd != nil {
+			rootCmd.AddCommand(op.Cmd)
+			continue
+		}
+		rootCmd.AddCommand(newOperationCmd(op))
+	}
+}
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+// testPDF returns a one-page PDF of a blank image
+func testPDF(t *testing.T) []byte {
+	t.Helper()
+	var img bytes.Buffer
+	if err := png.Encode(&img, image.NewGray(image.Rect(0, 0, 10, 10))); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := utils.ImagesToPDF([]io.Reader{&img}, &b, utils.DefaultConvertOptions()); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+var (
+	formInput    = regexp.MustCompile(`<input[^>]*>`)
+	formSelect   = regexp.MustCompile(`(?s)<select[^>]*name=\s*"([^"]*)"[^>]*>(.*?)</select>`)
+	formSelected = regexp.MustCompile(`<option value="([^"]*)" selected>`)
+	formAttr     = regexp.MustCompile(`(\w+)=\s*"([^"]*)"`)
+)
+
+// formDefaults returns the fields the form of op on the index page posts
+// as rendered, but for its file
+func formDefaults(t *testing.T, op string) map[string]string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	indexHandler(rec, httptest.NewRequest("GET", "/", nil))
+	page := rec.Body.String()
+	loc := regexp.MustCompile(`action=\s*"/` + op + `"`).FindStringIndex(page)
+	if loc == nil {
+		t.Fatalf("index page has no form of %s", op)
+	}
+	form := page[loc[0] : loc[0]+strings.Index(page[loc[0]:], "</form>")]
+
+	fields := map[string]string{}
+	for _, input := range formInput.FindAllString(form, -1) {
+		attrs := map[string]string{}
+		for _, m := range formAttr.FindAllStringSubmatch(input, -1) {
+			attrs[m[1]] = m[2]
+		}
+		if attrs["type"] == "file" || attrs["type"] == "checkbox" {
+			continue
+		}
+		fields[attrs["name"]] = attrs["value"]
+	}
+	for _, m := range formSelect.FindAllStringSubmatch(form, -1) {
+		if s := formSelected.FindStringSubmatch(m[2]); s != nil {
+			fields[m[1]] = s[1]
+		}
+	}
+	return fields
+}
+
+func TestPresetForms(t *testing.T) {
+	pdf := testPDF(t)
+	for _, op := range presetOperations() {
+		t.Run(op.Name, func(t *testing.T) {
+			var body bytes.Buffer
+			mw := multipart.NewWriter(&body)
+			fw, err := mw.CreateFormFile("file", "in.pdf")
+			if err != nil {
+				t.Fatal(err)
+			}
+			fw.Write(pdf)
+			for name, value := range formDefaults(t, op.Name) {
+				mw.WriteField(name, value)
+			}
+			mw.Close()
+
+			r := httptest.NewRequest("POST", "/"+op.Name, &body)
+			r.Header.Set("Content-Type", mw.FormDataContentType())
+			rec := httptest.NewRecorder()
+			op.handler()(rec, r)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("POST /%s = %d %s", op.Name, rec.Code, rec.Body.String())
+			}
+			want := "in-" + strings.ToUpper(op.Name) + ".pdf"
+			if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, want) {
+				t.Errorf("Content-Disposition = %q, want filename %q", cd, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+// paginateTemplates are the template options of the paginate operation,
+// by position
+var paginateTemplates = []struct{ name, pos, label, usage string }{
+	{"header-left", "tl", "Header, left", "text at the top left"},
+	{"header-center", "tc", "Header, center", "text at the top center"},
+	{"header-right", "tr", "Header, right", "text at the top right"},
+	{"footer-left", "bl", "Footer, left", "text at the bottom left"},
+	{"footer-center", "bc", "Footer, center", "text at the bottom center"},
+	{"footer-right", "br", "Footer, right", "text at the bottom right"},
+}
+
+// paginateOperation adds page numbers and running headers and footers
+var paginateOperation = &operation{
+	Name:  "paginate",
+	Title: "Page Numbers",
+	Short: "Add page numbers and running headers and footers",
+	Long: `
+paginate adds text to the header and footer of every page, at any of
+six positions (--header-left, --header-center, --header-right,
+--footer-left, --footer-center and --footer-right). The text may
+contain the placeholders
+
+  {page}      the page number (see --first-page)
+  {pages}     the number of the last page
+  {filename}  the name of the PDF
+  {date}      the date (see --date)
+  {bates}     the Bates number of the page, numbered as given by any of
+              --prefix, --separator, --width and --number
+
+By default, the pages are numbered "Page {page} of {pages}" at the
+bottom center, unless --no-page-numbers is given. Percent signs are
+shown as given. For example,
+
+  $ pdftool paginate --header-right "Case No. 3:24-cv-01234 – Document 45" motion.pdf
+
+writes motion-PAGINATED.pdf.`,
+	Options: paginateFlags(),
+	Run:     paginateRun,
+}
+
+// paginateFlags returns the options of the paginate operation
+func paginateFlags() []option {
+	def := utils.DefaultPaginateOptions()
+	opts := []option{}
+	for _, t := range paginateTemplates {
+		opts = append(opts, option{Name: t.name, Label: t.label, Usage: t.usage, Value: def.Templates[t.pos]})
+	}
+	return append(opts, []option{
+		{Name: "no-page-numbers", Label: "No page numbers", Usage: "omit the default footer, \"" + def.Templates["bc"] + "\"", Kind: "bool", Value: "false"},
+		{Name: "first-page", Label: "First page number", Usage: "number of the first page", Kind: "int", Value: strconv.Itoa(def.FirstPage)},
+		{Name: "date", Label: "Date", Usage: "value of {date} (default: today)"},
+		{Name: "prefix", Short: "p", Label: "Bates prefix", Usage: "bates numbering prefix of {bates}", Value: "Bates"},
+		{Name: "separator", Short: "s", Label: "Bates separator", Usage: "separator of {bates}", Value: "-"},
+		{Name: "width", Short: "w", Label: "Bates width", Usage: "number of characters for number of {bates}", Kind: "int", Value: "8"},
+		{Name: "number", Short: "n", Label: "Bates number", Usage: "{bates} of the first page", Kind: "int", Value: "1"},
+		{Name: "font", Label: "Font", Usage: "font name", Value: def.Style.FontName, Choices: []string{"Helvetica", "Times-Roman", "Courier"}},
+		{Name: "font-size", Label: "Size", Usage: "font size in points", Kind: "int", Value: strconv.Itoa(def.Style.FontSize)},
+		{Name: "color", Label: "Color", Usage: "text color", Kind: "color", Value: def.Style.FillColor},
+		{Name: "suffix", Label: "Filename suffix", Usage: "output filename suffix", Value: "-PAGINATED"},
+	}...)
+}
+
+// paginateRun adds the headers and footers given by v to rs
+func paginateRun(rs io.ReadSeeker, w io.Writer, name string, v optionValues, n int) (string, error) {
+	var err error
+	opts := utils.DefaultPaginateOptions()
+	def := opts.Templates
+	opts.Templates = map[string]string{}
+	for _, t := range paginateTemplates {
+		opts.Templates[t.pos] = v.String(t.name)
+		if v.Bool("no-page-numbers") && opts.Templates[t.pos] == def[t.pos] {
+			opts.Templates[t.pos] = ""
+		}
+	}
+	if opts.FirstPage, err = v.Int("first-page"); err != nil {
+		return "", err
+	}
+	opts.FileName = name
+	opts.Date = v.String("date")
+	if opts.Date == "" {
+		opts.Date = time.Now().Format("January 2, 2006")
+	}
+	// {bates} is numbered only if a Bates option is given
+	if v.Given("prefix") || v.Given("separator") || v.Given("width") || v.Given("number") {
+		width, err := v.Int("width")
+		if err != nil {
+			return "", err
+		}
+		opts.FmtString = utils.GenerateFmtString(v.String("prefix"), v.String("separator"), width)
+		number, err := v.Int("number")
+		if err != nil {
+			return "", err
+		}
+		opts.StartNo = int64(number)
+	}
+	opts.Style.FontName = v.String("font")
+	if opts.Style.FontSize, err = v.Int("font-size"); err != nil {
+		return "", err
+	}
+	opts.Style.FillColor = v.String("color")
+
+	return v.String("suffix"), utils.PaginateRS(rs, w, opts)
+}
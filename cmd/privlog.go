@@ -0,0 +1,170 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var privlogManifest string
+var privlogRedactions []string
+var privlogOut string
+var privlogFormats []string
+var privlogOptions = utils.DefaultPrivilegeLogOptions()
+
+// privlogFilenames are the output filenames of each format, after the
+// --out path
+var privlogFilenames = map[string]string{
+	"csv":   ".csv",
+	"excel": "-excel.csv",
+	"pdf":   ".pdf",
+}
+
+// readPrivilegeManifest reads the entries of the manifest file, a CSV or
+// YAML privilege manifest
+func readPrivilegeManifest(manifest string) []utils.PrivilegeEntry {
+	f, err := os.Open(manifest)
+	if err != nil {
+		log.Fatalf("Error opening manifest `%s`\n%s\n", manifest, err)
+	}
+	defer f.Close()
+	entries, err := utils.ReadPrivilegeManifest(f, strings.TrimPrefix(filepath.Ext(manifest), "."))
+	if err != nil {
+		log.Fatalf("Error reading manifest `%s`\n%s\n", manifest, err)
+	}
+	return entries
+}
+
+// readRedactionLog reads the records of a redaction log file
+func readRedactionLog(file string) []utils.RedactionRecord {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("Error opening redaction log `%s`\n%s\n", file, err)
+	}
+	defer f.Close()
+	records, err := utils.ReadRedactionLog(f)
+	if err != nil {
+		log.Fatalf("Error reading redaction log `%s`\n%s\n", file, err)
+	}
+	return records
+}
+
+// privlogCmd represents the privlog command
+var privlogCmd = &cobra.Command{
+	Use:   "privlog",
+	Short: "Generate a privilege log of withheld and redacted documents",
+	Long: `
+privlog generates a privilege log of the documents withheld or produced
+with redactions. They are described by a --manifest, a CSV file with a
+header row or a YAML list, with the fields begbates, endbates, path,
+date, author, recipients, basis, description and treatment (each
+document needs a begbates or a path). For example,
+
+  begbates,endbates,date,author,recipients,basis,description
+  ABC-00000120,ABC-00000123,2021-03-02,J. Smith,K. Lee,Attorney-Client,Email re: contract terms
+
+and by the --redactions logs written by the redact command, matched to
+the documents of the manifest by their path or, failing that, by the
+Bates number naming their file (as the bates command names its
+outputs). Documents with redactions but no entry in the manifest are
+logged by path. Treatment defaults to "Redacted" for documents with
+redactions, with the labels of their regions as the basis, and
+"Withheld" otherwise, and the log lists the pages redacted by Bates
+number.
+
+Bates numbers are written in the format given by the --prefix,
+--separator and --width flags, as by the bates command, whatever their
+padding in the manifest. The log is written to the --out path as CSV
+(.csv), CSV for spreadsheets (-excel.csv: with a byte order mark and
+CRLF line endings, and fields starting with =, +, - or @ quoted with an
+apostrophe) and a PDF table (.pdf), or the given --format(s). Rows too
+tall for a page of the PDF table are continued on the next.
+
+  $ pdftool redact --regions regions.csv --log redactions.json ABC-00000200.pdf
+  $ pdftool privlog -m withheld.csv --redactions redactions.json -p ABC -o privlog`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		if privlogManifest == "" && len(privlogRedactions) == 0 {
+			log.Fatal("Nothing to log: give --manifest or --redactions")
+		}
+		entries := []utils.PrivilegeEntry{}
+		if privlogManifest != "" {
+			entries = readPrivilegeManifest(privlogManifest)
+		}
+		records := []utils.RedactionRecord{}
+		for _, file := range privlogRedactions {
+			records = append(records, readRedactionLog(file)...)
+		}
+		fmtString := utils.GenerateFmtString(prefix, separator, buffer)
+		privlog, err := utils.PrivilegeLog(entries, records, fmtString)
+		if err != nil {
+			if privlogManifest != "" {
+				log.Fatalf("Error reading manifest `%s`\n%s\n", privlogManifest, err)
+			}
+			log.Fatalf("Error reading redaction logs `%s`\n%s\n", strings.Join(privlogRedactions, "`, `"), err)
+		}
+
+		for _, format := range privlogFormats {
+			if _, ok := privlogFilenames[format]; !ok {
+				log.Fatalf("unknown format `%s` (expected csv, excel or pdf)", format)
+			}
+			newFilename := privlogOut + privlogFilenames[format]
+			if _, err := os.Stat(newFilename); !Overwrite && err == nil {
+				log.Fatalf("outFile `%s` already exists. To overwrite, use --force", newFilename)
+			}
+		}
+		for _, format := range privlogFormats {
+			newFilename := privlogOut + privlogFilenames[format]
+			var out bytes.Buffer
+			var err error
+			if format == "pdf" {
+				err = utils.PrivilegeLogPDF(&out, privlog, fmtString, privlogOptions)
+			} else {
+				err = utils.WritePrivilegeLogCSV(&out, privlog, fmtString, format == "excel")
+			}
+			if err != nil {
+				log.Fatalf("Error writing privilege log `%s`\n%s\n", newFilename, err)
+			}
+			if err := os.WriteFile(newFilename, out.Bytes(), 0o644); err != nil {
+				log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
+			}
+			log.Printf("Wrote %d entries to %s", len(privlog), newFilename)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(privlogCmd)
+
+	privlogCmd.Flags().StringVarP(&privlogManifest, "manifest", "m", "", "CSV or YAML file describing the withheld and redacted documents")
+	privlogCmd.Flags().StringSliceVar(&privlogRedactions, "redactions", nil, "redaction logs written by the redact command")
+	privlogCmd.Flags().StringVarP(&privlogOut, "out", "o", "privlog", "path of the output files without extension")
+	privlogCmd.Flags().StringSliceVar(&privlogFormats, "format", []string{"csv", "excel", "pdf"}, "formats to write (csv, excel, pdf)")
+	privlogCmd.Flags().StringVar(&privlogOptions.Title, "title", privlogOptions.Title, "heading of the PDF log")
+	privlogCmd.Flags().Float64Var(&privlogOptions.FontSize, "font-size", privlogOptions.FontSize, "font size of the PDF log in points")
+	privlogCmd.Flags().StringVarP(&prefix, "prefix", "p", "Bates", "bates numbering prefix")
+	privlogCmd.Flags().StringVarP(&separator, "separator", "s", "-", "separator")
+	privlogCmd.Flags().IntVarP(&buffer, "width", "w", 8, "number of characters for number")
+	privlogCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output files (default: error on existing output files)")
+}
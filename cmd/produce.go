@@ -0,0 +1,294 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var produceOutDir string
+var produceZip bool
+var produceVolume string
+var produceLoadFiles []string
+
+// volume subdirectories
+const (
+	nativesDir = "NATIVES"
+	imagesDir  = "IMAGES"
+	dataDir    = "DATA"
+)
+
+// manifestName is the name of the SHA-256 manifest in the volume root
+const manifestName = "MANIFEST.sha256"
+
+// isVolume reports whether dir holds nothing but what produce writes in
+// a volume, so that it may be replaced
+func isVolume(dir string) bool {
+	entries, err := os.ReadDir(dir)
+	if err != nil || len(entries) == 0 {
+		return false
+	}
+	for _, e := range entries {
+		switch e.Name() {
+		case nativesDir, imagesDir, dataDir:
+			if !e.IsDir() {
+				return false
+			}
+		case manifestName:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// collectFiles expands each directory in args into the PDFs, images and
+// natives it contains, in lexical order, leaving other arguments as they
+// are
+func collectFiles(args []string) []string {
+	files := []string{}
+	for _, arg := range args {
+		info, err := os.Stat(arg)
+		if err != nil {
+			log.Fatalf("inFile `%s` does not exist", arg)
+		}
+		if !info.IsDir() {
+			files = append(files, arg)
+			continue
+		}
+		err = filepath.WalkDir(arg, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && (strings.EqualFold(filepath.Ext(p), ".pdf") || utils.IsImage(p) || utils.IsNative(p)) {
+				files = append(files, p)
+			}
+			return nil
+		})
+		if err != nil {
+			log.Fatalf("Error reading directory `%s`\n%s\n", arg, err)
+		}
+	}
+	return files
+}
+
+// produceCmd represents the produce command
+var produceCmd = &cobra.Command{
+	Use:   "produce inFileOrDir1 ...",
+	Short: "Build a Bates-stamped production volume",
+	Long: `
+produce builds a production volume from a list of documents and/or
+directories of them. Every document is Bates stamped with continuous
+numbering, given by the --prefix, --separator, --width, --number and
+--matter flags as for the bates command, with the --designation and
+--designation-map flags for legends. The appearance of the stamp is that
+set in the "bates" section of the config file; produce has no flags for
+it, nor --scrub. The volume is laid out as
+
+  VOL001/
+    IMAGES/     stamped PDFs, named by their first Bates number
+    NATIVES/    native files
+    DATA/       load files (VOL001.dat, VOL001.opt, ...)
+    MANIFEST.sha256
+
+Images are converted to PDFs, as by the bates command. Natives
+(spreadsheets, presentations, documents, email, audio and video) are
+stamped as a placeholder page in IMAGES/ and copied to NATIVES/ named
+after their Bates number (e.g. ABCD_00001234.xlsx), their paths given in
+the NATIVEPATH column of the load files. Directories are searched for
+PDFs, images and natives by their extension.
+
+The manifest lists the SHA-256 hash of every file in the volume and
+can be checked with "sha256sum -c MANIFEST.sha256". With --zip, the
+volume is also packaged as VOL001.zip.
+
+For example,
+
+  $ pdftool produce -p ABCD -s _ --volume ABCD001 --zip ./collected
+
+writes ./ABCD001 and ./ABCD001.zip. The volume label names a directory
+of --out; with --force, an existing volume of that name is replaced,
+but not a directory holding anything else.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := checkLoadFileFormats(produceLoadFiles); err != nil {
+			log.Fatal(err)
+		}
+		files := collectFiles(args)
+		if len(files) == 0 {
+			log.Fatalf("no documents found in %s", strings.Join(args, ", "))
+		}
+		entries := make([]utils.BinderEntry, len(files))
+		for i, file := range files {
+			entries[i] = utils.BinderEntry{Path: file}
+		}
+
+		if err := utils.CheckVolumeLabel(produceVolume); err != nil {
+			log.Fatal(err)
+		}
+		volume := filepath.Join(produceOutDir, produceVolume)
+		zipFilename := volume + ".zip"
+		if _, err := os.Stat(zipFilename); produceZip && !Overwrite && err == nil {
+			log.Fatalf("outFile `%s` already exists. To overwrite, use --force", zipFilename)
+		}
+		if _, err := os.Stat(volume); err == nil {
+			if !Overwrite {
+				log.Fatalf("volume `%s` already exists. To overwrite, use --force", volume)
+			}
+			// only a previous volume is replaced, never another directory
+			if !isVolume(volume) {
+				log.Fatalf("`%s` is not a volume written by produce. Remove it or choose another --volume", volume)
+			}
+			if err := os.RemoveAll(volume); err != nil {
+				log.Fatalf("Error removing volume `%s`\n%s\n", volume, err)
+			}
+		}
+		for _, dir := range []string{nativesDir, imagesDir, dataDir} {
+			if err := os.MkdirAll(filepath.Join(volume, dir), 0o755); err != nil {
+				log.Fatalf("Error creating directory `%s`\n%s\n", dir, err)
+			}
+		}
+
+		xstartNo := startNo
+		fmtString := utils.GenerateFmtString(prefix, separator, buffer)
+		style := batesStyle()
+		designations := loadDesignations()
+		pageCounts, totalPages := entryPageCounts(entries)
+		if matterName != "" {
+			fmtString, xstartNo = nextBates(cmd, totalPages)
+		}
+		firstNo := xstartNo
+
+		docs := []utils.ProductionDocument{}
+		natives := utils.Natives{}
+		for i, e := range entries {
+			file := e.Path
+			begBates := fmt.Sprintf(fmtString, xstartNo)
+			newFilename := filepath.Join(volume, imagesDir, begBates+".pdf")
+			log.Printf("Producing %s as %s", file, begBates)
+			fOut, err := os.Create(newFilename)
+			if err != nil {
+				log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
+			}
+			err = utils.BatesEndorseRS(bytes.NewReader(entryPDF(e)), fOut, fmtString, xstartNo, designations.For(file, designation), style)
+			if err != nil {
+				log.Fatalf("Error stamping `%s`\n%s\n", file, err)
+			}
+			if err := fOut.Close(); err != nil {
+				log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
+			}
+			if isNative(file) {
+				// the native is renamed to its Bates number
+				nativeName := begBates + filepath.Ext(file)
+				copyNative(file, filepath.Join(volume, nativesDir, nativeName))
+				natives[begBates] = strings.Join([]string{produceVolume, nativesDir, nativeName}, `\`)
+				log.Printf("Copied native %s to %s", file, nativeName)
+			}
+			hash, err := utils.HashFile(file, md5.New())
+			if err != nil {
+				log.Fatalf("Error hashing file `%s`\n%s\n", file, err)
+			}
+			docs = append(docs, utils.ProductionDocument{
+				FmtString: fmtString,
+				StartNo:   xstartNo,
+				PageCount: pageCounts[i],
+				FileName:  filepath.Base(file),
+				Path:      strings.Join([]string{produceVolume, imagesDir, begBates + ".pdf"}, `\`),
+				MD5:       hash,
+			})
+			xstartNo += int64(pageCounts[i])
+		}
+
+		opts := utils.DATOptions{
+			Delimiter: utils.ParseDelimiter(datDelimiter),
+			Quote:     utils.ParseDelimiter(datQuote),
+			Newline:   utils.ParseDelimiter(datNewline),
+		}
+		base := filepath.Join(volume, dataDir, produceVolume)
+		if err := writeLoadFiles(base, produceLoadFiles, docs, natives, produceVolume, opts); err != nil {
+			log.Fatalf("Error writing load files\n%s\n", err)
+		}
+
+		hashes, err := utils.Manifest(volume)
+		if err != nil {
+			log.Fatalf("Error hashing volume `%s`\n%s\n", volume, err)
+		}
+		manifest, err := os.Create(filepath.Join(volume, manifestName))
+		if err != nil {
+			log.Fatalf("Error creating manifest\n%s\n", err)
+		}
+		defer manifest.Close()
+		if err := utils.WriteManifest(manifest, hashes); err != nil {
+			log.Fatalf("Error writing manifest\n%s\n", err)
+		}
+		if err := manifest.Close(); err != nil {
+			log.Fatalf("Error writing manifest\n%s\n", err)
+		}
+		if matterName != "" {
+			commitBates(firstNo, totalPages, "volume "+produceVolume, volume)
+		}
+		log.Printf(
+			"Produced %d documents (%s through %s) in %s",
+			len(docs),
+			docs[0].BegBates(),
+			docs[len(docs)-1].EndBates(),
+			volume,
+		)
+
+		if produceZip {
+			fOut, err := os.Create(zipFilename)
+			if err != nil {
+				log.Fatalf("Error creating file `%s`\n%s\n", zipFilename, err)
+			}
+			defer fOut.Close()
+			if err := utils.ZipDirectory(fOut, volume, produceVolume); err != nil {
+				log.Fatalf("Error writing `%s`\n%s\n", zipFilename, err)
+			}
+			log.Printf("Packaged volume as %s", zipFilename)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(produceCmd)
+
+	produceCmd.Flags().StringVarP(&produceOutDir, "out", "o", ".", "directory in which to create the volume")
+	produceCmd.Flags().StringVar(&produceVolume, "volume", "VOL001", "volume label")
+	produceCmd.Flags().BoolVar(&produceZip, "zip", false, "also package the volume as a ZIP file")
+	produceCmd.Flags().StringVarP(&prefix, "prefix", "p", "Bates", "bates numbering prefix")
+	produceCmd.Flags().StringVarP(&separator, "separator", "s", "-", "separator")
+	produceCmd.Flags().IntVarP(&buffer, "width", "w", 8, "number of characters for number")
+	produceCmd.Flags().Int64VarP(&startNo, "number", "n", 1, "number to start on")
+	produceCmd.Flags().StringVar(&matterName, "matter", "", "continue the numbering of this matter (see `bates ranges`)")
+	produceCmd.Flags().StringVar(&designation, "designation", "", "confidentiality designation to place on each page")
+	produceCmd.Flags().StringVar(&designationMap, "designation-map", "", "CSV file of filename,designation records")
+	produceCmd.Flags().StringSliceVar(&produceLoadFiles, "loadfile", []string{"dat", "opt"}, "load files to write (dat, opt, csv)")
+	produceCmd.Flags().StringVar(&datDelimiter, "dat-delimiter", `\x14`, "DAT field delimiter (Concordance ¶)")
+	produceCmd.Flags().StringVar(&datQuote, "dat-quote", "þ", "DAT field quote character")
+	produceCmd.Flags().StringVar(&datNewline, "dat-newline", "®", "DAT replacement for line breaks within a field")
+	produceCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output files (default: error on existing output files)")
+}
@@ -0,0 +1,115 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/user"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var registry *utils.MatterRegistry
+var registryOnce sync.Once
+
+// matterRegistry returns the matter registry shared by the commands and
+// the server. Its location is the `matters.registry` config key, or
+// .pdftool-matters.json next to the config file.
+func matterRegistry() *utils.MatterRegistry {
+	registryOnce.Do(func() {
+		path := viper.GetString("matters.registry")
+		if path == "" {
+			path = configSiblingPath(".pdftool-matters.json")
+		}
+		registry = utils.NewMatterRegistry(path)
+	})
+	return registry
+}
+
+// releaseBates returns to the matter the range issued for a request
+// that failed, so that it is issued again
+func releaseBates(matter string, issued utils.IssuedRange) {
+	if err := matterRegistry().Release(matter, issued); err != nil {
+		log.Printf("Error releasing bates numbers %d-%d of matter `%s`: %s", issued.Start, issued.Stop, matter, err)
+	}
+}
+
+// currentUser returns the login name of the user running pdftool
+func currentUser() string {
+	u, err := user.Current()
+	if err != nil {
+		return ""
+	}
+	return u.Username
+}
+
+// rangesCmd represents the bates ranges command
+var rangesCmd = &cobra.Command{
+	Use:   "ranges [matter]",
+	Short: "List the Bates ranges issued for a matter",
+	Long: `
+ranges lists the Bates ranges issued for a matter by
+"pdftool bates --matter". Without a matter, it lists all matters
+in the registry with the next Bates number to be issued.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		defer tw.Flush()
+
+		if len(args) == 0 {
+			matters, err := matterRegistry().Matters()
+			if err != nil {
+				log.Fatalf("Error reading matter registry\n%s\n", err)
+			}
+			fmt.Fprintln(tw, "MATTER\tNEXT\tRANGES")
+			for _, m := range matters {
+				fmt.Fprintf(tw, "%s\t%s\t%d\n", m.Name, fmt.Sprintf(m.FmtString(), m.NextNo), len(m.Ranges))
+			}
+			return
+		}
+
+		m, err := matterRegistry().Matter(args[0])
+		if err != nil {
+			log.Fatalf("Error reading matter registry\n%s\n", err)
+		}
+		fmtString := m.FmtString()
+		fmt.Fprintf(tw, "Matter:\t%s\n", m.Name)
+		fmt.Fprintf(tw, "Next:\t%s\n\n", fmt.Sprintf(fmtString, m.NextNo))
+		fmt.Fprintln(tw, "START\tSTOP\tISSUED\tUSER\tNOTE")
+		for _, r := range m.Ranges {
+			fmt.Fprintf(
+				tw,
+				"%s\t%s\t%s\t%s\t%s\n",
+				fmt.Sprintf(fmtString, r.Start),
+				fmt.Sprintf(fmtString, r.Stop),
+				r.Issued.Format("2006-01-02 15:04"),
+				r.User,
+				r.Note,
+			)
+		}
+	},
+}
+
+func init() {
+	batesCmd.AddCommand(rangesCmd)
+}
@@ -0,0 +1,193 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var redactRegions string
+var redactTerms []string
+var redactPatterns []string
+var redactLabel string
+var redactSuffix string
+var redactLog string
+
+// readRedactions reads the redaction regions of file, CSV or JSON by its
+// extension
+func readRedactions(file string) []utils.Redaction {
+	f, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("Error opening regions `%s`\n%s\n", file, err)
+	}
+	defer f.Close()
+	regions, err := utils.ReadRedactions(f, strings.TrimPrefix(filepath.Ext(file), "."))
+	if err != nil {
+		log.Fatalf("Error reading regions `%s`\n%s\n", file, err)
+	}
+	return regions
+}
+
+// printRedactions prints the regions redacted in file
+func printRedactions(file string, report []utils.RedactedRegion) {
+	if len(report) == 0 {
+		fmt.Printf("%s: nothing to redact\n", file)
+		return
+	}
+	fmt.Printf("%s: %d regions redacted\n", file, len(report))
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, r := range report {
+		fmt.Fprintf(tw, "  page %d\t%.1f,%.1f %.1fx%.1f\t%s\t%d chars, %d paths, %d images, %d annotations removed\n",
+			r.Page, r.X, r.Y, r.Width, r.Height, r.Match, r.Glyphs, r.Paths, r.Images, r.Annotations)
+	}
+	tw.Flush()
+}
+
+// logRedactions records the regions redacted from files in the redaction
+// log, replacing those of earlier runs on the same files
+func logRedactions(files []string, records []utils.RedactionRecord) {
+	logged := []utils.RedactionRecord{}
+	if f, err := os.Open(redactLog); err == nil {
+		logged, err = utils.ReadRedactionLog(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Error reading redaction log `%s`\n%s\n", redactLog, err)
+		}
+	}
+	redacted := map[string]bool{}
+	for _, file := range files {
+		redacted[file] = true
+	}
+	kept := []utils.RedactionRecord{}
+	for _, r := range logged {
+		if !redacted[r.File] {
+			kept = append(kept, r)
+		}
+	}
+
+	f, err := os.Create(redactLog)
+	if err != nil {
+		log.Fatalf("Error creating redaction log `%s`\n%s\n", redactLog, err)
+	}
+	defer f.Close()
+	if err := utils.WriteRedactionLog(f, append(kept, records...)); err != nil {
+		log.Fatalf("Error writing redaction log `%s`\n%s\n", redactLog, err)
+	}
+}
+
+// redactCmd represents the redact command
+var redactCmd = &cobra.Command{
+	Use:   "redact inFile1 ...",
+	Short: "Redact regions and search terms, removing the content below",
+	Long: `
+redact blacks out regions of PDF pages, and removes what lies under
+them: the text, vector graphics, images and annotations. Unlike a box
+drawn over the page, this leaves no text to select or extract. The
+regions are read from a CSV or JSON file:
+
+  $ cat regions.csv
+  page,x,y,width,height,label
+  3,72,540,250,14,REDACTED – PRIVILEGE
+  $ pdftool redact --regions regions.csv infile.pdf
+
+x and y are the lower left corner of a region, in points from the lower
+left corner of the page; the JSON file is a list of objects with the
+same keys. Text can also be found and redacted wherever it appears,
+ignoring case, or by regular expression:
+
+  $ pdftool redact --term "Smith" --regex '\d{3}-\d{2}-\d{4}' *.pdf
+
+Text in a font that does not map its characters to Unicode cannot be
+searched; such a PDF is an error rather than reported clean, and must be
+redacted by region.
+
+--label labels the regions found, and those of the file without a label
+of their own. Images under a region are blacked out, or removed whole
+if they cannot be decoded, and vector graphics crossing a region are
+removed but for filled rectangles, which are cut back. Afterwards the
+redacted PDF is read back to verify that no text remains under the
+boxes. It is written with the suffix "-REDACTED".
+
+--log records the regions redacted in a JSON redaction log, for the
+privilege log (see the privlog command). Records of earlier runs on
+other files are kept.
+
+  $ pdftool redact --term "Smith" --log redactions.json *.pdf`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		opts := utils.RedactOptions{Terms: redactTerms, Patterns: redactPatterns, Label: redactLabel}
+		if redactRegions != "" {
+			if len(args) > 1 {
+				log.Fatalf("--regions applies to a single inFile, not %d", len(args))
+			}
+			opts.Regions = readRedactions(redactRegions)
+		}
+		if len(opts.Regions) == 0 && len(opts.Terms) == 0 && len(opts.Patterns) == 0 {
+			log.Fatalf("Nothing to redact: give --regions, --term or --regex")
+		}
+
+		records := []utils.RedactionRecord{}
+		for _, file := range args {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatalf("inFile `%s` does not exist", file)
+			}
+			newFilename := generateNewFilename(file, redactSuffix)
+			if _, err := os.Stat(newFilename); !Overwrite && err == nil {
+				log.Fatalf("outFile `%s` already exists. To overwrite, use --force", newFilename)
+			}
+			var out bytes.Buffer
+			report, err := utils.RedactRS(bytes.NewReader(b), &out, opts)
+			if err != nil {
+				log.Fatalf("Error redacting `%s`\n%s\n", file, err)
+			}
+			if err := os.WriteFile(newFilename, out.Bytes(), 0o644); err != nil {
+				log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
+			}
+			printRedactions(file, report)
+			log.Printf("Wrote %s", newFilename)
+			for _, r := range report {
+				records = append(records, utils.RedactionRecord{File: file, RedactedRegion: r})
+			}
+		}
+		if redactLog != "" {
+			logRedactions(args, records)
+			log.Printf("Logged %d regions in %s", len(records), redactLog)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(redactCmd)
+
+	redactCmd.Flags().StringVar(&redactRegions, "regions", "", "CSV or JSON file of regions to redact")
+	redactCmd.Flags().StringArrayVar(&redactTerms, "term", nil, "text to redact wherever it appears, ignoring case (repeatable)")
+	redactCmd.Flags().StringArrayVar(&redactPatterns, "regex", nil, "regular expression of text to redact (repeatable)")
+	redactCmd.Flags().StringVar(&redactLabel, "label", "", "label of the regions without their own, e.g. \"REDACTED – PRIVILEGE\"")
+	redactCmd.Flags().StringVar(&redactLog, "log", "", "JSON redaction log to record the regions redacted in")
+	redactCmd.Flags().StringVar(&redactSuffix, "suffix", "-REDACTED", "output filename suffix")
+	redactCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output files (default: error on existing output files)")
+}
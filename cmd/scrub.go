@@ -0,0 +1,121 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var scrubCheck bool
+var scrubSuffix string
+
+// printFindings prints the metadata found in file
+func printFindings(file string, findings []utils.ScrubFinding, verb string) {
+	if len(findings) == 0 {
+		fmt.Printf("%s: no metadata %s\n", file, verb)
+		return
+	}
+	fmt.Printf("%s: %d items %s\n", file, len(findings), verb)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	for _, f := range findings {
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", f.Where, f.Kind, f.Detail)
+	}
+	tw.Flush()
+}
+
+// scrubCmd represents the scrub command
+var scrubCmd = &cobra.Command{
+	Use:   "scrub inFile1 ...",
+	Short: "Remove metadata from PDF files",
+	Long: `
+scrub removes metadata from PDFs before they are produced or filed:
+document information (author, creator, producer, title, subject,
+keywords and custom entries), XMP metadata, embedded thumbnails,
+application data, JavaScript, attached files, and comments and other
+annotations. Links and form fields are kept. It writes the scrubbed
+PDF with the suffix "-SCRUBBED" and reports what was removed.
+
+  $ pdftool scrub infile.pdf
+
+With --check, scrub writes nothing, reports the metadata found, and
+exits with status 1 if any was found, e.g. to verify a production:
+
+  $ pdftool scrub --check VOL001/IMAGES/*.pdf
+
+PDFs written by pdftool record pdfcpu as their producer and the time of
+writing as their creation and modification dates; --check does not
+report these.
+
+The bates and stamp commands also take --scrub, to scrub in the same
+pass.`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		dirty := 0
+		for _, file := range args {
+			b, err := os.ReadFile(file)
+			if err != nil {
+				log.Fatalf("inFile `%s` does not exist", file)
+			}
+
+			if scrubCheck {
+				findings, err := utils.ScrubCheckRS(bytes.NewReader(b))
+				if err != nil {
+					log.Fatalf("Error checking `%s`\n%s\n", file, err)
+				}
+				printFindings(file, findings, "found")
+				if len(findings) > 0 {
+					dirty++
+				}
+				continue
+			}
+
+			newFilename := generateNewFilename(file, scrubSuffix)
+			if _, err := os.Stat(newFilename); !Overwrite && err == nil {
+				log.Fatalf("outFile `%s` already exists. To overwrite, use --force", newFilename)
+			}
+			var out bytes.Buffer
+			findings, err := utils.ScrubRS(bytes.NewReader(b), &out)
+			if err != nil {
+				log.Fatalf("Error scrubbing `%s`\n%s\n", file, err)
+			}
+			if err := os.WriteFile(newFilename, out.Bytes(), 0o644); err != nil {
+				log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
+			}
+			printFindings(file, findings, "removed")
+			log.Printf("Wrote %s", newFilename)
+		}
+		if dirty > 0 {
+			log.Printf("%d of %d files contain metadata", dirty, len(args))
+			os.Exit(1)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(scrubCmd)
+
+	scrubCmd.Flags().BoolVar(&scrubCheck, "check", false, "only report metadata, exiting with status 1 if any is found")
+	scrubCmd.Flags().StringVar(&scrubSuffix, "suffix", "-SCRUBBED", "output filename suffix")
+	scrubCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output files (default: error on existing output files)")
+}
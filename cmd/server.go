@@ -16,15 +16,29 @@ limitations under the License.
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"fmt"
+	"html/template"
 	"io"
 	"log"
+	"mime/multipart"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync/atomic"
+	"syscall"
+	"time"
 
 	_ "embed"
 
 	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
 
 	"github.com/kjinho/pdftool/src/utils"
 )
@@ -39,13 +53,36 @@ var normalizeCSS string
 var skeletonCSS string
 
 var serverPort int
+var serverAddr string
+var serverSelfSigned bool
+var serverReadTimeout time.Duration
+var serverWriteTimeout time.Duration
+var serverIdleTimeout time.Duration
+var serverShutdownTimeout time.Duration
 
 const MAX_UPLOAD_SIZE = 1024 * 1024 * 50 // 50MB
 
+var indexTemplate = template.Must(template.New("index").Parse(indexFile))
+
+// indexPage is the data of indexTemplate: a form for each operation,
+// two to a row
+type indexPage struct {
+	Rows [][]*operation
+}
+
 func indexHandler(w http.ResponseWriter, r *http.Request) {
+	page := indexPage{}
+	for i := 0; i < len(operations); i += 2 {
+		end := i + 2
+		if end > len(operations) {
+			end = len(operations)
+		}
+		page.Rows = append(page.Rows, operations[i:end])
+	}
 	w.Header().Add("Content-Type", "text/html")
-	fmt.Fprint(w, indexFile)
-	//http.ServeFile(w, r, "assets/index.html")
+	if err := indexTemplate.Execute(w, page); err != nil {
+		log.Printf("Error: %s", err)
+	}
 }
 
 func normalizeCSSHanlder(w http.ResponseWriter, r *http.Request) {
@@ -58,6 +95,29 @@ func skeletonCSSHanlder(w http.ResponseWriter, r *http.Request) {
 	fmt.Fprint(w, skeletonCSS)
 }
 
+// errorStatus returns the HTTP status code for an error processing a PDF
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, utils.ErrNotPDF), errors.Is(err, utils.ErrNotImage):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, utils.ErrEncrypted), errors.Is(err, utils.ErrCorrupt):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, utils.ErrPageOutOfRange), errors.Is(err, utils.ErrInvalidOption):
+		return http.StatusBadRequest
+	case errors.Is(err, utils.ErrRangeOverlap):
+		return http.StatusConflict
+	case errors.Is(err, utils.ErrUnknownMatter), errors.Is(err, utils.ErrUnknownJob):
+		return http.StatusNotFound
+	}
+	return http.StatusInternalServerError
+}
+
+// httpError logs err and replies to the request with its status code
+func httpError(w http.ResponseWriter, err error) {
+	log.Printf("Error: %s", err)
+	http.Error(w, err.Error(), errorStatus(err))
+}
+
 func batesHandler(w http.ResponseWriter, r *http.Request) {
 	log.Println("Bates stamp processing.")
 	if r.Method != "POST" {
@@ -71,9 +131,16 @@ func batesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Several files, or a ZIP file of them, are numbered continuously
+	// and returned as a ZIP file
+	if headers := r.MultipartForm.File["file"]; len(headers) > 1 || (len(headers) == 1 && isZip(headers[0])) {
+		batesBatchHandler(w, r, headers)
+		return
+	}
+
 	// The argument to FormFile must match the name attribute
 	// of the file input on the frontend
-	file, _, err := r.FormFile("file")
+	file, header, err := r.FormFile("file")
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
@@ -100,73 +167,214 @@ func batesHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("File: %s", file)
-	prefix := r.FormValue("prefix")
+	prefix, divider, width, startno := batesNumberingFromForm(r)
+	style := batesStyleFromForm(r)
+	log.Printf("Style: %s", style.Description())
+	fmtString := utils.GenerateFmtString(prefix, divider, width)
+
+	pageCount, err := utils.PageCount(file)
+	if err != nil {
+		httpError(w, err)
+		return
+	}
+	served := false
+	if matter := r.FormValue("matter"); matter != "" {
+		defaults := utils.Matter{Prefix: prefix, Separator: divider, Width: width}
+		m, issued, err := matterRegistry().Reserve(matter, 0, int64(pageCount), defaults, requestUser(r), header.Filename)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		defer func() {
+			if !served {
+				releaseBates(m.Name, issued)
+			}
+		}()
+		startno = issued.Start
+		fmtString = m.FmtString()
+		log.Printf("Matter: %s (%d-%d)", m.Name, issued.Start, issued.Stop)
+	}
+
+	designation := r.FormValue("designation")
+	log.Printf("Designation: %s", designation)
+
+	var out bytes.Buffer
+	if err := utils.BatesEndorseRS(file, &out, fmtString, startno, designation, style); err != nil {
+		httpError(w, err)
+		return
+	}
+	begBates := fmt.Sprintf(fmtString, startno)
+	endBates := fmt.Sprintf(fmtString, startno+int64(pageCount)-1)
+	if err := auditDocument(r, "bates", header.Filename, file, pageCount, begBates, endBates); err != nil {
+		httpError(w, err)
+		return
+	}
+
+	served = true
+	w.Header().Add("Content-Type", "application/pdf")
+	out.WriteTo(w)
+}
+
+// batesNumberingFromForm returns the Bates numbering requested in the
+// form of r
+func batesNumberingFromForm(r *http.Request) (prefix string, divider string, width int, startno int64) {
+	prefix = r.FormValue("prefix")
 	log.Printf("Prefix: %s", prefix)
-	widthString := r.FormValue("width")
-	width, err := strconv.ParseInt(widthString, 10, 0)
+	width, err := strconv.Atoi(r.FormValue("width"))
 	if err != nil {
 		width = 10
 	}
 	log.Printf("Width: %d", width)
-	divider := r.FormValue("divider")
+	divider = r.FormValue("divider")
 	log.Printf("Divider: %s", divider)
-	startnoString := r.FormValue("startno")
-	startno, err := strconv.ParseInt(startnoString, 10, 0)
+	startno, err = strconv.ParseInt(r.FormValue("startno"), 10, 0)
 	if err != nil {
 		startno = 1
 	}
 	log.Printf("Start Number: %d", startno)
-
-	w.Header().Add("Content-Type", "application/pdf")
-
-	utils.BatesStampRS(file, w, utils.GenerateFmtString(prefix, divider, int(width)), startno)
+	return prefix, divider, width, startno
 }
 
-func draftHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("Draft stamp processing.")
-	if r.Method != "POST" {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-		return
+// isZip reports whether the uploaded file is a ZIP file
+func isZip(header *multipart.FileHeader) bool {
+	switch header.Header.Get("Content-Type") {
+	case "application/zip", "application/x-zip-compressed":
+		return true
 	}
+	return strings.EqualFold(filepath.Ext(header.Filename), ".zip")
+}
 
-	r.Body = http.MaxBytesReader(w, r.Body, MAX_UPLOAD_SIZE)
-	if err := r.ParseMultipartForm(MAX_UPLOAD_SIZE); err != nil {
-		http.Error(w, "The uploaded file is too big. Please choose a file that's less than 50MB in size.", http.StatusBadRequest)
-		return
+// maxUnzippedSize is the maximum total size of the PDFs in uploaded ZIP
+// files
+const maxUnzippedSize = 4 * MAX_UPLOAD_SIZE
+
+// batesBatchHandler Bates stamps the uploaded files, in the order given
+// by the `order` field, with continuous numbering, and replies with a
+// ZIP file of the stamped PDFs and a CSV index
+func batesBatchHandler(w http.ResponseWriter, r *http.Request, headers []*multipart.FileHeader) {
+	docs := []utils.BatchDocument{}
+	for _, header := range headers {
+		f, err := header.Open()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		b, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if !isZip(header) {
+			docs = append(docs, utils.BatchDocument{Name: filepath.Base(header.Filename), Data: b})
+			continue
+		}
+		zipped, err := utils.ReadZipBatch(bytes.NewReader(b), int64(len(b)), maxUnzippedSize)
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		docs = append(docs, zipped...)
 	}
-
-	// The argument to FormFile must match the name attribute
-	// of the file input on the frontend
-	file, _, err := r.FormFile("file")
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if len(docs) == 0 {
+		http.Error(w, "No PDFs were uploaded.", http.StatusBadRequest)
 		return
 	}
-	defer file.Close()
-	buff := make([]byte, 512)
-	_, err = file.Read(buff)
+	docs, err := utils.OrderBatch(docs, utils.ParseOrder(r.FormValue("order")))
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		httpError(w, err)
 		return
 	}
-
-	filetype := http.DetectContentType(buff)
-	if filetype != "application/pdf" {
-		http.Error(w, "The provided file format is not allowed. Please upload a PDF.", http.StatusBadRequest)
-		return
+	log.Printf("Files: %d", len(docs))
+
+	prefix, divider, width, startno := batesNumberingFromForm(r)
+	style := batesStyleFromForm(r)
+	fmtString := utils.GenerateFmtString(prefix, divider, width)
+
+	served := false
+	if matter := r.FormValue("matter"); matter != "" {
+		totalPages := int64(0)
+		names := []string{}
+		for _, d := range docs {
+			pageCount, err := utils.PageCount(bytes.NewReader(d.Data))
+			if err != nil {
+				httpError(w, fmt.Errorf("%s: %w", d.Name, err))
+				return
+			}
+			totalPages += int64(pageCount)
+			names = append(names, d.Name)
+		}
+		defaults := utils.Matter{Prefix: prefix, Separator: divider, Width: width}
+		m, issued, err := matterRegistry().Reserve(matter, 0, totalPages, defaults, requestUser(r), strings.Join(names, ", "))
+		if err != nil {
+			httpError(w, err)
+			return
+		}
+		defer func() {
+			if !served {
+				releaseBates(m.Name, issued)
+			}
+		}()
+		startno = issued.Start
+		fmtString = m.FmtString()
+		log.Printf("Matter: %s (%d-%d)", m.Name, issued.Start, issued.Stop)
 	}
 
-	_, err = file.Seek(0, io.SeekStart)
+	var out bytes.Buffer
+	stamped, err := utils.BatesEndorseBatch(docs, &out, fmtString, startno, r.FormValue("designation"), style)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		httpError(w, err)
 		return
 	}
+	for i, d := range stamped {
+		if err := auditDocument(r, "bates", d.FileName, bytes.NewReader(docs[i].Data), d.PageCount, d.BegBates(), d.EndBates()); err != nil {
+			httpError(w, err)
+			return
+		}
+	}
 
-	log.Printf("File: %s", file)
-
-	w.Header().Add("Content-Type", "application/pdf")
+	served = true
+	zipName := stamped[0].BegBates() + "-" + stamped[len(stamped)-1].EndBates() + ".zip"
+	w.Header().Add("Content-Type", "application/zip")
+	w.Header().Add("Content-Disposition", fmt.Sprintf("attachment; filename=%q", zipName))
+	out.WriteTo(w)
+}
 
-	utils.DraftStampRS(file, w)
+// batesStyleFromForm returns the Bates endorsement style requested in the
+// form, using the configured style for any field left blank.
+func batesStyleFromForm(r *http.Request) utils.BatesStyle {
+	style := batesStyle()
+	if v := r.FormValue("position"); v != "" {
+		style.Position = v
+	}
+	if v := r.FormValue("font"); v != "" {
+		style.FontName = v
+	}
+	if v, err := strconv.Atoi(r.FormValue("fontsize")); err == nil {
+		style.FontSize = v
+	}
+	if v := r.FormValue("color"); v != "" {
+		style.FillColor = v
+	}
+	if v := r.FormValue("bgcolor"); v != "" {
+		style.BgColor = v
+	}
+	if r.FormValue("transparent") != "" {
+		style.BgColor = ""
+	}
+	if v, err := strconv.Atoi(r.FormValue("border")); err == nil {
+		style.BorderWidth = v
+	}
+	if v := r.FormValue("bordercolor"); v != "" {
+		style.BorderColor = v
+	}
+	if v, err := strconv.ParseFloat(r.FormValue("marginx"), 64); err == nil {
+		style.MarginX = v
+	}
+	if v, err := strconv.ParseFloat(r.FormValue("marginy"), 64); err == nil {
+		style.MarginY = v
+	}
+	return style
 }
 
 // serverCmd represents the server command
@@ -176,24 +384,183 @@ var serverCmd = &cobra.Command{
 	Long: `
 server provides an HTTP service to process PDF files through
 an HTML interface. Use a web browser to access the service. The
-service processes the files in memory without saving anything
-to disk, so there is a maximum file size of ` + fmt.Sprintf("%d", MAX_UPLOAD_SIZE) + ` bytes.
+service processes the files in memory, so there is a maximum file
+size of ` + fmt.Sprintf("%d", MAX_UPLOAD_SIZE) + ` bytes. It saves nothing of them to disk but
+the files and results of jobs, spooled to --job-dir until they expire
+(see --job-retention) or the server shuts down, and the record of each
+in the audit log (see --audit-log).
+
+Each of the commands ` + operationNames() + ` is
+also served at /<command>, taking the uploaded file as "file" and its
+flags as form fields of the same names, e.g. "font-size".
+
+The same operations are available to programs as a JSON API under
+` + apiPrefix + `, described by ` + apiPrefix + `/openapi.json.
+
+Large or batch uploads may be submitted as jobs to /jobs/bates, which
+spools the files to a new directory in --job-dir, removed on shutdown,
+and returns a job ID at once. The status of the job is at /jobs/{id}
+and, once it is done, the result (a PDF, or a ZIP of PDFs) at
+/jobs/{id}/result. Each user sees only the jobs they submitted.
+
+With --auth, every request must be authenticated, either by an API
+token (token; tokens are listed in the config file), by HTTP basic
+authentication against a users file of bcrypt hashes (basic; see
+"pdftool server adduser"), or by a trusted reverse proxy naming the
+user in a header (proxy). For example,
+
+  server:
+    auth: token
+    tokens:
+      - user: alice
+        token: 3f9a1c...
+      - user: dms
+        token: 77be02...
+
+Every document processed is recorded, with its user, its filename and
+its hash, in an append-only audit log on disk, which may be queried with
+"pdftool audit".
+
+The server listens on all interfaces unless --addr is given. It
+serves HTTPS with --tls-cert and --tls-key, or, on a LAN, with a
+self-signed certificate generated by --self-signed. On SIGINT or
+SIGTERM it stops accepting requests and waits for the requests and
+jobs in progress to finish.
+
+For monitoring, /healthz reports that the server is up and /readyz
+that it accepts requests, both without authentication, and /metrics
+serves request, page and job counts in the Prometheus text format.
 `,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Printf("Starting server on http://%s:%d.\nPress ctrl-c to quit.\n", "localhost", serverPort)
 		mux := http.NewServeMux()
 		mux.HandleFunc("/", indexHandler)
 		mux.HandleFunc("/skeleton.css", skeletonCSSHanlder)
 		mux.HandleFunc("/normalize.css", normalizeCSSHanlder)
-		mux.HandleFunc("/bates", batesHandler)
-		mux.HandleFunc("/draft", draftHandler)
+		for _, op := range operations {
+			mux.HandleFunc("/"+op.Name, op.handler())
+		}
+		mux.HandleFunc("/metrics", metricsHandler)
+		addAPIRoutes(mux)
+		startJobQueue(mux)
+
+		var handler http.Handler = mux
+		auth, err := serverAuthenticator()
+		if err != nil {
+			log.Fatalf("Error setting up authentication\n%s\n", err)
+		}
+		if auth != nil {
+			handler = withAuth(auth, mux)
+		} else {
+			log.Printf("Warning: the server does not authenticate its users. See --auth.")
+		}
+		log.Printf("Audit log: %s", serverAuditLog().Path)
+		handler = withHealth(withMetrics(mux, handler))
 
-		if err := http.ListenAndServe(fmt.Sprintf(":%d", serverPort), mux); err != nil {
+		if err := serve(handler); err != nil {
 			log.Fatal(err)
 		}
 	},
 }
 
+// serverTLSFiles returns the certificate and key files to serve with,
+// or empty strings to serve plain HTTP. With --self-signed, a missing
+// certificate is generated.
+func serverTLSFiles() (certFile string, keyFile string, err error) {
+	certFile, keyFile = viper.GetString("server.tls.cert"), viper.GetString("server.tls.key")
+	if !serverSelfSigned {
+		if (certFile == "") != (keyFile == "") {
+			return "", "", errors.New("--tls-cert and --tls-key must be given together")
+		}
+		return certFile, keyFile, nil
+	}
+	if certFile == "" {
+		certFile = configSiblingPath(".pdftool-cert.pem")
+	}
+	if keyFile == "" {
+		keyFile = configSiblingPath(".pdftool-key.pem")
+	}
+	if _, err := os.Stat(certFile); err == nil {
+		return certFile, keyFile, nil
+	}
+
+	hostname, _ := os.Hostname()
+	hosts := utils.LocalHosts(hostname)
+	if serverAddr != "" {
+		hosts = append(hosts, serverAddr)
+	}
+	certPEM, keyPEM, err := utils.SelfSignedCert(hosts, 5*365*24*time.Hour)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0o644); err != nil {
+		return "", "", err
+	}
+	log.Printf("Generated a self-signed certificate for %s in %s", strings.Join(hosts, ", "), certFile)
+	return certFile, keyFile, nil
+}
+
+// serve serves handler until SIGINT or SIGTERM, then stops accepting
+// connections and waits for the requests and jobs in progress, for at
+// most --shutdown-timeout
+func serve(handler http.Handler) error {
+	certFile, keyFile, err := serverTLSFiles()
+	if err != nil {
+		return fmt.Errorf("Error setting up TLS\n%s", err)
+	}
+	srv := &http.Server{
+		Addr:              net.JoinHostPort(serverAddr, strconv.Itoa(serverPort)),
+		Handler:           handler,
+		ReadHeaderTimeout: 10 * time.Second,
+		ReadTimeout:       serverReadTimeout,
+		WriteTimeout:      serverWriteTimeout,
+		IdleTimeout:       serverIdleTimeout,
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	failed := make(chan error, 1)
+	go func() {
+		if certFile != "" {
+			failed <- srv.ListenAndServeTLS(certFile, keyFile)
+		} else {
+			failed <- srv.ListenAndServe()
+		}
+	}()
+
+	scheme, host := "http", serverAddr
+	if certFile != "" {
+		scheme = "https"
+	}
+	if host == "" {
+		host = "localhost"
+	}
+	atomic.StoreInt32(&serverReady, 1)
+	log.Printf("Starting server on %s://%s.\nPress ctrl-c to quit.\n", scheme, net.JoinHostPort(host, strconv.Itoa(serverPort)))
+
+	select {
+	case err := <-failed:
+		jobQueue.Close()
+		return err
+	case <-ctx.Done():
+	}
+	stop()
+	atomic.StoreInt32(&serverReady, 0)
+	log.Printf("Shutting down, waiting up to %s for requests in progress and queued or running jobs. Press ctrl-c again to quit now.", serverShutdownTimeout)
+	ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return fmt.Errorf("requests still in progress: %s", err)
+	}
+	if err := jobQueue.Shutdown(ctx); err != nil {
+		return fmt.Errorf("jobs still running: %s", err)
+	}
+	log.Printf("Server stopped.")
+	return nil
+}
+
 func init() {
 	rootCmd.AddCommand(serverCmd)
 
@@ -207,4 +574,18 @@ func init() {
 	// is called directly, e.g.:
 	// serverCmd.Flags().BoolP("toggle", "t", false, "Help message for toggle")
 	serverCmd.Flags().IntVarP(&serverPort, "port", "p", 8080, "port for access")
+	serverCmd.Flags().StringVar(&serverAddr, "addr", "", "address to listen on (default all interfaces)")
+	serverCmd.Flags().String("tls-cert", "", "certificate file to serve HTTPS with")
+	serverCmd.Flags().String("tls-key", "", "key file of --tls-cert")
+	serverCmd.Flags().BoolVar(&serverSelfSigned, "self-signed", false, "serve HTTPS with a self-signed certificate, generated next to the config file unless --tls-cert and --tls-key are given")
+	viper.BindPFlag("server.tls.cert", serverCmd.Flags().Lookup("tls-cert"))
+	viper.BindPFlag("server.tls.key", serverCmd.Flags().Lookup("tls-key"))
+	serverCmd.Flags().DurationVar(&serverReadTimeout, "read-timeout", 10*time.Minute, "maximum time to read a request, including uploads (0 for none)")
+	serverCmd.Flags().DurationVar(&serverWriteTimeout, "write-timeout", 10*time.Minute, "maximum time to process a request and write the response (0 for none)")
+	serverCmd.Flags().DurationVar(&serverIdleTimeout, "idle-timeout", 2*time.Minute, "how long idle connections are kept open")
+	serverCmd.Flags().DurationVar(&serverShutdownTimeout, "shutdown-timeout", time.Minute, "how long to wait on shutdown for requests in progress and queued or running jobs")
+	serverCmd.Flags().StringVar(&jobDir, "job-dir", os.TempDir(), "directory in which to create the job spool directory, removed on shutdown")
+	serverCmd.Flags().IntVar(&jobWorkers, "job-workers", 2, "number of jobs run at once")
+	serverCmd.Flags().DurationVar(&jobRetention, "job-retention", 24*time.Hour, "how long finished jobs are kept")
+	serverCmd.Flags().Int64Var(&jobMaxSize, "job-max-size", 2<<30, "maximum upload size of a job in bytes")
 }
@@ -0,0 +1,277 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+var splitPages string
+var splitBookmarks bool
+var splitMaxSize float64
+var splitBates string
+var splitLoadFile string
+var splitOutDir string
+
+// splitPart is a range of pages split into a file of its own
+type splitPart struct {
+	utils.PageRange
+	name string // of the file, without extension
+	pdf  []byte
+}
+
+// unsafeFilename matches runs of characters left out of filenames made
+// from bookmark titles
+var unsafeFilename = regexp.MustCompile(`[^A-Za-z0-9._ -]+`)
+
+// titleSuffix returns a filename suffix for a bookmark title
+func titleSuffix(title string) string {
+	s := strings.TrimSpace(unsafeFilename.ReplaceAllString(title, "_"))
+	if len(s) > 60 {
+		s = strings.TrimSpace(s[:60])
+	}
+	if s == "" {
+		return ""
+	}
+	return "-" + s
+}
+
+// splitBatesStart returns the Bates number of the first page of file, of
+// count pages, from the document recorded for it in --load-file or else
+// from its filename, and the part of its name before the number
+func splitBatesStart(file string, fmtString string, count int) (int64, string, error) {
+	base := filepath.Base(file)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	numbers, err := utils.FindBates(fmtString, stem)
+	if err != nil {
+		return 0, "", err
+	}
+	lead := stem + "-"
+	if len(numbers) > 0 {
+		// a number found but written otherwise than by fmtString, e.g.
+		// with more leading zeros, leaves nothing to name the parts by
+		i := strings.Index(stem, fmt.Sprintf(fmtString, numbers[0]))
+		if i < 0 {
+			return 0, "", fmt.Errorf("the Bates number in the name of `%s` is not written as %s. Give the --prefix, --separator and --width it was stamped with", file, fmt.Sprintf(fmtString, numbers[0]))
+		}
+		lead = stem[:i]
+	}
+
+	if splitLoadFile == "" {
+		if len(numbers) == 0 {
+			return 0, "", fmt.Errorf("no Bates number like %s in the name of `%s`. Give its --load-file, or the --prefix, --separator and --width it was stamped with", fmt.Sprintf(fmtString, 1), file)
+		}
+		return numbers[0], lead, nil
+	}
+
+	f, err := os.Open(splitLoadFile)
+	if err != nil {
+		return 0, "", fmt.Errorf("error opening load file `%s`: %w", splitLoadFile, err)
+	}
+	defer f.Close()
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(splitLoadFile), "."))
+	opts := utils.DATOptions{
+		Delimiter: utils.ParseDelimiter(datDelimiter),
+		Quote:     utils.ParseDelimiter(datQuote),
+	}
+	docs, err := utils.ReadLoadFile(f, format, fmtString, opts)
+	if err != nil {
+		return 0, "", fmt.Errorf("error reading load file `%s`: %w", splitLoadFile, err)
+	}
+	for _, d := range docs {
+		// produced paths are recorded with backslashes
+		path := strings.ReplaceAll(d.Path, `\`, "/")
+		if (d.Path != "" && filepath.Base(path) == base) || d.FileName == base || (len(numbers) > 0 && numbers[0] == d.StartNo) {
+			if d.PageCount != count {
+				return 0, "", fmt.Errorf("load file `%s` records %d pages for `%s`, which has %d", splitLoadFile, d.PageCount, file, count)
+			}
+			return d.StartNo, lead, nil
+		}
+	}
+	return 0, "", fmt.Errorf("`%s` is not in load file `%s`", file, splitLoadFile)
+}
+
+// splitFile splits file as given by the flags
+func splitFile(file string) []splitPart {
+	fIn, err := os.Open(file)
+	if err != nil {
+		log.Fatalf("inFile `%s` does not exist", file)
+	}
+	defer fIn.Close()
+	count, err := utils.PageCount(fIn)
+	if err != nil {
+		log.Fatalf("error with inFile `%s`: %s", file, err)
+	}
+
+	base := filepath.Base(file)
+	stem := strings.TrimSuffix(base, filepath.Ext(base))
+	parts := []splitPart{}
+	var ranges []utils.PageRange
+	switch {
+	case splitMaxSize > 0:
+		// court limits are in decimal megabytes
+		ranges, pdfs, err := utils.SplitSizeRS(fIn, int64(splitMaxSize*1e6))
+		if err != nil {
+			log.Fatalf("Error splitting `%s`\n%s\n", file, err)
+		}
+		width := len(fmt.Sprint(len(ranges)))
+		for i, r := range ranges {
+			parts = append(parts, splitPart{r, fmt.Sprintf("%s-part%0*d", stem, width, i+1), pdfs[i]})
+		}
+		return parts
+	case splitPages != "":
+		if ranges, err = utils.ParsePageRanges(splitPages, count); err != nil {
+			log.Fatal(err)
+		}
+		for _, r := range ranges {
+			name := fmt.Sprintf("%s-p%d-%d", stem, r.From, r.Thru)
+			if r.From == r.Thru {
+				name = fmt.Sprintf("%s-p%d", stem, r.From)
+			}
+			parts = append(parts, splitPart{PageRange: r, name: name})
+		}
+	case splitBookmarks:
+		if ranges, err = utils.BookmarkRanges(fIn); err != nil {
+			log.Fatalf("Error splitting `%s`\n%s\n", file, err)
+		}
+		width := len(fmt.Sprint(len(ranges)))
+		for i, r := range ranges {
+			parts = append(parts, splitPart{PageRange: r, name: fmt.Sprintf("%s-%0*d%s", stem, width, i+1, titleSuffix(r.Title))})
+		}
+	case splitBates != "":
+		fmtString := utils.GenerateFmtString(prefix, separator, buffer)
+		start, lead, err := splitBatesStart(file, fmtString, count)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ranges, err = utils.BatesRanges(splitBates, fmtString, start, count); err != nil {
+			log.Fatal(err)
+		}
+		for _, r := range ranges {
+			beg := fmt.Sprintf(fmtString, start+int64(r.From-1))
+			end := fmt.Sprintf(fmtString, start+int64(r.Thru-1))
+			// named as by the bates command, without the original range
+			parts = append(parts, splitPart{PageRange: r, name: lead + beg + "-" + end})
+		}
+	}
+
+	pdfs, err := utils.SplitRS(fIn, ranges)
+	if err != nil {
+		log.Fatalf("Error splitting `%s`\n%s\n", file, err)
+	}
+	for i := range parts {
+		parts[i].pdf = pdfs[i]
+	}
+	return parts
+}
+
+// splitFilename returns the name of part of file
+func splitFilename(file string, part splitPart) string {
+	dir := filepath.Dir(file)
+	if splitOutDir != "" {
+		dir = splitOutDir
+	}
+	return filepath.Join(dir, part.name+filepath.Ext(file))
+}
+
+// splitCmd represents the split command
+var splitCmd = &cobra.Command{
+	Use:   "split inFile1 ...",
+	Short: "Split PDFs by pages, bookmarks, size or Bates ranges",
+	Long: `
+split divides each PDF into several, in one of four ways:
+
+  --pages 1-3,4,10-      the given page ranges, written to
+                         <name>-p1-3.pdf, <name>-p4.pdf, ...
+  --bookmarks            a file for each top-level bookmark, written to
+                         <name>-1-<title>.pdf, ...; pages before the
+                         first bookmark make a file of their own
+  --max-size 35          consecutive pages in files of at most 35 MB
+                         (35,000,000 bytes) each, e.g. for e-filing,
+                         written to <name>-part1.pdf, ...
+  --bates ABC-00000010-ABC-00000020,ABC-00000031
+                         the given Bates numbers and ranges, written to
+                         <name>-ABC-00000010-ABC-00000020.pdf, ...
+
+Bates numbers are mapped to pages from the first page's number, read
+from the filename (as written by the bates and produce commands) or
+from the document's record in a --load-file (DAT, CSV or OPT, as
+written by the produce command). The --prefix, --separator and --width
+flags give the format of the Bates numbers.
+
+  $ pdftool split --bates ABC-00000010-ABC-00000020 production-ABC-00000001-ABC-00000100.pdf
+  $ pdftool split --max-size 35 -o filing/ exhibits.pdf`,
+	Args: cobra.MinimumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		modes := 0
+		for _, given := range []bool{splitPages != "", splitBookmarks, splitMaxSize > 0, splitBates != ""} {
+			if given {
+				modes++
+			}
+		}
+		if modes != 1 {
+			log.Fatal("give exactly one of --pages, --bookmarks, --max-size or --bates")
+		}
+		if splitOutDir != "" {
+			if err := os.MkdirAll(splitOutDir, 0o755); err != nil {
+				log.Fatalf("Error creating directory `%s`\n%s\n", splitOutDir, err)
+			}
+		}
+
+		for _, file := range args {
+			parts := splitFile(file)
+			for _, part := range parts {
+				newFilename := splitFilename(file, part)
+				if _, err := os.Stat(newFilename); !Overwrite && err == nil {
+					log.Fatalf("outFile `%s` already exists. To overwrite, use --force", newFilename)
+				}
+			}
+			for _, part := range parts {
+				newFilename := splitFilename(file, part)
+				if err := os.WriteFile(newFilename, part.pdf, 0o644); err != nil {
+					log.Fatalf("Error creating file `%s`\n%s\n", newFilename, err)
+				}
+				log.Printf("Wrote pages %d-%d of %s to %s", part.From, part.Thru, file, newFilename)
+			}
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(splitCmd)
+
+	splitCmd.Flags().StringVar(&splitPages, "pages", "", "split into these page ranges, e.g. 1-3,4,10-")
+	splitCmd.Flags().BoolVar(&splitBookmarks, "bookmarks", false, "split at each top-level bookmark")
+	splitCmd.Flags().Float64Var(&splitMaxSize, "max-size", 0, "split into files of at most this many megabytes (1 MB = 1,000,000 bytes)")
+	splitCmd.Flags().StringVar(&splitBates, "bates", "", "split into these Bates ranges, e.g. ABC-00000010-ABC-00000020")
+	splitCmd.Flags().StringVar(&splitLoadFile, "load-file", "", "DAT, CSV or OPT load file recording the Bates ranges of the inFiles")
+	splitCmd.Flags().StringVar(&datDelimiter, "dat-delimiter", `\x14`, "DAT field delimiter (Concordance ¶)")
+	splitCmd.Flags().StringVar(&datQuote, "dat-quote", "þ", "DAT field quote character")
+	splitCmd.Flags().StringVarP(&prefix, "prefix", "p", "Bates", "bates numbering prefix")
+	splitCmd.Flags().StringVarP(&separator, "separator", "s", "-", "separator")
+	splitCmd.Flags().IntVarP(&buffer, "width", "w", 8, "number of characters for number")
+	splitCmd.Flags().StringVarP(&splitOutDir, "out-dir", "o", "", "directory of the output files (default: that of each inFile)")
+	splitCmd.Flags().BoolVarP(&Overwrite, "force", "f", false, "overwrite the output files (default: error on existing output files)")
+}
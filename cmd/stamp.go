@@ -0,0 +1,251 @@
+/*
+Copyright © 2021 Jin-Ho King <j@kingesq.us>
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/kjinho/pdftool/src/utils"
+)
+
+// builtinPresets are the stamp presets available without any configuration
+var builtinPresets = []string{"draft", "copy", "confidential"}
+
+// stampPreset returns the watermark options and output filename suffix of
+// the named preset. Presets are defined under `stamp.presets` in the
+// config file; draft, copy and confidential are predefined and may be
+// customized there.
+func stampPreset(name string) (utils.WatermarkOptions, string, error) {
+	opts := utils.DefaultWatermarkOptions("")
+	suffix := "-" + strings.ToUpper(name)
+	key := "stamp.presets." + strings.ToLower(name)
+
+	builtin := false
+	for _, p := range builtinPresets {
+		if strings.EqualFold(name, p) {
+			builtin = true
+			opts.Text = strings.ToUpper(p)
+		}
+	}
+	if !builtin && !viper.IsSet(key) {
+		return opts, suffix, fmt.Errorf("unknown stamp preset `%s`", name)
+	}
+
+	if viper.IsSet(key + ".text") {
+		opts.Text = viper.GetString(key + ".text")
+	}
+	if viper.IsSet(key + ".font") {
+		opts.FontName = viper.GetString(key + ".font")
+	}
+	if viper.IsSet(key + ".fontsize") {
+		opts.FontSize = viper.GetInt(key + ".fontsize")
+	}
+	if viper.IsSet(key + ".scale") {
+		opts.Scale = viper.GetFloat64(key + ".scale")
+	}
+	if viper.IsSet(key + ".opacity") {
+		opts.Opacity = viper.GetFloat64(key + ".opacity")
+	}
+	if viper.IsSet(key + ".rotation") {
+		opts.Rotation = viper.GetFloat64(key + ".rotation")
+		opts.Diagonal = false
+	}
+	if viper.IsSet(key + ".color") {
+		opts.Color = viper.GetString(key + ".color")
+	}
+	if viper.IsSet(key + ".pages") {
+		opts.Pages = viper.GetString(key + ".pages")
+	}
+	if viper.IsSet(key + ".behind") {
+		opts.OnTop = !viper.GetBool(key + ".behind")
+	}
+	if viper.IsSet(key + ".scrub") {
+		opts.Scrub = viper.GetBool(key + ".scrub")
+	}
+	if viper.IsSet(key + ".suffix") {
+		suffix = viper.GetString(key + ".suffix")
+	}
+	return opts, suffix, nil
+}
+
+// stampOptions returns the watermark options and output filename suffix
+// given by v, starting from preset (if any)
+func stampOptions(v optionValues, preset string) (utils.WatermarkOptions, string, error) {
+	opts := utils.DefaultWatermarkOptions("")
+	suffix := "-STAMPED"
+	var err error
+	if preset != "" {
+		opts, suffix, err = stampPreset(preset)
+		if err != nil {
+			return opts, suffix, fmt.Errorf("%w: %s", utils.ErrInvalidOption, err)
+		}
+	}
+
+	// the text and pages of a preset are kept if given empty, as by its
+	// form left as rendered
+	if v.Given("text") && v.String("text") != "" {
+		opts.Text = v.String("text")
+	}
+	if v.Given("font") {
+		opts.FontName = v.String("font")
+	}
+	if v.Given("font-size") {
+		if opts.FontSize, err = v.Int("font-size"); err != nil {
+			return opts, suffix, err
+		}
+		if !v.Given("scale") {
+			opts.Scale = 0
+		}
+	}
+	if v.Given("scale") {
+		if opts.Scale, err = v.Float("scale"); err != nil {
+			return opts, suffix, err
+		}
+	}
+	if v.Given("opacity") {
+		if opts.Opacity, err = v.Float("opacity"); err != nil {
+			return opts, suffix, err
+		}
+	}
+	if v.Given("rotation") {
+		if opts.Rotation, err = v.Float("rotation"); err != nil {
+			return opts, suffix, err
+		}
+		opts.Diagonal = false
+	}
+	if v.Given("color") {
+		opts.Color = v.String("color")
+	}
+	if v.Given("pages") && v.String("pages") != "" {
+		opts.Pages = v.String("pages")
+	}
+	if v.Given("behind") {
+		opts.OnTop = !v.Bool("behind")
+	}
+	if v.Given("scrub") {
+		opts.Scrub = v.Bool("scrub")
+	}
+	if v.Given("suffix") {
+		suffix = v.String("suffix")
+	}
+	if opts.Text == "" {
+		return opts, suffix, fmt.Errorf("%w: no stamp text given. Set text or preset", utils.ErrInvalidOption)
+	}
+	return opts, suffix, nil
+}
+
+// stampRun returns the operation stamping with preset, or with the
+// preset option if preset is empty
+func stampRun(preset string) func(rs io.ReadSeeker, w io.Writer, name string, v optionValues, n int) (string, error) {
+	return func(rs io.ReadSeeker, w io.Writer, name string, v optionValues, n int) (string, error) {
+		p := preset
+		if p == "" {
+			p = v.String("preset")
+		}
+		opts, suffix, err := stampOptions(v, p)
+		if err != nil {
+			return "", err
+		}
+		return suffix, utils.TextStampRS(rs, w, opts)
+	}
+}
+
+// stampFlags returns the watermark options of the stamp operations
+func stampFlags(suffix string) []option {
+	def := utils.DefaultWatermarkOptions("")
+	return []option{
+		{Name: "text", Label: "Text", Usage: "text of the stamp"},
+		{Name: "font", Label: "Font", Usage: "font name", Kind: "string", Value: def.FontName, Choices: []string{"Helvetica", "Times-Roman", "Courier"}},
+		{Name: "font-size", Label: "Size", Usage: "font size in points (disables scaling unless --scale is given)", Kind: "int", Value: strconv.Itoa(def.FontSize)},
+		{Name: "scale", Label: "Scale", Usage: "size relative to the page width (0 < scale <= 1)", Kind: "float", Value: fmt.Sprint(def.Scale)},
+		{Name: "opacity", Label: "Opacity", Usage: "opacity between 0 and 1", Kind: "float", Value: fmt.Sprint(def.Opacity)},
+		{Name: "rotation", Label: "Rotation", Usage: "rotation in degrees (default: diagonal)", Kind: "float", Value: "0"},
+		{Name: "color", Label: "Color", Usage: "text color", Kind: "color", Value: def.Color},
+		{Name: "pages", Label: "Pages", Usage: "pages to stamp, e.g. 1-3,5 (default: all pages)"},
+		{Name: "behind", Label: "Behind the page content", Usage: "place the stamp behind the page content", Kind: "bool", Value: "false"},
+		{Name: "scrub", Label: "Remove metadata", Usage: "also remove metadata, as by the scrub command", Kind: "bool", Value: "false"},
+		{Name: "suffix", Label: "Filename suffix", Usage: "output filename suffix", Value: suffix},
+	}
+}
+
+// stampOperation stamps arbitrary text or a named preset
+var stampOperation = &operation{
+	Name:  "stamp",
+	Title: "Text Stamp",
+	Short: "Add a text watermark",
+	Long: `
+stamp adds a text watermark to the pages of the PDF, either with
+arbitrary --text or with a named --preset. The presets draft, copy and
+confidential are predefined; more may be defined (and the predefined
+ones customized) in the config file, e.g.
+
+  stamp:
+    presets:
+      privileged:
+        text: PRIVILEGED
+        color: "#c00000"
+      fre408:
+        text: SETTLEMENT COMMUNICATION – FRE 408
+        opacity: 0.3
+        rotation: 0
+        suffix: -FRE408
+        scrub: true
+
+Flags override the preset. For example,
+
+  $ pdftool stamp --preset privileged --pages 1 infile.pdf
+
+With --scrub (or "scrub: true" in the preset), metadata is removed as by
+the scrub command in the same pass.
+
+By default, the output filename is given the suffix "-STAMPED", or the
+preset name in upper case.
+
+Images (JPEG, PNG and TIFF) are converted to PDFs, as by the convert
+command with its --page-size and --dpi flags, and then stamped:
+
+  $ pdftool stamp --preset confidential photo.jpg`,
+	Options: append([]option{
+		{Name: "preset", Label: "Preset", Usage: "named stamp preset (draft, copy, confidential or from the config file)"},
+	}, stampFlags("-STAMPED")...),
+	Run: stampRun(""),
+}
+
+// presetOperations returns the operations applying the built-in presets
+func presetOperations() []*operation {
+	ops := []*operation{}
+	for _, preset := range builtinPresets {
+		text := strings.ToUpper(preset)
+		ops = append(ops, &operation{
+			Name:  preset,
+			Title: text[:1] + preset[1:] + " Stamp",
+			Short: "Add a `" + text + "` watermark",
+			Long: `
+` + preset + ` adds a "` + text + `" watermark to each page of the PDF.
+It is the same as "pdftool stamp --preset ` + preset + `".
+
+By default, the output filename is given the suffix "-` + text + `"`,
+			Options: stampFlags("-" + text),
+			Run:     stampRun(preset),
+		})
+	}
+	return ops
+}
@@ -16,8 +16,17 @@ limitations under the License.
 package cmd
 
 import (
+	"fmt"
+	"log"
+	"os"
 	"path/filepath"
 	"strings"
+
+	homedir "github.com/mitchellh/go-homedir"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+
+	"github.com/kjinho/pdftool/src/utils"
 )
 
 func generateNewFilename(orig string, suffix string) string {
@@ -25,3 +34,65 @@ func generateNewFilename(orig string, suffix string) string {
 	newFilename := strings.TrimSuffix(orig, ext) + suffix + ext
 	return newFilename
 }
+
+// loadFileFormats are the load file formats understood by writeLoadFiles
+var loadFileFormats = []string{"dat", "opt", "csv"}
+
+// checkLoadFileFormats verifies that each of formats is a known load file format
+func checkLoadFileFormats(formats []string) error {
+	for _, format := range formats {
+		known := false
+		for _, f := range loadFileFormats {
+			known = known || f == format
+		}
+		if !known {
+			return fmt.Errorf("unknown load file format `%s` (expected one of %s)", format, strings.Join(loadFileFormats, ", "))
+		}
+	}
+	return nil
+}
+
+// writeLoadFiles writes a load file for docs in each of formats, named
+// base with the format as the extension, giving the paths of natives
+// if there are any.
+func writeLoadFiles(base string, formats []string, docs []utils.ProductionDocument, natives utils.Natives, volume string, opts utils.DATOptions) error {
+	for _, format := range formats {
+		filename := base + "." + format
+		_, err := os.Stat(filename)
+		if !Overwrite && err == nil {
+			return fmt.Errorf("load file `%s` already exists. To overwrite, use --force", filename)
+		}
+		f, err := os.Create(filename)
+		if err != nil {
+			return err
+		}
+		switch format {
+		case "dat":
+			err = utils.WriteNativeDAT(f, docs, natives, opts)
+		case "opt":
+			err = utils.WriteOPT(f, docs, volume)
+		case "csv":
+			err = utils.WriteNativeLoadCSV(f, docs, natives)
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			return err
+		}
+		log.Printf("Wrote load file %s", filename)
+	}
+	return nil
+}
+
+// configSiblingPath returns the path of the file name next to the config
+// file, or in the home directory if there is none
+func configSiblingPath(name string) string {
+	dir := filepath.Dir(viper.ConfigFileUsed())
+	if viper.ConfigFileUsed() == "" {
+		home, err := homedir.Dir()
+		cobra.CheckErr(err)
+		dir = home
+	}
+	return filepath.Join(dir, name)
+}
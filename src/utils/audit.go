@@ -0,0 +1,133 @@
+package utils
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuditRecord records one document processed on behalf of a user
+type AuditRecord struct {
+	Time      time.Time `json:"time"`
+	User      string    `json:"user"`
+	Remote    string    `json:"remote,omitempty"` // address of the client
+	Action    string    `json:"action"`           // e.g. "bates", "draft"
+	FileName  string    `json:"filename"`
+	SHA256    string    `json:"sha256"` // of the document as uploaded
+	PageCount int       `json:"pages"`
+	BegBates  string    `json:"begbates,omitempty"`
+	EndBates  string    `json:"endbates,omitempty"`
+}
+
+// AuditLog is an append-only log of AuditRecords, stored as one JSON
+// object per line
+type AuditLog struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// NewAuditLog returns the audit log stored at path
+func NewAuditLog(path string) *AuditLog {
+	return &AuditLog{Path: path}
+}
+
+// Append adds rec to the log, stamping it with the current time if it
+// has none
+func (l *AuditLog) Append(rec AuditRecord) error {
+	if rec.Time.IsZero() {
+		rec.Time = time.Now()
+	}
+	b, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, err := os.OpenFile(l.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(b); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// AuditFilter selects audit records. Zero fields select everything.
+type AuditFilter struct {
+	User     string
+	Action   string
+	FileName string // substring of the filename
+	SHA256   string
+	Bates    string // Bates number within the range of the record
+	Since    time.Time
+	Until    time.Time
+}
+
+// Match reports whether rec is selected by f
+func (f AuditFilter) Match(rec AuditRecord) bool {
+	switch {
+	case f.User != "" && rec.User != f.User,
+		f.Action != "" && rec.Action != f.Action,
+		f.FileName != "" && !strings.Contains(rec.FileName, f.FileName),
+		f.SHA256 != "" && !strings.EqualFold(rec.SHA256, f.SHA256),
+		!f.Since.IsZero() && rec.Time.Before(f.Since),
+		!f.Until.IsZero() && !rec.Time.Before(f.Until):
+		return false
+	}
+	if f.Bates != "" {
+		// Bates numbers of the same matter have the same width, so
+		// they compare like numbers
+		if rec.BegBates == "" || len(f.Bates) != len(rec.BegBates) ||
+			f.Bates < rec.BegBates || f.Bates > rec.EndBates {
+			return false
+		}
+	}
+	return true
+}
+
+// Records returns the records of the log selected by f, oldest first
+func (l *AuditLog) Records(f AuditFilter) ([]AuditRecord, error) {
+	file, err := os.Open(l.Path)
+	if os.IsNotExist(err) {
+		return []AuditRecord{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return ReadAudit(file, f)
+}
+
+// ReadAudit reads the audit records of r selected by f
+func ReadAudit(r io.Reader, f AuditFilter) ([]AuditRecord, error) {
+	records := []AuditRecord{}
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; s.Scan(); n++ {
+		if len(strings.TrimSpace(s.Text())) == 0 {
+			continue
+		}
+		var rec AuditRecord
+		if err := json.Unmarshal(s.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("audit log line %d: %s", n, err)
+		}
+		if f.Match(rec) {
+			records = append(records, rec)
+		}
+	}
+	return records, s.Err()
+}
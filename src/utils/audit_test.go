@@ -0,0 +1,58 @@
+package utils
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestAuditLog(t *testing.T) {
+	l := NewAuditLog(filepath.Join(t.TempDir(), "audit.log"))
+	day := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+	records := []AuditRecord{
+		{Time: day, User: "alice", Action: "bates", FileName: "contract.pdf", SHA256: "AB12", PageCount: 3, BegBates: "ABC0001", EndBates: "ABC0003"},
+		{Time: day.Add(24 * time.Hour), User: "bob", Action: "draft", FileName: "memo.pdf", SHA256: "cd34", PageCount: 2},
+		{Time: day.Add(48 * time.Hour), User: "alice", Action: "bates", FileName: "letter.pdf", SHA256: "ef56", PageCount: 1, BegBates: "ABC0004", EndBates: "ABC0004"},
+	}
+	for _, rec := range records {
+		if err := l.Append(rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter AuditFilter
+		want   []string
+	}{
+		{"all", AuditFilter{}, []string{"contract.pdf", "memo.pdf", "letter.pdf"}},
+		{"user", AuditFilter{User: "alice"}, []string{"contract.pdf", "letter.pdf"}},
+		{"action", AuditFilter{Action: "draft"}, []string{"memo.pdf"}},
+		{"filename", AuditFilter{FileName: "let"}, []string{"letter.pdf"}},
+		{"hash", AuditFilter{SHA256: "ab12"}, []string{"contract.pdf"}},
+		{"bates", AuditFilter{Bates: "ABC0002"}, []string{"contract.pdf"}},
+		{"bates other width", AuditFilter{Bates: "ABC00002"}, []string{}},
+		{"since", AuditFilter{Since: day.Add(time.Hour)}, []string{"memo.pdf", "letter.pdf"}},
+		{"until", AuditFilter{Until: day.Add(24 * time.Hour)}, []string{"contract.pdf"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := l.Records(tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			names := []string{}
+			for _, rec := range got {
+				names = append(names, rec.FileName)
+			}
+			if len(names) != len(tt.want) {
+				t.Fatalf("Records() = %v, want %v", names, tt.want)
+			}
+			for i := range names {
+				if names[i] != tt.want[i] {
+					t.Errorf("Records() = %v, want %v", names, tt.want)
+				}
+			}
+		})
+	}
+}
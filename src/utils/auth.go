@@ -0,0 +1,158 @@
+package utils
+
+import (
+	"bufio"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// ErrUnauthorized is returned for a request without valid credentials
+var ErrUnauthorized = errors.New("unauthorized")
+
+// Authenticator identifies the user making an HTTP request
+type Authenticator interface {
+	// Authenticate returns the user making r, or an error of kind
+	// ErrUnauthorized
+	Authenticate(r *http.Request) (string, error)
+}
+
+// TokenAuth authenticates requests bearing a static API token, given
+// as "Authorization: Bearer <token>" or "X-API-Token: <token>". It maps
+// each token to its user.
+type TokenAuth map[string]string
+
+func (a TokenAuth) Authenticate(r *http.Request) (string, error) {
+	token := r.Header.Get("X-API-Token")
+	if auth := r.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token = strings.TrimPrefix(auth, "Bearer ")
+	}
+	if token == "" {
+		return "", fmt.Errorf("%w: no API token", ErrUnauthorized)
+	}
+	for t, user := range a {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			return user, nil
+		}
+	}
+	return "", fmt.Errorf("%w: invalid API token", ErrUnauthorized)
+}
+
+// BasicAuth authenticates requests by HTTP basic authentication against
+// bcrypt password hashes, keyed by user
+type BasicAuth map[string][]byte
+
+// ReadUsers reads a users file of "user:bcrypt-hash" lines, as written
+// by `htpasswd -B` or WriteUser. Blank lines and lines starting with #
+// are ignored.
+func ReadUsers(r io.Reader) (BasicAuth, error) {
+	users := BasicAuth{}
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("users file line %d: expected user:hash", n)
+		}
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("users file line %d: %s", n, err)
+		}
+		users[user] = []byte(hash)
+	}
+	return users, s.Err()
+}
+
+// WriteUser writes the users file line of user with password to w
+func WriteUser(w io.Writer, user string, password string) error {
+	if user == "" || strings.ContainsAny(user, ":\n") {
+		return fmt.Errorf("%w: user name `%s`", ErrInvalidOption, user)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s:%s\n", user, hash)
+	return err
+}
+
+// dummyHash is compared against when the user is unknown, so that
+// unknown users take as long to reject as wrong passwords
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("pdftool"), bcrypt.DefaultCost)
+
+func (a BasicAuth) Authenticate(r *http.Request) (string, error) {
+	user, password, ok := r.BasicAuth()
+	if !ok {
+		return "", fmt.Errorf("%w: no credentials", ErrUnauthorized)
+	}
+	hash, known := a[user]
+	if !known {
+		hash = dummyHash
+	}
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !known {
+		return "", fmt.Errorf("%w: invalid credentials for `%s`", ErrUnauthorized, user)
+	}
+	return user, nil
+}
+
+// ProxyAuth trusts the user named in Header by a reverse proxy that
+// authenticated the request. The header is only trusted from the
+// proxies in Trusted.
+type ProxyAuth struct {
+	Header  string       // e.g. X-Forwarded-User
+	Trusted []*net.IPNet // addresses of the proxies
+}
+
+// NewProxyAuth returns a ProxyAuth trusting header from the given IP
+// addresses or CIDR ranges
+func NewProxyAuth(header string, trusted []string) (*ProxyAuth, error) {
+	a := &ProxyAuth{Header: header}
+	for _, t := range trusted {
+		if !strings.Contains(t, "/") {
+			if ip := net.ParseIP(t); ip != nil && ip.To4() != nil {
+				t += "/32"
+			} else {
+				t += "/128"
+			}
+		}
+		_, ipnet, err := net.ParseCIDR(t)
+		if err != nil {
+			return nil, fmt.Errorf("%w: trusted proxy `%s`", ErrInvalidOption, t)
+		}
+		a.Trusted = append(a.Trusted, ipnet)
+	}
+	if len(a.Trusted) == 0 {
+		return nil, fmt.Errorf("%w: no trusted proxies", ErrInvalidOption)
+	}
+	return a, nil
+}
+
+func (a *ProxyAuth) Authenticate(r *http.Request) (string, error) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	trusted := false
+	for _, ipnet := range a.Trusted {
+		if ip != nil && ipnet.Contains(ip) {
+			trusted = true
+		}
+	}
+	if !trusted {
+		return "", fmt.Errorf("%w: request not from a trusted proxy", ErrUnauthorized)
+	}
+	user := r.Header.Get(a.Header)
+	if user == "" {
+		return "", fmt.Errorf("%w: no %s header", ErrUnauthorized, a.Header)
+	}
+	return user, nil
+}
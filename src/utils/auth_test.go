@@ -0,0 +1,69 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthenticate(t *testing.T) {
+	var users bytes.Buffer
+	if err := WriteUser(&users, "alice", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	basic, err := ReadUsers(&users)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proxy, err := NewProxyAuth("X-Forwarded-User", []string{"10.0.0.0/8", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens := TokenAuth{"t0k3n": "bob"}
+
+	tests := []struct {
+		name   string
+		auth   Authenticator
+		modify func(*http.Request)
+		want   string
+	}{
+		{"bearer token", tokens, func(r *http.Request) { r.Header.Set("Authorization", "Bearer t0k3n") }, "bob"},
+		{"header token", tokens, func(r *http.Request) { r.Header.Set("X-API-Token", "t0k3n") }, "bob"},
+		{"wrong token", tokens, func(r *http.Request) { r.Header.Set("X-API-Token", "nope") }, ""},
+		{"no token", tokens, func(r *http.Request) {}, ""},
+		{"basic", basic, func(r *http.Request) { r.SetBasicAuth("alice", "secret") }, "alice"},
+		{"basic wrong password", basic, func(r *http.Request) { r.SetBasicAuth("alice", "guess") }, ""},
+		{"basic unknown user", basic, func(r *http.Request) { r.SetBasicAuth("mallory", "secret") }, ""},
+		{"proxy", proxy, func(r *http.Request) {
+			r.RemoteAddr = "10.1.2.3:4567"
+			r.Header.Set("X-Forwarded-User", "carol")
+		}, "carol"},
+		{"proxy single address", proxy, func(r *http.Request) {
+			r.RemoteAddr = "127.0.0.1:4567"
+			r.Header.Set("X-Forwarded-User", "carol")
+		}, "carol"},
+		{"untrusted proxy", proxy, func(r *http.Request) {
+			r.RemoteAddr = "192.168.1.2:4567"
+			r.Header.Set("X-Forwarded-User", "carol")
+		}, ""},
+		{"proxy without user", proxy, func(r *http.Request) { r.RemoteAddr = "10.1.2.3:4567" }, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			tt.modify(r)
+			got, err := tt.auth.Authenticate(r)
+			if tt.want == "" {
+				if !errors.Is(err, ErrUnauthorized) {
+					t.Errorf("Authenticate() error = %v, want %v", err, ErrUnauthorized)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("Authenticate() = %v, %v, want %v", got, err, tt.want)
+			}
+		})
+	}
+}
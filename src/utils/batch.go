@@ -0,0 +1,146 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/md5"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+	"time"
+)
+
+// BatchDocument is one PDF of a batch stamped with continuous numbering
+type BatchDocument struct {
+	Name string // original filename
+	Data []byte
+}
+
+// ReadZipBatch returns the PDFs in the ZIP file r of the given size, in
+// the order of the archive. Directories, other files and macOS metadata
+// are skipped. It fails with ErrInvalidOption if the PDFs would take
+// more than maxSize bytes uncompressed.
+func ReadZipBatch(r io.ReaderAt, size int64, maxSize int64) ([]BatchDocument, error) {
+	zr, err := zip.NewReader(r, size)
+	if err != nil {
+		return nil, fmt.Errorf("%w: not a ZIP file: %s", ErrInvalidOption, err)
+	}
+	docs := []BatchDocument{}
+	total := int64(0)
+	for _, f := range zr.File {
+		name := path.Base(f.Name)
+		if f.FileInfo().IsDir() ||
+			strings.HasPrefix(f.Name, "__MACOSX/") ||
+			strings.HasPrefix(name, "._") ||
+			!strings.EqualFold(path.Ext(name), ".pdf") {
+			continue
+		}
+		rc, err := f.Open()
+		if err != nil {
+			return nil, err
+		}
+		b, err := io.ReadAll(io.LimitReader(rc, maxSize-total+1))
+		rc.Close()
+		if err != nil {
+			return nil, err
+		}
+		total += int64(len(b))
+		if total > maxSize {
+			return nil, fmt.Errorf("%w: ZIP file contents exceed %d bytes", ErrInvalidOption, maxSize)
+		}
+		docs = append(docs, BatchDocument{Name: name, Data: b})
+	}
+	return docs, nil
+}
+
+// ParseOrder splits s, a list of filenames separated by newlines or
+// commas, ignoring blanks
+func ParseOrder(s string) []string {
+	names := []string{}
+	for _, name := range strings.FieldsFunc(s, func(r rune) bool { return r == '\n' || r == '\r' || r == ',' }) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// OrderBatch returns docs in the order of the filenames in order.
+// Documents not listed follow in their original order. It fails with
+// ErrInvalidOption if order names a document not in docs.
+func OrderBatch(docs []BatchDocument, order []string) ([]BatchDocument, error) {
+	ordered := make([]BatchDocument, 0, len(docs))
+	used := make([]bool, len(docs))
+	for _, name := range order {
+		found := false
+		for i, d := range docs {
+			if !used[i] && d.Name == name {
+				ordered = append(ordered, d)
+				used[i] = true
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: `%s` is not among the uploaded files", ErrInvalidOption, name)
+		}
+	}
+	for i, d := range docs {
+		if !used[i] {
+			ordered = append(ordered, d)
+		}
+	}
+	return ordered, nil
+}
+
+// batchIndexName is the name of the CSV index in the ZIP file written
+// by BatesEndorseBatch
+const batchIndexName = "index.csv"
+
+// BatesEndorseBatch endorses docs, in order, with continuous Bates
+// numbers starting at startno (see BatesEndorseRS) and writes to w a ZIP
+// file of the stamped PDFs, named like name-START-STOP.pdf, along with a
+// CSV index of them (see WriteLoadCSV).
+func BatesEndorseBatch(docs []BatchDocument, w io.Writer, fmtString string, startno int64, designation string, style BatesStyle) ([]ProductionDocument, error) {
+	zw := zip.NewWriter(w)
+	now := time.Now()
+	create := func(name string) (io.Writer, error) {
+		return zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: now})
+	}
+	stamped := []ProductionDocument{}
+	for _, d := range docs {
+		pages, err := PageCount(bytes.NewReader(d.Data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", d.Name, err)
+		}
+		doc := ProductionDocument{
+			FmtString: fmtString,
+			StartNo:   startno,
+			PageCount: pages,
+			FileName:  d.Name,
+			MD5:       fmt.Sprintf("%x", md5.Sum(d.Data)),
+		}
+		ext := path.Ext(d.Name)
+		doc.Path = strings.TrimSuffix(d.Name, ext) + "-" + doc.BegBates() + "-" + doc.EndBates() + ext
+
+		fw, err := create(doc.Path)
+		if err != nil {
+			return nil, err
+		}
+		if err := BatesEndorseRS(bytes.NewReader(d.Data), fw, fmtString, startno, designation, style); err != nil {
+			return nil, fmt.Errorf("%s: %w", d.Name, err)
+		}
+		stamped = append(stamped, doc)
+		startno += int64(pages)
+	}
+
+	fw, err := create(batchIndexName)
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteLoadCSV(fw, stamped); err != nil {
+		return nil, err
+	}
+	return stamped, zw.Close()
+}
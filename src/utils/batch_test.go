@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestOrderBatch(t *testing.T) {
+	docs := []BatchDocument{{Name: "a.pdf"}, {Name: "b.pdf"}, {Name: "c.pdf"}}
+	tests := []struct {
+		name  string
+		order string
+		want  []string
+		err   error
+	}{
+		{"none", "", []string{"a.pdf", "b.pdf", "c.pdf"}, nil},
+		{"all", "c.pdf\nb.pdf\na.pdf\n", []string{"c.pdf", "b.pdf", "a.pdf"}, nil},
+		{"some", " b.pdf , ", []string{"b.pdf", "a.pdf", "c.pdf"}, nil},
+		{"unknown", "d.pdf", nil, ErrInvalidOption},
+		{"repeated", "a.pdf,a.pdf", nil, ErrInvalidOption},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := OrderBatch(docs, ParseOrder(tt.order))
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("OrderBatch() error = %v, want %v", err, tt.err)
+			}
+			if tt.err != nil {
+				return
+			}
+			names := []string{}
+			for _, d := range got {
+				names = append(names, d.Name)
+			}
+			if !reflect.DeepEqual(names, tt.want) {
+				t.Errorf("OrderBatch() = %v, want %v", names, tt.want)
+			}
+		})
+	}
+}
+
+// testZip returns a ZIP file of the given files
+func testZip(t *testing.T, files map[string][]byte, order []string) []byte {
+	var b bytes.Buffer
+	zw := zip.NewWriter(&b)
+	for _, name := range order {
+		fw, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(files[name])
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+func TestReadZipBatch(t *testing.T) {
+	files := map[string][]byte{
+		"docs/b.PDF":          testPDF(1),
+		"docs/a.pdf":          testPDF(2),
+		"docs/notes.txt":      []byte("notes"),
+		"__MACOSX/docs/a.pdf": []byte("metadata"),
+	}
+	z := testZip(t, files, []string{"docs/b.PDF", "docs/notes.txt", "__MACOSX/docs/a.pdf", "docs/a.pdf"})
+
+	docs, err := ReadZipBatch(bytes.NewReader(z), int64(len(z)), 1<<20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(docs) != 2 || docs[0].Name != "b.PDF" || docs[1].Name != "a.pdf" {
+		t.Errorf("ReadZipBatch() = %v, want b.PDF and a.pdf", docs)
+	}
+
+	if _, err := ReadZipBatch(bytes.NewReader(z), int64(len(z)), 100); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("ReadZipBatch() over size error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestBatesEndorseBatch(t *testing.T) {
+	docs := []BatchDocument{{Name: "a.pdf", Data: testPDF(2)}, {Name: "b.pdf", Data: testPDF(3)}}
+	var b bytes.Buffer
+	stamped, err := BatesEndorseBatch(docs, &b, "ABC%04d", 7, "", DefaultBatesStyle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stamped[1].BegBates(); got != "ABC0009" {
+		t.Errorf("second document starts at %s, want ABC0009", got)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"a-ABC0007-ABC0008.pdf", "b-ABC0009-ABC0011.pdf", "index.csv"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("ZIP contents = %v, want %v", names, want)
+	}
+	rc, err := zr.File[2].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, _ := io.ReadAll(rc)
+	if !bytes.Contains(index, []byte("ABC0009,ABC0011")) {
+		t.Errorf("index.csv = %s, want a row for ABC0009-ABC0011", index)
+	}
+}
@@ -0,0 +1,275 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"gopkg.in/yaml.v3"
+)
+
+// BinderEntry describes one document of a binder
+type BinderEntry struct {
+	Path        string `yaml:"path"`
+	Label       string `yaml:"label"`       // e.g. "Exhibit A"
+	Description string `yaml:"description"` // e.g. "Declaration of J. Smith"
+	BegBates    string `yaml:"begbates"`    // first Bates number, if stamped
+	EndBates    string `yaml:"endbates"`    // last Bates number, if stamped
+	SlipSheet   string `yaml:"slipsheet"`   // slip sheet in place of the document (see SlipSheet)
+}
+
+// Withheld reports whether the entry stands for a document withheld: it
+// has a slip sheet other than "native"
+func (e BinderEntry) Withheld() bool {
+	s := strings.TrimSpace(e.SlipSheet)
+	return s != "" && !strings.EqualFold(s, "native")
+}
+
+// binderFields are the recognized columns of a CSV binder manifest
+var binderFields = []string{"path", "label", "description", "begbates", "endbates", "slipsheet"}
+
+// ReadBinderManifest reads the entries of a binder from r, either a CSV
+// file with a header row naming its columns (path, label, description,
+// begbates, endbates, slipsheet) or, if format is "yaml", a YAML list of
+// entries with the same keys. Only path is required; entries with a
+// slipsheet stand for documents withheld or produced natively, which
+// need not exist.
+func ReadBinderManifest(r io.Reader, format string) ([]BinderEntry, error) {
+	entries := []BinderEntry{}
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		if err := yaml.NewDecoder(r).Decode(&entries); err != nil && err != io.EOF {
+			return nil, err
+		}
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return entries, nil
+		}
+		columns := map[string]int{}
+		for i, name := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		if _, ok := columns["path"]; !ok {
+			return nil, fmt.Errorf("binder manifest has no `path` column (expected %s)", strings.Join(binderFields, ","))
+		}
+		field := func(record []string, name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		for _, record := range records[1:] {
+			entries = append(entries, BinderEntry{
+				Path:        field(record, "path"),
+				Label:       field(record, "label"),
+				Description: field(record, "description"),
+				BegBates:    field(record, "begbates"),
+				EndBates:    field(record, "endbates"),
+				SlipSheet:   field(record, "slipsheet"),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown binder manifest format `%s` (expected csv or yaml)", format)
+	}
+	for i, e := range entries {
+		if e.Path == "" {
+			return nil, fmt.Errorf("binder manifest entry %d has no path", i+1)
+		}
+	}
+	return entries, nil
+}
+
+// BinderOptions configures the index of a binder
+type BinderOptions struct {
+	Title    string // heading of the index
+	FontName string
+	FontSize int
+}
+
+// DefaultBinderOptions returns the options of an "Index of Exhibits"
+func DefaultBinderOptions() BinderOptions {
+	return BinderOptions{
+		Title:    "Index of Exhibits",
+		FontName: "Helvetica",
+		FontSize: 11,
+	}
+}
+
+// index layout, in points
+const (
+	indexMargin      = 72
+	indexHeading     = 40  // space taken by the heading
+	indexLabelColumn = 100 // width of the label column
+	indexRangeColumn = 180 // width of the page/Bates range column
+)
+
+// indexLine is one entry of the index
+type indexLine struct {
+	entry     BinderEntry
+	firstPage int // in the binder
+	lastPage  int // in the binder
+}
+
+// pageRange returns the Bates range of l if known, its page range otherwise
+func (l indexLine) pageRange() string {
+	if l.entry.BegBates != "" {
+		if l.entry.EndBates == "" || l.entry.EndBates == l.entry.BegBates {
+			return l.entry.BegBates
+		}
+		return l.entry.BegBates + " - " + l.entry.EndBates
+	}
+	if l.firstPage == l.lastPage {
+		return fmt.Sprintf("p. %d", l.firstPage)
+	}
+	return fmt.Sprintf("pp. %d - %d", l.firstPage, l.lastPage)
+}
+
+// truncate shortens s to about width points of text in a font of the
+// given size
+func truncate(s string, width float64, fontSize int) string {
+	max := int(width / (0.5 * float64(fontSize)))
+	r := []rune(s)
+	if len(r) <= max || max < 4 {
+		return s
+	}
+	return string(r[:max-3]) + "..."
+}
+
+// BinderRS merges docs into a single PDF written to w, preceded by an
+// index listing each document as described by the corresponding entry.
+// Each index line links to the first page of its document, and each
+// document gets a bookmark. Outlines of the documents are dropped.
+func BinderRS(docs []io.ReadSeeker, w io.Writer, entries []BinderEntry, opts BinderOptions) (err error) {
+	const op = "binder"
+	defer recoverCorrupt(op, &err)
+
+	if len(docs) == 0 || len(docs) != len(entries) {
+		return optionErr(op, fmt.Errorf("%d documents for %d entries", len(docs), len(entries)))
+	}
+
+	ctx, merged, err := mergeDocs(op, docs, false)
+	if err != nil {
+		return err
+	}
+	lines := make([]indexLine, len(docs))
+	for i, d := range merged {
+		lines[i] = indexLine{entry: entries[i], firstPage: d.firstPage, lastPage: d.lastPage}
+	}
+
+	dims, err := ctx.PageDims()
+	if err != nil {
+		return readErr(op, err)
+	}
+	lineHeight := 1.8 * float64(opts.FontSize)
+	perPage := int((dims[0].Height - 2*indexMargin - indexHeading) / lineHeight)
+	if perPage < 1 {
+		return optionErr(op, fmt.Errorf("font size %d is too large for the index", opts.FontSize))
+	}
+	indexPages := int(math.Ceil(float64(len(lines)) / float64(perPage)))
+
+	for i := 0; i < indexPages; i++ {
+		if err := ctx.InsertBlankPages(types.IntSet{1: true}, true); err != nil {
+			return readErr(op, err)
+		}
+		ctx.PageCount++
+	}
+	for i := range lines {
+		lines[i].firstPage += indexPages
+		lines[i].lastPage += indexPages
+	}
+
+	width := dims[0].Width
+	descWidth := width - 2*indexMargin - indexLabelColumn - indexRangeColumn
+	text := func(s, pos string, dx, dy float64, font string, size int) (*model.Watermark, error) {
+		desc := fmt.Sprintf(
+			"font:%s, points:%d, scale:1 abs, pos:%s, rot:0, fillc:#000000, offset:%g %g, op:1",
+			font, size, pos, dx, dy,
+		)
+		wm, err := textWatermark(s, desc, true)
+		if err != nil {
+			return nil, optionErr(op, err)
+		}
+		return wm, nil
+	}
+
+	watermarks := map[int][]*model.Watermark{}
+	links := map[int][]model.AnnotationRenderer{}
+	bookmarks := []pdfcpu.Bookmark{{Title: opts.Title, PageFrom: 1}}
+	if opts.Title == "" {
+		bookmarks[0].Title = "Index"
+	}
+	for i, l := range lines {
+		page := i/perPage + 1
+		if i%perPage == 0 && opts.Title != "" {
+			heading, err := text(opts.Title, "tc", 0, -indexMargin, "Helvetica-Bold", opts.FontSize+5)
+			if err != nil {
+				return err
+			}
+			watermarks[page] = append(watermarks[page], heading)
+		}
+		y := indexMargin + indexHeading + float64(i%perPage)*lineHeight
+		label, err := text(truncate(l.entry.Label, indexLabelColumn, opts.FontSize), "tl", indexMargin, -y, opts.FontName, opts.FontSize)
+		if err != nil {
+			return err
+		}
+		watermarks[page] = append(watermarks[page], label)
+		if l.entry.Description != "" {
+			description, err := text(truncate(l.entry.Description, descWidth, opts.FontSize), "tl", indexMargin+indexLabelColumn, -y, opts.FontName, opts.FontSize)
+			if err != nil {
+				return err
+			}
+			watermarks[page] = append(watermarks[page], description)
+		}
+		pages, err := text(l.pageRange(), "tr", -indexMargin, -y, opts.FontName, opts.FontSize)
+		if err != nil {
+			return err
+		}
+		watermarks[page] = append(watermarks[page], pages)
+
+		rect := types.NewRectangle(
+			indexMargin, dims[0].Height-y-lineHeight,
+			width-indexMargin, dims[0].Height-y,
+		)
+		dest := &model.Destination{Typ: model.DestFit, PageNr: l.firstPage}
+		link := model.NewLinkAnnotation(*rect, nil, dest, "", fmt.Sprintf("index%d", i+1), 0, nil, false)
+		links[page] = append(links[page], link)
+
+		title := l.entry.Label
+		if title == "" {
+			title = l.entry.Description
+		} else if l.entry.Description != "" {
+			title += ": " + l.entry.Description
+		}
+		bookmarks = append(bookmarks, pdfcpu.Bookmark{Title: title, PageFrom: l.firstPage})
+	}
+
+	if err := pdfcpu.AddWatermarksSliceMap(ctx, watermarks); err != nil {
+		return optionErr(op, err)
+	}
+	if _, err := pdfcpu.AddAnnotationsMap(ctx, links, false); err != nil {
+		return optionErr(op, err)
+	}
+	if err := setBookmarks(ctx, bookmarks); err != nil {
+		return optionErr(op, err)
+	}
+	if err := api.OptimizeContext(ctx); err != nil {
+		return readErr(op, err)
+	}
+	if err := api.WriteContext(ctx, w); err != nil {
+		return readErr(op, err)
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package utils
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+func TestReadBinderManifest(t *testing.T) {
+	want := []BinderEntry{
+		{Path: "a.pdf", Label: "Exhibit A", Description: "Declaration of J. Smith"},
+		{Path: "b.pdf", Label: "Exhibit B", Description: "Contract", BegBates: "ABC0001", EndBates: "ABC0004"},
+	}
+	tests := []struct {
+		name   string
+		format string
+		input  string
+	}{
+		{"csv", "csv", "Path,Label,Description,BegBates,EndBates\na.pdf,Exhibit A,Declaration of J. Smith,,\nb.pdf,Exhibit B,Contract,ABC0001,ABC0004\n"},
+		{"csv reordered", "csv", "label,path,description,begbates,endbates\nExhibit A,a.pdf,Declaration of J. Smith\nExhibit B,b.pdf,Contract,ABC0001,ABC0004\n"},
+		{"yaml", "yaml", "- path: a.pdf\n  label: Exhibit A\n  description: Declaration of J. Smith\n- path: b.pdf\n  label: Exhibit B\n  description: Contract\n  begbates: ABC0001\n  endbates: ABC0004\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadBinderManifest(strings.NewReader(tt.input), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("ReadBinderManifest() = %v, want %v", got, want)
+			}
+		})
+	}
+
+	if _, err := ReadBinderManifest(strings.NewReader("label\nExhibit A\n"), "csv"); err == nil {
+		t.Error("ReadBinderManifest() without path column did not fail")
+	}
+}
+
+func TestReadBinderManifestSlipSheets(t *testing.T) {
+	got, err := ReadBinderManifest(strings.NewReader("path,slipsheet\na.pdf,\nb.msg,withheld\nc.xlsx,Native\nd.docx,Withheld – Work Product\n"), "csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []BinderEntry{
+		{Path: "a.pdf"},
+		{Path: "b.msg", SlipSheet: "withheld"},
+		{Path: "c.xlsx", SlipSheet: "Native"},
+		{Path: "d.docx", SlipSheet: "Withheld – Work Product"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("ReadBinderManifest() = %v, want %v", got, want)
+	}
+	for i, withheld := range []bool{false, true, false, true} {
+		if got[i].Withheld() != withheld {
+			t.Errorf("%s Withheld() = %v, want %v", got[i].Path, got[i].Withheld(), withheld)
+		}
+	}
+}
+
+func TestBinderRS(t *testing.T) {
+	entries := []BinderEntry{
+		{Path: "a.pdf", Label: "Exhibit A", Description: "Declaration"},
+		{Path: "b.pdf", Label: "Exhibit B", Description: "Contract", BegBates: "ABC0001", EndBates: "ABC0003"},
+	}
+	docs := []io.ReadSeeker{bytes.NewReader(testPDF(2)), bytes.NewReader(testPDF(3))}
+	var b bytes.Buffer
+	if err := BinderRS(docs, &b, entries, DefaultBinderOptions()); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, err := api.ReadContext(bytes.NewReader(b.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.PageCount != 6 {
+		t.Errorf("page count = %d, want 6", ctx.PageCount)
+	}
+	bms, err := pdfcpu.BookmarksForOutline(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []int{}
+	for _, bm := range bms {
+		got = append(got, bm.PageFrom)
+	}
+	if want := []int{1, 2, 4}; !reflect.DeepEqual(got, want) {
+		t.Errorf("bookmark pages = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,1143 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/font"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/matrix"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// tokenKind is the kind of a token of a content stream
+type tokenKind int
+
+const (
+	tokNumber tokenKind = iota
+	tokString
+	tokName
+	tokArray
+	tokDict
+	tokKeyword // operators, and true, false and null
+)
+
+// token is an operand or operator of a content stream
+type token struct {
+	kind  tokenKind
+	num   float64
+	str   []byte  // bytes of a string, or the name or keyword
+	elems []token // of an array, or the keys and values of a dict
+}
+
+// contentOp is an operator of a content stream with its operands
+type contentOp struct {
+	name     string
+	operands []token
+	raw      []byte // as in the stream, through the end of an inline image
+}
+
+// lexer splits content streams, and CMaps, into tokens
+type lexer struct {
+	b   []byte
+	pos int
+}
+
+func isSpace(c byte) bool {
+	switch c {
+	case 0, '\t', '\n', '\f', '\r', ' ':
+		return true
+	}
+	return false
+}
+
+func isDelim(c byte) bool {
+	switch c {
+	case '(', ')', '<', '>', '[', ']', '{', '}', '/', '%':
+		return true
+	}
+	return false
+}
+
+// skipSpace skips whitespace and comments
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.b) {
+		switch c := l.b[l.pos]; {
+		case c == '%':
+			for l.pos < len(l.b) && l.b[l.pos] != '\n' && l.b[l.pos] != '\r' {
+				l.pos++
+			}
+		case isSpace(c):
+			l.pos++
+		default:
+			return
+		}
+	}
+}
+
+// regular returns the run of regular characters at l.pos
+func (l *lexer) regular() []byte {
+	start := l.pos
+	for l.pos < len(l.b) && !isSpace(l.b[l.pos]) && !isDelim(l.b[l.pos]) {
+		l.pos++
+	}
+	return l.b[start:l.pos]
+}
+
+// next returns the next token, or false at the end of the stream
+func (l *lexer) next() (token, bool, error) {
+	l.skipSpace()
+	if l.pos >= len(l.b) {
+		return token{}, false, nil
+	}
+	switch c := l.b[l.pos]; c {
+	case '(':
+		s, err := l.literal()
+		return token{kind: tokString, str: s}, true, err
+	case '<':
+		if l.pos+1 < len(l.b) && l.b[l.pos+1] == '<' {
+			l.pos += 2
+			elems, err := l.until(">>")
+			return token{kind: tokDict, elems: elems}, true, err
+		}
+		s, err := l.hex()
+		return token{kind: tokString, str: s}, true, err
+	case '[':
+		l.pos++
+		elems, err := l.until("]")
+		return token{kind: tokArray, elems: elems}, true, err
+	case '/':
+		l.pos++
+		return token{kind: tokName, str: unescapeName(l.regular())}, true, nil
+	case ')', '>', ']':
+		return token{}, false, fmt.Errorf("unexpected `%c` at offset %d", c, l.pos)
+	case '{', '}':
+		l.pos++
+		return token{kind: tokKeyword, str: []byte{c}}, true, nil
+	}
+	word := l.regular()
+	if c := word[0]; c == '+' || c == '-' || c == '.' || c >= '0' && c <= '9' {
+		// malformed numbers, such as "--1", read as 0
+		n, _ := strconv.ParseFloat(string(word), 64)
+		return token{kind: tokNumber, num: n}, true, nil
+	}
+	return token{kind: tokKeyword, str: word}, true, nil
+}
+
+// literal reads a string in parentheses
+func (l *lexer) literal() ([]byte, error) {
+	l.pos++
+	s := []byte{}
+	depth := 1
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			if depth--; depth == 0 {
+				return s, nil
+			}
+		case '\\':
+			if l.pos >= len(l.b) {
+				continue
+			}
+			c = l.b[l.pos]
+			l.pos++
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r', '\n':
+				// a line continued
+				if c == '\r' && l.pos < len(l.b) && l.b[l.pos] == '\n' {
+					l.pos++
+				}
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					n := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.b) && l.b[l.pos] >= '0' && l.b[l.pos] <= '7'; i++ {
+						n = n*8 + int(l.b[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(n)
+				}
+			}
+		}
+		s = append(s, c)
+	}
+	return nil, errors.New("unterminated string")
+}
+
+// hex reads a string of hexadecimal digits in angle brackets
+func (l *lexer) hex() ([]byte, error) {
+	l.pos++
+	digits := []byte{}
+	for l.pos < len(l.b) {
+		c := l.b[l.pos]
+		l.pos++
+		if c == '>' {
+			if len(digits)%2 == 1 {
+				digits = append(digits, '0')
+			}
+			s := make([]byte, len(digits)/2)
+			_, err := hex.Decode(s, digits)
+			return s, err
+		}
+		if !isSpace(c) {
+			digits = append(digits, c)
+		}
+	}
+	return nil, errors.New("unterminated hex string")
+}
+
+// until reads the tokens of an array or dict, through end
+func (l *lexer) until(end string) ([]token, error) {
+	elems := []token{}
+	for {
+		l.skipSpace()
+		if l.pos >= len(l.b) {
+			return nil, fmt.Errorf("missing `%s`", end)
+		}
+		if bytes.HasPrefix(l.b[l.pos:], []byte(end)) {
+			l.pos += len(end)
+			return elems, nil
+		}
+		t, _, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		elems = append(elems, t)
+	}
+}
+
+// inlineImage reads the dictionary and data of an inline image after
+// its BI operator, returning the keys and values of the dictionary
+func (l *lexer) inlineImage() ([]token, error) {
+	entries := []token{}
+	for {
+		t, ok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return nil, errors.New("inline image without ID")
+		}
+		if t.kind == tokKeyword && string(t.str) == "ID" {
+			break
+		}
+		entries = append(entries, t)
+	}
+	// the data follow a single whitespace character, and run to an EI
+	// between whitespace
+	l.pos++
+	for i := l.pos; i+2 <= len(l.b); i++ {
+		if l.b[i] == 'E' && l.b[i+1] == 'I' && i > l.pos && isSpace(l.b[i-1]) &&
+			(i+2 == len(l.b) || isSpace(l.b[i+2]) || isDelim(l.b[i+2])) {
+			l.pos = i + 2
+			return entries, nil
+		}
+	}
+	return nil, errors.New("inline image without EI")
+}
+
+// unescapeName decodes the #xx escapes of a name
+func unescapeName(b []byte) []byte {
+	if bytes.IndexByte(b, '#') < 0 {
+		return b
+	}
+	s := []byte{}
+	for i := 0; i < len(b); i++ {
+		if b[i] == '#' && i+2 < len(b) {
+			if n, err := strconv.ParseUint(string(b[i+1:i+3]), 16, 8); err == nil {
+				s = append(s, byte(n))
+				i += 2
+				continue
+			}
+		}
+		s = append(s, b[i])
+	}
+	return s
+}
+
+// parseContent splits the content stream b into its operators
+func parseContent(b []byte) ([]contentOp, error) {
+	l := &lexer{b: b}
+	ops := []contentOp{}
+	operands := []token{}
+	start := 0
+	for {
+		t, ok, err := l.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return ops, nil
+		}
+		if t.kind != tokKeyword {
+			operands = append(operands, t)
+			continue
+		}
+		switch string(t.str) {
+		case "true", "false", "null":
+			operands = append(operands, t)
+			continue
+		}
+		op := contentOp{name: string(t.str), operands: operands}
+		if op.name == "BI" {
+			if op.operands, err = l.inlineImage(); err != nil {
+				return nil, err
+			}
+		}
+		op.raw = b[start:l.pos]
+		ops = append(ops, op)
+		operands = []token{}
+		start = l.pos
+	}
+}
+
+// numbers returns the last n operands of op, or nil unless they are
+// numbers
+func (op contentOp) numbers(n int) []float64 {
+	if len(op.operands) < n {
+		return nil
+	}
+	nums := make([]float64, n)
+	for i, t := range op.operands[len(op.operands)-n:] {
+		if t.kind != tokNumber {
+			return nil
+		}
+		nums[i] = t.num
+	}
+	return nums
+}
+
+// operand returns the last operand of op, which must be of kind
+func (op contentOp) operand(kind tokenKind) (token, bool) {
+	if len(op.operands) == 0 || op.operands[len(op.operands)-1].kind != kind {
+		return token{}, false
+	}
+	return op.operands[len(op.operands)-1], true
+}
+
+// formatNumber formats n for a content stream
+func formatNumber(n float64) string {
+	if n == 0 {
+		n = 0 // not -0
+	}
+	return strconv.FormatFloat(math.Round(n*1000)/1000, 'f', -1, 64)
+}
+
+// formatName formats n as a name for a content stream
+func formatName(n string) string {
+	var b strings.Builder
+	b.WriteByte('/')
+	for i := 0; i < len(n); i++ {
+		if c := n[i]; c <= ' ' || c > '~' || c == '#' || isDelim(c) {
+			fmt.Fprintf(&b, "#%02X", c)
+		} else {
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// formatToken formats t for a content stream
+func formatToken(t token) string {
+	switch t.kind {
+	case tokNumber:
+		return formatNumber(t.num)
+	case tokString:
+		return "<" + hex.EncodeToString(t.str) + ">"
+	case tokName:
+		return formatName(string(t.str))
+	case tokArray, tokDict:
+		elems := []string{}
+		for _, e := range t.elems {
+			elems = append(elems, formatToken(e))
+		}
+		if t.kind == tokArray {
+			return "[" + strings.Join(elems, " ") + "]"
+		}
+		return "<<" + strings.Join(elems, " ") + ">>"
+	}
+	return string(t.str)
+}
+
+// coreTextWidth returns the width of b, WinAnsi encoded, in the core
+// font fontName at a size of 1 point
+func coreTextWidth(b []byte, fontName string) float64 {
+	w := 0
+	for _, c := range b {
+		w += font.CharWidth(fontName, rune(c))
+	}
+	return float64(w) / 1000
+}
+
+// pageBuilder builds a new PDF page by page
+type pageBuilder struct {
+	ctx      *model.Context
+	pagesRef types.IndirectRef
+	kids     types.Array
+}
+
+// newPageBuilder returns a builder of a PDF whose pages are by default
+// of the given size
+func newPageBuilder(width, height float64) (*pageBuilder, error) {
+	ctx, err := pdfcpu.CreateContextWithXRefTable(model.NewDefaultConfiguration(), &types.Dim{Width: width, Height: height})
+	if err != nil {
+		return nil, err
+	}
+	root, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	return &pageBuilder{ctx: ctx, pagesRef: root["Pages"].(types.IndirectRef)}, nil
+}
+
+// addPage adds a page drawn by content with resources, of the size of
+// mediaBox or, if nil, the default size
+func (p *pageBuilder) addPage(content []byte, resources types.Dict, mediaBox *types.Rectangle) error {
+	sd, err := p.ctx.NewStreamDictForBuf(content)
+	if err != nil {
+		return err
+	}
+	if err := sd.Encode(); err != nil {
+		return err
+	}
+	ir, err := p.ctx.IndRefForNewObject(*sd)
+	if err != nil {
+		return err
+	}
+	d := types.Dict{
+		"Type":      types.Name("Page"),
+		"Parent":    p.pagesRef,
+		"Resources": resources,
+		"Contents":  *ir,
+	}
+	if mediaBox != nil {
+		d["MediaBox"] = mediaBox.Array()
+	}
+	page, err := p.ctx.IndRefForNewObject(d)
+	if err != nil {
+		return err
+	}
+	p.kids = append(p.kids, *page)
+	return nil
+}
+
+// write writes the PDF of the pages added to w
+func (p *pageBuilder) write(w io.Writer) error {
+	tree, err := p.ctx.DereferenceDict(p.pagesRef)
+	if err != nil {
+		return err
+	}
+	tree["Kids"] = p.kids
+	tree["Count"] = types.Integer(len(p.kids))
+	p.ctx.PageCount = len(p.kids)
+	return api.WriteContext(p.ctx, w)
+}
+
+// writeContentPDF writes to w a PDF of pages of the given size, one for
+// each of contents, which may use the fonts /F1 (Helvetica) and /F2
+// (Helvetica-Bold) with WinAnsi encoding
+func writeContentPDF(w io.Writer, width, height float64, contents [][]byte) error {
+	p, err := newPageBuilder(width, height)
+	if err != nil {
+		return err
+	}
+	fonts := types.Dict{}
+	for name, base := range map[string]string{"F1": "Helvetica", "F2": "Helvetica-Bold"} {
+		ir, err := p.ctx.IndRefForNewObject(types.Dict{
+			"Type":     types.Name("Font"),
+			"Subtype":  types.Name("Type1"),
+			"BaseFont": types.Name(base),
+			"Encoding": types.Name("WinAnsiEncoding"),
+		})
+		if err != nil {
+			return err
+		}
+		fonts[name] = *ir
+	}
+	for _, content := range contents {
+		if err := p.addPage(content, types.Dict{"Font": fonts}, nil); err != nil {
+			return err
+		}
+	}
+	return p.write(w)
+}
+
+// winAnsi maps the codes 0x80-0x9F of WinAnsiEncoding, which differ from
+// Latin-1, to their runes
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…', 0x86: '†', 0x87: '‡',
+	0x88: 'ˆ', 0x89: '‰', 0x8A: 'Š', 0x8B: '‹', 0x8C: 'Œ', 0x8E: 'Ž',
+	0x91: '‘', 0x92: '’', 0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9A: 'š', 0x9B: '›', 0x9C: 'œ', 0x9E: 'ž', 0x9F: 'Ÿ',
+}
+
+// winAnsiBytes encodes s in WinAnsiEncoding, replacing the runes it lacks
+// with "?"
+func winAnsiBytes(s string) []byte {
+	b := []byte{}
+rune:
+	for _, r := range s {
+		for c, w := range winAnsi {
+			if r == w {
+				b = append(b, c)
+				continue rune
+			}
+		}
+		if r < 0x80 || r >= 0xA0 && r < 0x100 {
+			b = append(b, byte(r))
+		} else {
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// pdfFont is what is known of a font to locate and read its glyphs
+type pdfFont struct {
+	twoByte   bool            // codes are two bytes, as in Type0 fonts
+	widths    map[int]float64 // in text space units, by code
+	missing   float64         // width of codes not in widths
+	ascent    float64
+	descent   float64
+	core      string // standard font for the widths not given
+	toUnicode map[int]string
+	custom    bool // codes have no standard meaning without toUnicode
+}
+
+// charCode is a code shown, at bytes lo to hi of its string
+type charCode struct {
+	code   int
+	lo, hi int
+}
+
+// codes splits s into the codes of f
+func (f *pdfFont) codes(s []byte) []charCode {
+	codes := []charCode{}
+	if !f.twoByte {
+		for i, c := range s {
+			codes = append(codes, charCode{int(c), i, i + 1})
+		}
+		return codes
+	}
+	for i := 0; i+1 < len(s); i += 2 {
+		codes = append(codes, charCode{int(s[i])<<8 | int(s[i+1]), i, i + 2})
+	}
+	return codes
+}
+
+func (f *pdfFont) width(code int) float64 {
+	if w, ok := f.widths[code]; ok {
+		return w
+	}
+	if f.core != "" && code < 256 {
+		return float64(font.CharWidth(f.core, rune(code))) / 1000
+	}
+	return f.missing
+}
+
+// unmapped reports whether the text of code is unknown, f having a
+// custom encoding and no ToUnicode mapping for it
+func (f *pdfFont) unmapped(code int) bool {
+	_, ok := f.toUnicode[code]
+	return f.custom && !ok
+}
+
+func (f *pdfFont) text(code int) string {
+	if s, ok := f.toUnicode[code]; ok {
+		return s
+	}
+	if f.twoByte {
+		return ""
+	}
+	if r, ok := winAnsi[byte(code)]; ok {
+		return string(r)
+	}
+	return string(rune(code))
+}
+
+// number returns the number o, if it is one
+func number(ctx *model.Context, o types.Object) (float64, bool) {
+	n, err := ctx.DereferenceNumber(o)
+	return n, err == nil
+}
+
+// loadFont reads the widths, metrics and ToUnicode map of the font d
+func loadFont(ctx *model.Context, d types.Dict) *pdfFont {
+	f := &pdfFont{widths: map[int]float64{}, missing: 0.5, ascent: 0.8, descent: -0.2}
+	if d == nil {
+		return f
+	}
+	scale := 0.001 // from glyph space to text space
+	descriptor := d
+	subtype := d.NameEntry("Subtype")
+	switch {
+	case subtype != nil && *subtype == "Type0":
+		f.twoByte = true
+		f.custom = true
+		f.missing = 1
+		kids, _ := ctx.DereferenceArray(d["DescendantFonts"])
+		if len(kids) == 0 {
+			break
+		}
+		cid, _ := ctx.DereferenceDict(kids[0])
+		if cid == nil {
+			break
+		}
+		descriptor = cid
+		if dw, ok := number(ctx, cid["DW"]); ok {
+			f.missing = dw * scale
+		}
+		// W holds runs "c [w1 w2 ...]" and ranges "cfirst clast w"
+		w, _ := ctx.DereferenceArray(cid["W"])
+		for i := 0; i+1 < len(w); {
+			first, ok := number(ctx, w[i])
+			if !ok {
+				break
+			}
+			if o, _ := ctx.Dereference(w[i+1]); o != nil {
+				if a, ok := o.(types.Array); ok {
+					for j, ow := range a {
+						if v, ok := number(ctx, ow); ok {
+							f.widths[int(first)+j] = v * scale
+						}
+					}
+					i += 2
+					continue
+				}
+			}
+			if i+2 >= len(w) {
+				break
+			}
+			last, _ := number(ctx, w[i+1])
+			v, _ := number(ctx, w[i+2])
+			for c := int(first); c <= int(last) && c-int(first) < 1<<16; c++ {
+				f.widths[c] = v * scale
+			}
+			i += 3
+		}
+	default:
+		if enc, _ := ctx.DereferenceDict(d["Encoding"]); enc != nil && enc["Differences"] != nil {
+			f.custom = true
+		}
+		if subtype != nil && *subtype == "Type3" {
+			f.custom = true
+			if m, _ := ctx.DereferenceArray(d["FontMatrix"]); len(m) == 6 {
+				if v, ok := number(ctx, m[0]); ok {
+					scale = v
+				}
+			}
+		}
+		if bf := d.NameEntry("BaseFont"); bf != nil {
+			// without the prefix of a subset, e.g. "ABCDEF+Helvetica"
+			name := *bf
+			if i := strings.IndexByte(name, '+'); i == 6 {
+				name = name[i+1:]
+			}
+			if font.IsCoreFont(name) {
+				f.core = name
+			}
+		}
+		first, _ := number(ctx, d["FirstChar"])
+		widths, _ := ctx.DereferenceArray(d["Widths"])
+		for i, o := range widths {
+			if v, ok := number(ctx, o); ok {
+				f.widths[int(first)+i] = v * scale
+			}
+		}
+		if mw, ok := number(ctx, d["MissingWidth"]); ok {
+			f.missing = mw * scale
+		}
+	}
+
+	if fd, _ := ctx.DereferenceDict(descriptor["FontDescriptor"]); fd != nil {
+		if mw, ok := number(ctx, fd["MissingWidth"]); ok && !f.twoByte {
+			f.missing = mw * scale
+		}
+		if a, ok := number(ctx, fd["Ascent"]); ok && a > 0 {
+			f.ascent = a * scale
+		}
+		if d, ok := number(ctx, fd["Descent"]); ok && d < 0 {
+			f.descent = d * scale
+		}
+	}
+
+	if sd, _, _ := ctx.DereferenceStreamDict(d["ToUnicode"]); sd != nil {
+		if err := sd.Decode(); err == nil {
+			f.toUnicode = parseToUnicode(sd.Content)
+		}
+	}
+	return f
+}
+
+// parseToUnicode reads the bfchar and bfrange mappings of a ToUnicode
+// CMap
+func parseToUnicode(b []byte) map[int]string {
+	l := &lexer{b: b}
+	tokens := []token{}
+	for {
+		t, ok, err := l.next()
+		if err != nil || !ok {
+			break
+		}
+		tokens = append(tokens, t)
+	}
+	code := func(b []byte) int {
+		n := 0
+		for _, c := range b {
+			n = n<<8 | int(c)
+		}
+		return n
+	}
+	m := map[int]string{}
+	section := ""
+	for i := 0; i < len(tokens); i++ {
+		t := tokens[i]
+		if t.kind == tokKeyword {
+			section = string(t.str)
+			continue
+		}
+		switch section {
+		case "beginbfchar":
+			if i+1 < len(tokens) && t.kind == tokString && tokens[i+1].kind == tokString {
+				m[code(t.str)] = utf16Text(tokens[i+1].str)
+				i++
+			}
+		case "beginbfrange":
+			if i+2 >= len(tokens) || t.kind != tokString || tokens[i+1].kind != tokString {
+				continue
+			}
+			lo, hi, dst := code(t.str), code(tokens[i+1].str), tokens[i+2]
+			for c := lo; c <= hi && c-lo < 1<<16; c++ {
+				switch dst.kind {
+				case tokString:
+					// the last byte counts up through the range
+					u := append([]byte{}, dst.str...)
+					if len(u) > 0 {
+						u[len(u)-1] += byte(c - lo)
+					}
+					m[c] = utf16Text(u)
+				case tokArray:
+					if c-lo < len(dst.elems) {
+						m[c] = utf16Text(dst.elems[c-lo].str)
+					}
+				}
+			}
+			i += 2
+		}
+	}
+	return m
+}
+
+// utf16Text decodes the UTF-16BE b
+func utf16Text(b []byte) string {
+	if len(b)%2 == 1 {
+		return string(b)
+	}
+	u := make([]uint16, len(b)/2)
+	for i := range u {
+		u[i] = uint16(b[2*i])<<8 | uint16(b[2*i+1])
+	}
+	return string(utf16.Decode(u))
+}
+
+// glyph is a glyph shown by a text operator
+type glyph struct {
+	elem    int // index of its string in the TJ array, else 0
+	lo, hi  int // bytes of its code in the string
+	text    string
+	unknown bool            // text is not known, see pdfFont.unmapped
+	box     types.Rectangle // in the space of the walk
+	from    types.Point     // start of the baseline
+	to      types.Point     // end of the baseline
+	height  float64         // font size in the space of the walk
+	size    float64         // font size in text space
+	advance float64         // in text space, before horizontal scaling
+}
+
+// graphicsState is the part of the graphics state a contentWalker needs
+type graphicsState struct {
+	ctm       matrix.Matrix
+	font      *pdfFont
+	size      float64
+	charSpace float64
+	wordSpace float64
+	scale     float64 // horizontal scaling
+	leading   float64
+	rise      float64
+	lineWidth float64
+}
+
+// contentWalker walks the operators of a content stream, following the
+// graphics and text state, and calls its functions on what they paint,
+// located in the space the walk starts in. Any of the functions may be
+// nil.
+type contentWalker struct {
+	ctx  *model.Context
+	skip string // tag of marked content passed over, if any
+
+	// text is called on the glyphs of text operator i
+	text func(i int, glyphs []glyph)
+	// path is called on the path built by operators from to to, painted
+	// by operator to with ctm. rects are the path's rectangles if it is
+	// filled and made of nothing else, axis aligned in the space of the
+	// walk.
+	path func(from, to int, box types.Rectangle, rects []types.Rectangle, clip bool, ctm matrix.Matrix)
+	// image is called on images, with sd nil for inline images
+	image func(i int, box types.Rectangle, name string, sd *types.StreamDict, ctm matrix.Matrix)
+	// form is called on form XObjects, with the matrix of their space
+	form func(i int, box types.Rectangle, name string, sd *types.StreamDict, ctm matrix.Matrix)
+}
+
+// translate returns the matrix translating by x, y
+func translate(x, y float64) matrix.Matrix {
+	return matrix.Matrix{{1, 0, 0}, {0, 1, 0}, {x, y, 1}}
+}
+
+// newMatrix returns the matrix of the operands a b c d e f
+func newMatrix(m []float64) matrix.Matrix {
+	return matrix.Matrix{{m[0], m[1], 0}, {m[2], m[3], 0}, {m[4], m[5], 1}}
+}
+
+// transformBox returns the bounding box of the rectangle x0 y0 x1 y1
+// transformed by m
+func transformBox(m matrix.Matrix, x0, y0, x1, y1 float64) types.Rectangle {
+	r := types.Rectangle{LL: types.Point{X: math.Inf(1), Y: math.Inf(1)}, UR: types.Point{X: math.Inf(-1), Y: math.Inf(-1)}}
+	for _, p := range []types.Point{{X: x0, Y: y0}, {X: x1, Y: y0}, {X: x0, Y: y1}, {X: x1, Y: y1}} {
+		r = extendBox(r, m.Transform(p))
+	}
+	return r
+}
+
+// extendBox returns r extended to p
+func extendBox(r types.Rectangle, p types.Point) types.Rectangle {
+	r.LL.X, r.LL.Y = math.Min(r.LL.X, p.X), math.Min(r.LL.Y, p.Y)
+	r.UR.X, r.UR.Y = math.Max(r.UR.X, p.X), math.Max(r.UR.Y, p.Y)
+	return r
+}
+
+// axisAligned reports whether m maps rectangles to rectangles
+func axisAligned(m matrix.Matrix) bool {
+	return m[0][1] == 0 && m[1][0] == 0 || m[0][0] == 0 && m[1][1] == 0
+}
+
+// resource returns the resource name of category, e.g. "Font", of
+// resources
+func resource(ctx *model.Context, resources types.Dict, category, name string) types.Object {
+	d, _ := ctx.DereferenceDict(resources[category])
+	if d == nil {
+		return nil
+	}
+	return d[name]
+}
+
+// formResources returns the resources of the form sd, drawn with
+// resources
+func formResources(ctx *model.Context, sd *types.StreamDict, resources types.Dict) types.Dict {
+	if d, _ := ctx.DereferenceDict(sd.Dict["Resources"]); d != nil {
+		return d
+	}
+	return resources
+}
+
+// formBox returns the bounding box of the form sd drawn with ctm, and
+// the matrix of its space
+func formBox(ctx *model.Context, sd *types.StreamDict, ctm matrix.Matrix) (types.Rectangle, matrix.Matrix) {
+	fm := matrix.IdentMatrix
+	if a, _ := ctx.DereferenceArray(sd.Dict["Matrix"]); len(a) == 6 {
+		m := make([]float64, 6)
+		for i, o := range a {
+			m[i], _ = number(ctx, o)
+		}
+		fm = newMatrix(m)
+	}
+	fctm := fm.Multiply(ctm)
+	bbox := []float64{-1e6, -1e6, 1e6, 1e6}
+	if a, _ := ctx.DereferenceArray(sd.Dict["BBox"]); len(a) == 4 {
+		for i, o := range a {
+			bbox[i], _ = number(ctx, o)
+		}
+	}
+	return transformBox(fctm, bbox[0], bbox[1], bbox[2], bbox[3]), fctm
+}
+
+// walk walks ops drawn with resources, starting with ctm
+func (w *contentWalker) walk(ops []contentOp, resources types.Dict, ctm matrix.Matrix) {
+	gs := graphicsState{ctm: ctm, font: loadFont(w.ctx, nil), scale: 1, lineWidth: 1}
+	stack := []graphicsState{}
+	tm, tlm := matrix.IdentMatrix, matrix.IdentMatrix
+	fonts := map[string]*pdfFont{}
+	marked := []bool{} // whether each open marked content is skipped
+	skipping := func() bool { return len(marked) > 0 && marked[len(marked)-1] }
+
+	pathFrom := -1
+	var pathBox types.Rectangle
+	var rects []types.Rectangle
+	rectsOnly, clip := true, false
+	addPoint := func(i int, x, y float64) {
+		p := gs.ctm.Transform(types.Point{X: x, Y: y})
+		if pathFrom < 0 {
+			pathFrom = i
+			pathBox = types.Rectangle{LL: p, UR: p}
+			rects, rectsOnly, clip = nil, true, false
+		}
+		pathBox = extendBox(pathBox, p)
+	}
+
+	show := func(i int, elems []token) {
+		glyphs := []glyph{}
+		for k, e := range elems {
+			if e.kind == tokNumber {
+				tm = translate(-e.num/1000*gs.size*gs.scale, 0).Multiply(tm)
+				continue
+			}
+			if e.kind != tokString {
+				continue
+			}
+			f := gs.font
+			for _, c := range f.codes(e.str) {
+				w0 := f.width(c.code)
+				trm := matrix.Matrix{{gs.size * gs.scale, 0, 0}, {0, gs.size, 0}, {0, gs.rise, 1}}.Multiply(tm).Multiply(gs.ctm)
+				advance := w0*gs.size + gs.charSpace
+				if !f.twoByte && c.code == ' ' {
+					advance += gs.wordSpace
+				}
+				g := glyph{elem: k, lo: c.lo, hi: c.hi, text: f.text(c.code), unknown: f.unmapped(c.code), size: gs.size, advance: advance}
+				g.box = transformBox(trm, 0, f.descent, w0, f.ascent)
+				g.from = trm.Transform(types.Point{})
+				g.to = trm.Transform(types.Point{X: w0})
+				up := trm.Transform(types.Point{Y: 1})
+				g.height = math.Hypot(up.X-g.from.X, up.Y-g.from.Y)
+				glyphs = append(glyphs, g)
+				tm = translate(advance*gs.scale, 0).Multiply(tm)
+			}
+		}
+		if w.text != nil && !skipping() && len(glyphs) > 0 {
+			w.text(i, glyphs)
+		}
+	}
+	nextLine := func(tx, ty float64) {
+		tlm = translate(tx, ty).Multiply(tlm)
+		tm = tlm
+	}
+
+	for i, op := range ops {
+		switch op.name {
+		case "q":
+			stack = append(stack, gs)
+		case "Q":
+			if len(stack) > 0 {
+				gs, stack = stack[len(stack)-1], stack[:len(stack)-1]
+			}
+		case "cm":
+			if m := op.numbers(6); m != nil {
+				gs.ctm = newMatrix(m).Multiply(gs.ctm)
+			}
+		case "w":
+			if n := op.numbers(1); n != nil {
+				gs.lineWidth = n[0]
+			}
+		case "BMC", "BDC":
+			tag := ""
+			if len(op.operands) > 0 {
+				tag = string(op.operands[0].str)
+			}
+			marked = append(marked, skipping() || w.skip != "" && tag == w.skip)
+		case "EMC":
+			if len(marked) > 0 {
+				marked = marked[:len(marked)-1]
+			}
+
+		case "BT":
+			tm, tlm = matrix.IdentMatrix, matrix.IdentMatrix
+		case "Tc":
+			if n := op.numbers(1); n != nil {
+				gs.charSpace = n[0]
+			}
+		case "Tw":
+			if n := op.numbers(1); n != nil {
+				gs.wordSpace = n[0]
+			}
+		case "Tz":
+			if n := op.numbers(1); n != nil {
+				gs.scale = n[0] / 100
+			}
+		case "TL":
+			if n := op.numbers(1); n != nil {
+				gs.leading = n[0]
+			}
+		case "Ts":
+			if n := op.numbers(1); n != nil {
+				gs.rise = n[0]
+			}
+		case "Tf":
+			if n := op.numbers(1); n != nil && len(op.operands) == 2 {
+				name := string(op.operands[0].str)
+				f, ok := fonts[name]
+				if !ok {
+					d, _ := w.ctx.DereferenceDict(resource(w.ctx, resources, "Font", name))
+					f = loadFont(w.ctx, d)
+					fonts[name] = f
+				}
+				gs.font, gs.size = f, n[0]
+			}
+		case "Td", "TD":
+			if n := op.numbers(2); n != nil {
+				if op.name == "TD" {
+					gs.leading = -n[1]
+				}
+				nextLine(n[0], n[1])
+			}
+		case "Tm":
+			if m := op.numbers(6); m != nil {
+				tlm = newMatrix(m)
+				tm = tlm
+			}
+		case "T*":
+			nextLine(0, -gs.leading)
+		case "Tj", "'", "\"":
+			if op.name == "\"" && len(op.operands) == 3 && op.operands[0].kind == tokNumber && op.operands[1].kind == tokNumber {
+				gs.wordSpace, gs.charSpace = op.operands[0].num, op.operands[1].num
+			}
+			if op.name != "Tj" {
+				nextLine(0, -gs.leading)
+			}
+			if s, ok := op.operand(tokString); ok {
+				show(i, []token{s})
+			}
+		case "TJ":
+			if a, ok := op.operand(tokArray); ok {
+				show(i, a.elems)
+			}
+
+		case "m", "l":
+			if n := op.numbers(2); n != nil {
+				addPoint(i, n[0], n[1])
+			}
+		case "c", "v", "y":
+			n := op.numbers(4)
+			if op.name == "c" {
+				n = op.numbers(6)
+			}
+			for j := 0; j+1 < len(n); j += 2 {
+				addPoint(i, n[j], n[j+1])
+			}
+			rectsOnly = false
+		case "re":
+			if n := op.numbers(4); n != nil {
+				addPoint(i, n[0], n[1])
+				addPoint(i, n[0]+n[2], n[1]+n[3])
+				addPoint(i, n[0]+n[2], n[1])
+				addPoint(i, n[0], n[1]+n[3])
+				if axisAligned(gs.ctm) {
+					rects = append(rects, transformBox(gs.ctm, n[0], n[1], n[0]+n[2], n[1]+n[3]))
+				} else {
+					rectsOnly = false
+				}
+			}
+		case "h":
+		case "W", "W*":
+			clip = true
+		case "S", "s", "f", "F", "f*", "B", "B*", "b", "b*", "n":
+			if pathFrom < 0 {
+				continue
+			}
+			box := pathBox
+			switch op.name {
+			case "S", "s", "B", "B*", "b", "b*":
+				// strokes reach half the line width beyond the path
+				hw := math.Max(gs.lineWidth, 1) / 2 * math.Sqrt(math.Abs(gs.ctm[0][0]*gs.ctm[1][1]-gs.ctm[0][1]*gs.ctm[1][0]))
+				box = types.Rectangle{LL: types.Point{X: box.LL.X - hw, Y: box.LL.Y - hw}, UR: types.Point{X: box.UR.X + hw, Y: box.UR.Y + hw}}
+				rectsOnly = false
+			case "n":
+				rectsOnly = false
+			}
+			if !rectsOnly {
+				rects = nil
+			}
+			if w.path != nil && !skipping() {
+				w.path(pathFrom, i, box, rects, clip, gs.ctm)
+			}
+			pathFrom = -1
+
+		case "BI":
+			if w.image != nil && !skipping() {
+				w.image(i, transformBox(gs.ctm, 0, 0, 1, 1), "", nil, gs.ctm)
+			}
+		case "Do":
+			t, ok := op.operand(tokName)
+			if !ok || skipping() {
+				continue
+			}
+			name := string(t.str)
+			sd, _, _ := w.ctx.DereferenceStreamDict(resource(w.ctx, resources, "XObject", name))
+			if sd == nil {
+				continue
+			}
+			switch s := sd.Dict.NameEntry("Subtype"); {
+			case s != nil && *s == "Image" && w.image != nil:
+				w.image(i, transformBox(gs.ctm, 0, 0, 1, 1), name, sd, gs.ctm)
+			case s != nil && *s == "Form" && w.form != nil:
+				box, fctm := formBox(w.ctx, sd, gs.ctm)
+				w.form(i, box, name, sd, fctm)
+			}
+		}
+	}
+}
+
+// maxFormDepth limits the nesting of forms followed by walkGlyphs
+const maxFormDepth = 16
+
+// walkGlyphs calls fn on the glyphs shown by content, and the forms it
+// draws, passing over marked content tagged skip
+func walkGlyphs(ctx *model.Context, content []byte, resources types.Dict, ctm matrix.Matrix, skip string, fn func(glyph)) error {
+	return walkGlyphsDepth(ctx, content, resources, ctm, skip, fn, 0)
+}
+
+func walkGlyphsDepth(ctx *model.Context, content []byte, resources types.Dict, ctm matrix.Matrix, skip string, fn func(glyph), depth int) error {
+	ops, err := parseContent(content)
+	if err != nil {
+		return err
+	}
+	var formErr error
+	w := &contentWalker{ctx: ctx, skip: skip}
+	w.text = func(i int, glyphs []glyph) {
+		for _, g := range glyphs {
+			fn(g)
+		}
+	}
+	w.form = func(i int, box types.Rectangle, name string, sd *types.StreamDict, fctm matrix.Matrix) {
+		if depth >= maxFormDepth || formErr != nil {
+			return
+		}
+		if err := sd.Decode(); err != nil {
+			formErr = err
+			return
+		}
+		formErr = walkGlyphsDepth(ctx, sd.Content, formResources(ctx, sd, resources), fctm, skip, fn, depth+1)
+	}
+	w.walk(ops, resources, ctm)
+	return formErr
+}
@@ -0,0 +1,77 @@
+package utils
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseContent(t *testing.T) {
+	content := []byte("q 1 0 0 1 72 -7.5 cm % comment\n" +
+		"BT /F1 12 Tf (a\\)b\\101\\\n(c)) Tj <41 42 4> Tj [(x) -20 <79>] TJ ET\n" +
+		"/Span#20A <</MCID 3>> BDC BI /W 1 /H 1 /BPC 8 /CS /G ID \xffEI\xff EI Q EMC")
+	ops, err := parseContent(content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, op := range ops {
+		names = append(names, op.name)
+	}
+	want := []string{"q", "cm", "BT", "Tf", "Tj", "Tj", "TJ", "ET", "BDC", "BI", "Q", "EMC"}
+	if !reflect.DeepEqual(names, want) {
+		t.Fatalf("parseContent() = %v, want %v", names, want)
+	}
+	if got := ops[1].numbers(6); !reflect.DeepEqual(got, []float64{1, 0, 0, 1, 72, -7.5}) {
+		t.Errorf("cm operands = %v", got)
+	}
+	if got := string(ops[4].operands[0].str); got != "a)bA(c)" {
+		t.Errorf("literal string = %q, want %q", got, "a)bA(c)")
+	}
+	if got := ops[5].operands[0].str; !reflect.DeepEqual(got, []byte{0x41, 0x42, 0x40}) {
+		t.Errorf("hex string = %x, want 414240", got)
+	}
+	if tj := ops[6].operands[0]; len(tj.elems) != 3 || tj.elems[1].num != -20 || string(tj.elems[2].str) != "y" {
+		t.Errorf("TJ array = %+v", tj)
+	}
+	if got := string(ops[8].operands[0].str); got != "Span A" {
+		t.Errorf("name = %q, want %q", got, "Span A")
+	}
+	if got := string(ops[9].raw); got != " BI /W 1 /H 1 /BPC 8 /CS /G ID \xffEI\xff EI" {
+		t.Errorf("inline image = %q", got)
+	}
+
+	// unchanged operators are written back as they were
+	raw := []byte{}
+	for _, op := range ops {
+		raw = append(raw, op.raw...)
+	}
+	if string(raw) != string(content) {
+		t.Errorf("raw operators = %q, want %q", raw, content)
+	}
+
+	for _, bad := range []string{"(unterminated Tj", "[1 2 Tj", "q ] Q"} {
+		if _, err := parseContent([]byte(bad)); err == nil {
+			t.Errorf("parseContent(%q) succeeded", bad)
+		}
+	}
+}
+
+func TestParseToUnicode(t *testing.T) {
+	cmap := []byte(`/CIDInit /ProcSet findresource begin
+12 dict begin begincmap
+1 begincodespacerange <0000> <FFFF> endcodespacerange
+2 beginbfchar <0003> <0020> <0011> <D83DDE00> endbfchar
+2 beginbfrange <0024> <0026> <0041> <0030> <0031> [<0066006C> <00E9>] endbfrange
+endcmap end end`)
+	got := parseToUnicode(cmap)
+	want := map[int]string{0x03: " ", 0x11: "😀", 0x24: "A", 0x25: "B", 0x26: "C", 0x30: "fl", 0x31: "é"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseToUnicode() = %v, want %v", got, want)
+	}
+}
+
+func TestWinAnsiBytes(t *testing.T) {
+	if got, want := winAnsiBytes("REDACTED – PRIVILEGE ✓"), []byte("REDACTED \x96 PRIVILEGE ?"); !reflect.DeepEqual(got, want) {
+		t.Errorf("winAnsiBytes() = %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,451 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+	"golang.org/x/image/tiff"
+)
+
+// ConvertOptions are the options of ImagesToPDF
+type ConvertOptions struct {
+	// PageSize is "letter" or "a4" to fit each image to a page of that
+	// size, turned to landscape for wide images, or "native" for pages
+	// the size of the images at their resolution
+	PageSize string
+	// DPI is the resolution of the images in dots per inch, or 0 for the
+	// resolution recorded in each image (72 where none is)
+	DPI float64
+}
+
+// DefaultConvertOptions returns the options fitting images to Letter pages
+func DefaultConvertOptions() ConvertOptions {
+	return ConvertOptions{PageSize: "letter"}
+}
+
+// convertPageSizes are the page sizes, in points, that images are fit to
+var convertPageSizes = map[string]types.Dim{
+	"letter": {Width: 612, Height: 792},
+	"a4":     {Width: 595.28, Height: 841.89},
+}
+
+// defaultDPI is the resolution of images that do not record one
+const defaultDPI = 72
+
+// IsImage reports whether the file named name is, by its extension, an
+// image that ImagesToPDF converts
+func IsImage(name string) bool {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".tif", ".tiff":
+		return true
+	}
+	return false
+}
+
+// imageFormat returns the format of the image b, by its signature:
+// "jpeg", "png", "tiff" or "" if unknown
+func imageFormat(b []byte) string {
+	switch {
+	case bytes.HasPrefix(b, []byte("\xff\xd8")):
+		return "jpeg"
+	case bytes.HasPrefix(b, []byte("\x89PNG\r\n\x1a\n")):
+		return "png"
+	case bytes.HasPrefix(b, []byte("II*\x00")), bytes.HasPrefix(b, []byte("MM\x00*")):
+		return "tiff"
+	}
+	return ""
+}
+
+// imageInfo is what an image file records of how it is displayed
+type imageInfo struct {
+	dpiX, dpiY  float64 // 0 where not recorded
+	orientation int     // Exif orientation, 1 (upright) to 8
+}
+
+// tiffFile is a TIFF file, or the TIFF structure of Exif data, read far
+// enough to find its pages
+type tiffFile struct {
+	b     []byte
+	order binary.ByteOrder
+	ifds  []uint32 // offsets of the image file directory of each page
+}
+
+// readTIFF reads the TIFF structure of b, finding the directory of each
+// page or, unless all, only of the first
+func readTIFF(b []byte, all bool) (*tiffFile, error) {
+	if len(b) < 8 {
+		return nil, fmt.Errorf("TIFF header is truncated")
+	}
+	t := &tiffFile{b: b}
+	switch string(b[:2]) {
+	case "II":
+		t.order = binary.LittleEndian
+	case "MM":
+		t.order = binary.BigEndian
+	default:
+		return nil, fmt.Errorf("TIFF header is malformed")
+	}
+	if t.order.Uint16(b[2:]) != 42 {
+		return nil, fmt.Errorf("TIFF header is malformed")
+	}
+	seen := map[uint32]bool{}
+	for off := t.order.Uint32(b[4:]); off != 0 && !seen[off]; {
+		if int64(off)+2 > int64(len(b)) {
+			return nil, fmt.Errorf("TIFF directory at %d is out of bounds", off)
+		}
+		end := int64(off) + 2 + 12*int64(t.order.Uint16(b[off:]))
+		if end+4 > int64(len(b)) {
+			return nil, fmt.Errorf("TIFF directory at %d is truncated", off)
+		}
+		seen[off] = true
+		t.ifds = append(t.ifds, off)
+		if !all {
+			break
+		}
+		off = t.order.Uint32(b[end:])
+	}
+	if len(t.ifds) == 0 {
+		return nil, fmt.Errorf("TIFF has no pages")
+	}
+	return t, nil
+}
+
+// field returns the first value of the numeric field tag of the
+// directory at ifd
+func (t *tiffFile) field(ifd uint32, tag uint16) (float64, bool) {
+	b := t.b
+	n := int64(t.order.Uint16(b[ifd:]))
+	for i := int64(0); i < n; i++ {
+		e := int64(ifd) + 2 + 12*i
+		if t.order.Uint16(b[e:]) != tag {
+			continue
+		}
+		switch t.order.Uint16(b[e+2:]) {
+		case 3: // SHORT
+			return float64(t.order.Uint16(b[e+8:])), true
+		case 4: // LONG
+			return float64(t.order.Uint32(b[e+8:])), true
+		case 5: // RATIONAL
+			off := int64(t.order.Uint32(b[e+8:]))
+			if off+8 > int64(len(b)) {
+				return 0, false
+			}
+			num, den := t.order.Uint32(b[off:]), t.order.Uint32(b[off+4:])
+			if den == 0 {
+				return 0, false
+			}
+			return float64(num) / float64(den), true
+		}
+		return 0, false
+	}
+	return 0, false
+}
+
+// info returns the resolution and orientation recorded in the directory
+// at ifd
+func (t *tiffFile) info(ifd uint32) imageInfo {
+	info := imageInfo{orientation: 1}
+	if o, ok := t.field(ifd, 274); ok && o >= 1 && o <= 8 {
+		info.orientation = int(o)
+	}
+	x, okX := t.field(ifd, 282)
+	y, okY := t.field(ifd, 283)
+	unit, ok := t.field(ifd, 296)
+	if !ok {
+		unit = 2
+	}
+	if okX && okY && (unit == 2 || unit == 3) {
+		if unit == 3 { // per centimeter
+			x, y = x*2.54, y*2.54
+		}
+		info.dpiX, info.dpiY = x, y
+	}
+	return info
+}
+
+// jpegInfo returns the resolution recorded in the JFIF or Exif header of
+// the JPEG image b, and the orientation recorded in its Exif header
+func jpegInfo(b []byte) imageInfo {
+	info := imageInfo{orientation: 1}
+	jfif := false
+	for i := 2; i+4 <= len(b) && b[i] == 0xff; {
+		marker := b[i+1]
+		if marker == 0xff || marker == 0x01 || (marker >= 0xd0 && marker <= 0xd8) {
+			i++
+			if marker != 0xff {
+				i++
+			}
+			continue
+		}
+		if marker == 0xda || marker == 0xd9 { // image data
+			break
+		}
+		end := i + 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if end > len(b) {
+			break
+		}
+		seg := b[i+4 : end]
+		switch {
+		case marker == 0xe0 && len(seg) >= 12 && bytes.HasPrefix(seg, []byte("JFIF\x00")):
+			x, y := float64(binary.BigEndian.Uint16(seg[8:])), float64(binary.BigEndian.Uint16(seg[10:]))
+			if x > 0 && y > 0 && (seg[7] == 1 || seg[7] == 2) {
+				if seg[7] == 2 { // per centimeter
+					x, y = x*2.54, y*2.54
+				}
+				info.dpiX, info.dpiY = x, y
+				jfif = true
+			}
+		case marker == 0xe1 && bytes.HasPrefix(seg, []byte("Exif\x00\x00")):
+			t, err := readTIFF(seg[6:], false)
+			if err != nil {
+				break
+			}
+			exif := t.info(t.ifds[0])
+			info.orientation = exif.orientation
+			if !jfif {
+				info.dpiX, info.dpiY = exif.dpiX, exif.dpiY
+			}
+		}
+		i = end
+	}
+	return info
+}
+
+// pngInfo returns the resolution recorded in the pHYs chunk of the PNG
+// image b
+func pngInfo(b []byte) imageInfo {
+	info := imageInfo{orientation: 1}
+	for i := 8; i+8 <= len(b); {
+		n := int(binary.BigEndian.Uint32(b[i:]))
+		kind := string(b[i+4 : i+8])
+		if kind == "IDAT" || n < 0 || i+8+n > len(b) {
+			break
+		}
+		if kind == "pHYs" && n >= 9 && b[i+16] == 1 { // per meter
+			info.dpiX = float64(binary.BigEndian.Uint32(b[i+8:])) * 0.0254
+			info.dpiY = float64(binary.BigEndian.Uint32(b[i+12:])) * 0.0254
+		}
+		i += 12 + n
+	}
+	return info
+}
+
+// ImagePageCount returns the number of pages of the image r: of a TIFF,
+// its pages, and of a JPEG or PNG, 1
+func ImagePageCount(r io.Reader) (int, error) {
+	const op = "page count"
+	b, err := io.ReadAll(r)
+	if err != nil {
+		return 0, err
+	}
+	switch imageFormat(b) {
+	case "tiff":
+		t, err := readTIFF(b, true)
+		if err != nil {
+			return 0, &Error{Op: op, Kind: ErrNotImage, Err: err}
+		}
+		return len(t.ifds), nil
+	case "jpeg", "png":
+		if _, _, err := image.DecodeConfig(bytes.NewReader(b)); err != nil {
+			return 0, &Error{Op: op, Kind: ErrNotImage, Err: err}
+		}
+		return 1, nil
+	}
+	return 0, &Error{Op: op, Kind: ErrNotImage}
+}
+
+// ImagesToPDF writes to w a PDF of the images, JPEG, PNG or TIFF, with
+// a page for each image and for each page of a multipage TIFF. Each
+// image is fit to the page, centered, or gives the page its size,
+// according to opts.PageSize, and is turned upright as its Exif
+// orientation records.
+func ImagesToPDF(images []io.Reader, w io.Writer, opts ConvertOptions) (err error) {
+	const op = "convert"
+	defer recoverCorrupt(op, &err)
+
+	opts.PageSize = strings.ToLower(opts.PageSize)
+	if _, ok := convertPageSizes[opts.PageSize]; !ok && opts.PageSize != "native" {
+		return optionErr(op, fmt.Errorf("unknown page size `%s` (expected letter, a4 or native)", opts.PageSize))
+	}
+	if opts.DPI < 0 {
+		return optionErr(op, fmt.Errorf("DPI must not be negative"))
+	}
+	if len(images) == 0 {
+		return optionErr(op, fmt.Errorf("no images given"))
+	}
+
+	p, err := newPageBuilder(convertPageSizes["letter"].Width, convertPageSizes["letter"].Height)
+	if err != nil {
+		return err
+	}
+	for n, r := range images {
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		imageErr := func(err error) error {
+			return &Error{Op: op, Kind: ErrNotImage, Err: fmt.Errorf("image %d: %w", n+1, err)}
+		}
+		switch imageFormat(b) {
+		case "tiff":
+			t, err := readTIFF(b, true)
+			if err != nil {
+				return imageErr(err)
+			}
+			// the pages are decoded in turn by pointing the header at
+			// their directory
+			b = append([]byte{}, b...)
+			for _, ifd := range t.ifds {
+				t.order.PutUint32(b[4:], ifd)
+				img, err := tiff.Decode(bytes.NewReader(b))
+				if err != nil {
+					return imageErr(err)
+				}
+				ir, err := imageObject(p.ctx, img)
+				if err != nil {
+					return err
+				}
+				size := img.Bounds().Size()
+				if err := addImagePage(p, *ir, size.X, size.Y, t.info(ifd), opts); err != nil {
+					return err
+				}
+			}
+		case "jpeg", "png":
+			info := pngInfo(b)
+			if imageFormat(b) == "jpeg" {
+				info = jpegInfo(b)
+			}
+			ir, width, height, err := model.CreateImageResource(p.ctx.XRefTable, bytes.NewReader(b), false, false)
+			if err != nil {
+				return imageErr(err)
+			}
+			if err := addImagePage(p, *ir, width, height, info, opts); err != nil {
+				return err
+			}
+		default:
+			return imageErr(fmt.Errorf("unknown format"))
+		}
+	}
+	return p.write(w)
+}
+
+// addImagePage adds to p a page showing the image XObject ir, width by
+// height pixels, as ImagesToPDF does
+func addImagePage(p *pageBuilder, ir types.IndirectRef, width, height int, info imageInfo, opts ConvertOptions) error {
+	dpiX, dpiY := info.dpiX, info.dpiY
+	if opts.DPI > 0 {
+		dpiX, dpiY = opts.DPI, opts.DPI
+	}
+	if dpiX <= 0 || dpiY <= 0 {
+		dpiX, dpiY = defaultDPI, defaultDPI
+	}
+	// the size of the image upright, in points
+	w, h := float64(width)*72/dpiX, float64(height)*72/dpiY
+	if info.orientation >= 5 {
+		w, h = h, w
+	}
+
+	pageW, pageH, x, y := w, h, 0.0, 0.0
+	if opts.PageSize != "native" {
+		page := convertPageSizes[opts.PageSize]
+		pageW, pageH = page.Width, page.Height
+		if w > h {
+			pageW, pageH = pageH, pageW
+		}
+		scale := pageW / w
+		if s := pageH / h; s < scale {
+			scale = s
+		}
+		w, h = w*scale, h*scale
+		x, y = (pageW-w)/2, (pageH-h)/2
+	}
+
+	// the image space, a unit square with the first row at its top, is
+	// mapped to the box w by h at x, y, turned as the orientation records
+	m := map[int][6]float64{
+		1: {w, 0, 0, h, 0, 0},
+		2: {-w, 0, 0, h, w, 0},
+		3: {-w, 0, 0, -h, w, h},
+		4: {w, 0, 0, -h, 0, h},
+		5: {0, -h, -w, 0, w, h},
+		6: {0, -h, w, 0, 0, h},
+		7: {0, h, w, 0, 0, 0},
+		8: {0, h, -w, 0, w, 0},
+	}[info.orientation]
+	m[4] += x
+	m[5] += y
+	nums := make([]string, len(m))
+	for i, n := range m {
+		nums[i] = formatNumber(n)
+	}
+	content := fmt.Sprintf("q %s cm /Im0 Do Q\n", strings.Join(nums, " "))
+	resources := types.Dict{"XObject": types.Dict{"Im0": ir}}
+	return p.addPage([]byte(content), resources, types.NewRectangle(0, 0, pageW, pageH))
+}
+
+// imageObject adds to ctx an image XObject of img, decoded from a TIFF:
+// black and white images (such as fax-compressed scans) with a bit per
+// pixel, other grayscale images with a byte per pixel, and color images
+// as RGB over a white background
+func imageObject(ctx *model.Context, img image.Image) (*types.IndirectRef, error) {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	var buf []byte
+	colorSpace, bpc := "DeviceRGB", 8
+
+	gray, ok := img.(*image.Gray)
+	bilevel := ok
+	for i := 0; bilevel && i < len(gray.Pix); i++ {
+		bilevel = gray.Pix[i] == 0 || gray.Pix[i] == 0xff
+	}
+	switch {
+	case bilevel:
+		colorSpace, bpc = "DeviceGray", 1
+		stride := (width + 7) / 8
+		buf = make([]byte, stride*height)
+		for y := 0; y < height; y++ {
+			row := gray.Pix[y*gray.Stride : y*gray.Stride+width]
+			for x, c := range row {
+				if c != 0 {
+					buf[y*stride+x/8] |= 0x80 >> (x % 8)
+				}
+			}
+		}
+	case ok:
+		colorSpace = "DeviceGray"
+		buf = make([]byte, 0, width*height)
+		for y := 0; y < height; y++ {
+			buf = append(buf, gray.Pix[y*gray.Stride:y*gray.Stride+width]...)
+		}
+	default:
+		buf = make([]byte, 0, 3*width*height)
+		for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+			for x := bounds.Min.X; x < bounds.Max.X; x++ {
+				r, g, b, a := img.At(x, y).RGBA()
+				buf = append(buf, byte((r+0xffff-a)>>8), byte((g+0xffff-a)>>8), byte((b+0xffff-a)>>8))
+			}
+		}
+	}
+
+	sd, err := ctx.NewStreamDictForBuf(buf)
+	if err != nil {
+		return nil, err
+	}
+	sd.InsertName("Type", "XObject")
+	sd.InsertName("Subtype", "Image")
+	sd.InsertInt("Width", width)
+	sd.InsertInt("Height", height)
+	sd.InsertName("ColorSpace", colorSpace)
+	sd.InsertInt("BitsPerComponent", bpc)
+	if err := sd.Encode(); err != nil {
+		return nil, err
+	}
+	return ctx.IndRefForNewObject(*sd)
+}
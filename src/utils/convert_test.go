@@ -0,0 +1,262 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// testImage returns a width by height image, black on its left half and
+// white on its right
+func testImage(width, height int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := width / 2; x < width; x++ {
+			img.SetGray(x, y, color.Gray{Y: 0xff})
+		}
+	}
+	return img
+}
+
+// testPNG returns a width by height PNG recording dpi, if not 0
+func testPNG(width, height int, dpi float64) []byte {
+	var b bytes.Buffer
+	png.Encode(&b, testImage(width, height))
+	if dpi == 0 {
+		return b.Bytes()
+	}
+	// the pHYs chunk follows the IHDR chunk
+	chunk := make([]byte, 21)
+	binary.BigEndian.PutUint32(chunk, 9)
+	copy(chunk[4:], "pHYs")
+	ppm := uint32(math.Round(dpi / 0.0254))
+	binary.BigEndian.PutUint32(chunk[8:], ppm)
+	binary.BigEndian.PutUint32(chunk[12:], ppm)
+	chunk[16] = 1
+	binary.BigEndian.PutUint32(chunk[17:], crc32.ChecksumIEEE(chunk[4:17]))
+	p := b.Bytes()
+	return append(append(append([]byte{}, p[:33]...), chunk...), p[33:]...)
+}
+
+// testJPEG returns a width by height JPEG recording the Exif orientation
+func testJPEG(width, height int, orientation uint16) []byte {
+	var b bytes.Buffer
+	jpeg.Encode(&b, testImage(width, height), nil)
+	exif := []byte("Exif\x00\x00II*\x00\x08\x00\x00\x00\x01\x00\x12\x01\x03\x00\x01\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00\x00")
+	binary.LittleEndian.PutUint16(exif[24:], orientation)
+	segment := []byte{0xff, 0xe1, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(exif)+2))
+	j := b.Bytes()
+	return append(append(append(append([]byte{}, j[:2]...), segment...), exif...), j[2:]...)
+}
+
+// testTIFF returns an uncompressed black and white TIFF of pages width by
+// height pixels at dpi
+func testTIFF(pages int, width, height int, dpi uint32) []byte {
+	order := binary.LittleEndian
+	b := []byte("II*\x00\x00\x00\x00\x00")
+	next := 4 // offset of the offset of the next directory
+	stride := (width + 7) / 8
+	app16 := func(v uint16) {
+		b = append(b, 0, 0)
+		order.PutUint16(b[len(b)-2:], v)
+	}
+	app32 := func(v uint32) {
+		b = append(b, 0, 0, 0, 0)
+		order.PutUint32(b[len(b)-4:], v)
+	}
+	for i := 0; i < pages; i++ {
+		strip := len(b)
+		b = append(b, make([]byte, stride*height)...)
+		for y := 0; y < height; y++ {
+			b[strip+y*stride] = 0xff // left 8 pixels black
+		}
+		res := len(b)
+		app32(dpi)
+		app32(1)
+		order.PutUint32(b[next:], uint32(len(b)))
+		fields := [][3]uint32{
+			{256, 4, uint32(width)},
+			{257, 4, uint32(height)},
+			{258, 3, 1},
+			{259, 3, 1},
+			{262, 3, 0}, // white is zero
+			{273, 4, uint32(strip)},
+			{278, 4, uint32(height)},
+			{279, 4, uint32(stride * height)},
+			{282, 5, uint32(res)},
+			{283, 5, uint32(res)},
+			{296, 3, 2},
+		}
+		app16(uint16(len(fields)))
+		for _, f := range fields {
+			app16(uint16(f[0]))
+			app16(uint16(f[1]))
+			app32(1)
+			app32(f[2]) // a SHORT is in the first two bytes
+		}
+		next = len(b)
+		app32(0)
+	}
+	return b
+}
+
+func TestImagesToPDF(t *testing.T) {
+	tests := []struct {
+		name     string
+		images   [][]byte
+		pageSize string
+		dpi      float64
+		want     []types.Dim
+		bpc      int
+	}{
+		{"wide png fit to letter", [][]byte{testPNG(200, 100, 0)}, "letter", 0, []types.Dim{{Width: 792, Height: 612}}, 8},
+		{"png at its resolution", [][]byte{testPNG(200, 100, 100)}, "native", 0, []types.Dim{{Width: 144, Height: 72}}, 8},
+		{"png at given resolution", [][]byte{testPNG(200, 100, 100)}, "native", 50, []types.Dim{{Width: 288, Height: 144}}, 8},
+		{"rotated jpeg", [][]byte{testJPEG(100, 50, 6)}, "native", 0, []types.Dim{{Width: 50, Height: 100}}, 8},
+		{"tall jpeg fit to a4", [][]byte{testJPEG(50, 100, 1)}, "A4", 0, []types.Dim{{Width: 595.28, Height: 841.89}}, 8},
+		{"multipage tiff", [][]byte{testTIFF(3, 400, 200, 200)}, "native", 0, []types.Dim{{Width: 144, Height: 72}, {Width: 144, Height: 72}, {Width: 144, Height: 72}}, 1},
+		{"several images", [][]byte{testTIFF(2, 16, 16, 72), testPNG(10, 10, 0)}, "letter", 0, []types.Dim{{Width: 612, Height: 792}, {Width: 612, Height: 792}, {Width: 612, Height: 792}}, 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readers := []io.Reader{}
+			for _, img := range tt.images {
+				readers = append(readers, bytes.NewReader(img))
+			}
+			var b bytes.Buffer
+			if err := ImagesToPDF(readers, &b, ConvertOptions{PageSize: tt.pageSize, DPI: tt.dpi}); err != nil {
+				t.Fatal(err)
+			}
+			ctx := readTestPDF(t, b.Bytes())
+			if err := api.ValidateContext(ctx); err != nil {
+				t.Fatal(err)
+			}
+			dims, err := ctx.PageDims()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dims) != len(tt.want) {
+				t.Fatalf("page count = %d, want %d", len(dims), len(tt.want))
+			}
+			for i, d := range dims {
+				if math.Abs(d.Width-tt.want[i].Width) > 0.1 || math.Abs(d.Height-tt.want[i].Height) > 0.1 {
+					t.Errorf("page %d is %gx%g, want %gx%g", i+1, d.Width, d.Height, tt.want[i].Width, tt.want[i].Height)
+				}
+			}
+
+			d, _, _, err := ctx.PageDict(1, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			sd, _, err := ctx.DereferenceStreamDict(d.DictEntry("Resources").DictEntry("XObject")["Im0"])
+			if err != nil || sd == nil {
+				t.Fatalf("page 1 has no image: %v", err)
+			}
+			if bpc := sd.IntEntry("BitsPerComponent"); bpc == nil || *bpc != tt.bpc {
+				t.Errorf("BitsPerComponent = %v, want %d", bpc, tt.bpc)
+			}
+		})
+	}
+}
+
+func TestImagesToPDFLayout(t *testing.T) {
+	tests := []struct {
+		name     string
+		image    []byte
+		pageSize string
+		want     string
+	}{
+		{"fit and centered", testPNG(100, 100, 0), "letter", "q 612 0 0 612 0 90 cm /Im0 Do Q"},
+		{"native", testPNG(100, 50, 0), "native", "q 100 0 0 50 0 0 cm /Im0 Do Q"},
+		{"turned clockwise", testJPEG(100, 50, 6), "native", "q 0 -100 50 0 0 100 cm /Im0 Do Q"},
+		{"turned counterclockwise", testJPEG(100, 50, 8), "native", "q 0 100 -50 0 50 0 cm /Im0 Do Q"},
+		{"upside down", testJPEG(100, 50, 3), "native", "q -100 0 0 -50 100 50 cm /Im0 Do Q"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := ImagesToPDF([]io.Reader{bytes.NewReader(tt.image)}, &b, ConvertOptions{PageSize: tt.pageSize}); err != nil {
+				t.Fatal(err)
+			}
+			_, content := pageText(t, readTestPDF(t, b.Bytes()))
+			if got := strings.TrimSpace(content); got != tt.want {
+				t.Errorf("page content = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestImagesToPDFErrors(t *testing.T) {
+	truncated := testTIFF(2, 16, 16, 72)
+	truncated = truncated[:len(truncated)-20]
+	tests := []struct {
+		name   string
+		images [][]byte
+		opts   ConvertOptions
+		want   error
+	}{
+		{"unknown page size", [][]byte{testPNG(10, 10, 0)}, ConvertOptions{PageSize: "legal"}, ErrInvalidOption},
+		{"negative dpi", [][]byte{testPNG(10, 10, 0)}, ConvertOptions{PageSize: "native", DPI: -1}, ErrInvalidOption},
+		{"no images", nil, DefaultConvertOptions(), ErrInvalidOption},
+		{"not an image", [][]byte{testPDF(1)}, DefaultConvertOptions(), ErrNotImage},
+		{"truncated tiff", [][]byte{truncated}, DefaultConvertOptions(), ErrNotImage},
+		{"corrupt png", [][]byte{testPNG(10, 10, 0)[:40]}, DefaultConvertOptions(), ErrNotImage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			readers := []io.Reader{}
+			for _, img := range tt.images {
+				readers = append(readers, bytes.NewReader(img))
+			}
+			if err := ImagesToPDF(readers, &bytes.Buffer{}, tt.opts); !errors.Is(err, tt.want) {
+				t.Errorf("ImagesToPDF() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestImagePageCount(t *testing.T) {
+	tests := []struct {
+		name    string
+		image   []byte
+		want    int
+		wantErr bool
+	}{
+		{"tiff", testTIFF(3, 16, 16, 72), 3, false},
+		{"png", testPNG(10, 10, 0), 1, false},
+		{"jpeg", testJPEG(10, 10, 1), 1, false},
+		{"pdf", testPDF(2), 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ImagePageCount(bytes.NewReader(tt.image))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ImagePageCount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ImagePageCount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsImage(t *testing.T) {
+	for name, want := range map[string]bool{"scan.TIF": true, "photo.jpeg": true, "a.png": true, "a.pdf": false, "budget.xlsx": false} {
+		if got := IsImage(name); got != want {
+			t.Errorf("IsImage(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Designations maps documents to their confidentiality designations
+type Designations map[string]string
+
+// ReadDesignations reads a CSV file of documents and their designations,
+// one "filename,designation" record per line. A header row beginning
+// with "file" or "filename" is skipped.
+func ReadDesignations(r io.Reader) (Designations, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	records, err := cr.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	d := Designations{}
+	for i, record := range records {
+		if len(record) == 0 || (len(record) == 1 && record[0] == "") {
+			continue
+		}
+		if i == 0 && (strings.EqualFold(record[0], "file") || strings.EqualFold(record[0], "filename")) {
+			continue
+		}
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expected filename,designation", i+1)
+		}
+		d[record[0]] = record[1]
+	}
+	return d, nil
+}
+
+// For returns the designation of the document at path, matching either
+// the path as given or its base name, or def if it has none
+func (d Designations) For(path string, def string) string {
+	if v, ok := d[path]; ok {
+		return v
+	}
+	if v, ok := d[filepath.Base(path)]; ok {
+		return v
+	}
+	return def
+}
@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadDesignations(t *testing.T) {
+	in := `filename,designation
+contract.pdf,CONFIDENTIAL
+docs/memo.pdf,"HIGHLY CONFIDENTIAL – ATTORNEYS' EYES ONLY"
+`
+	d, err := ReadDesignations(strings.NewReader(in))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"contract.pdf", "CONFIDENTIAL"},
+		{"/tmp/contract.pdf", "CONFIDENTIAL"},
+		{"docs/memo.pdf", "HIGHLY CONFIDENTIAL – ATTORNEYS' EYES ONLY"},
+		{"memo.pdf", "default"},
+		{"other.pdf", "default"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := d.For(tt.path, "default"); got != tt.want {
+				t.Errorf("For() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// Kinds of errors returned by the functions of this package. Callers
+// may test for them with errors.Is.
+var (
+	ErrNotPDF         = errors.New("not a PDF")
+	ErrEncrypted      = errors.New("PDF is encrypted")
+	ErrCorrupt        = errors.New("PDF is corrupt")
+	ErrPageOutOfRange = errors.New("page out of range")
+	ErrInvalidOption  = errors.New("invalid option")
+	ErrNotRedacted    = errors.New("redaction incomplete")
+	ErrNotImage       = errors.New("not a JPEG, PNG or TIFF image")
+)
+
+// Error describes a failure to process a PDF
+type Error struct {
+	Op   string // operation that failed, e.g. "bates stamp"
+	Kind error  // one of the Err* kinds above
+	Err  error  // underlying error, if any
+}
+
+func (e *Error) Error() string {
+	if e.Err == nil {
+		return e.Op + ": " + e.Kind.Error()
+	}
+	return e.Op + ": " + e.Kind.Error() + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is the kind of e
+func (e *Error) Is(target error) bool {
+	return target == e.Kind
+}
+
+// pdfHeader must appear within the first headerWindow bytes of a PDF
+var pdfHeader = []byte("%PDF-")
+
+const headerWindow = 1024
+
+// IsPDF reports whether r begins as a PDF does, with the %PDF- header
+// in its first kilobyte
+func IsPDF(r io.Reader) (bool, error) {
+	head := make([]byte, headerWindow)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	return bytes.Contains(head[:n], pdfHeader), nil
+}
+
+// startxref gives the offset of the last cross-reference section of a PDF
+var startxref = regexp.MustCompile(`startxref\s+(\d+)`)
+
+// encrypted reports whether the trailer of rs, the dictionary of its last
+// cross-reference section, has an Encrypt entry. Only pdfcpu's failures
+// to decrypt are typed, so this tells an encrypted PDF pdfcpu cannot read
+// from a corrupt one.
+func encrypted(rs io.ReadSeeker) bool {
+	end, err := rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return false
+	}
+	tail := int64(headerWindow)
+	if tail > end {
+		tail = end
+	}
+	if _, err := rs.Seek(-tail, io.SeekEnd); err != nil {
+		return false
+	}
+	b, err := io.ReadAll(rs)
+	if err != nil {
+		return false
+	}
+	m := startxref.FindAllSubmatch(b, -1)
+	if len(m) == 0 {
+		return false
+	}
+	off, err := strconv.ParseInt(string(m[len(m)-1][1]), 10, 64)
+	if err != nil || off >= end {
+		return false
+	}
+	if _, err := rs.Seek(off, io.SeekStart); err != nil {
+		return false
+	}
+	if b, err = io.ReadAll(rs); err != nil {
+		return false
+	}
+	// the trailer follows a cross-reference table, or is the dictionary
+	// of a cross-reference stream
+	if i := bytes.Index(b, []byte("trailer")); i >= 0 {
+		b = b[i:]
+	} else if i := bytes.Index(b, []byte("stream")); i >= 0 {
+		b = b[:i]
+	}
+	return bytes.Contains(b, []byte("/Encrypt"))
+}
+
+// readErr returns an *Error of the appropriate kind for err, returned by
+// pdfcpu while reading a PDF
+func readErr(op string, err error) error {
+	var e *Error
+	if errors.As(err, &e) {
+		return err
+	}
+	kind := ErrCorrupt
+	if errors.Is(err, pdfcpu.ErrWrongPassword) || errors.Is(err, pdfcpu.ErrUnknownEncryption) {
+		kind = ErrEncrypted
+	}
+	return &Error{Op: op, Kind: kind, Err: err}
+}
+
+// optionErr returns an *Error of kind ErrInvalidOption for err
+func optionErr(op string, err error) error {
+	return &Error{Op: op, Kind: ErrInvalidOption, Err: err}
+}
+
+// recoverCorrupt turns a panic while processing a malformed PDF into an
+// error of kind ErrCorrupt. It must be deferred.
+func recoverCorrupt(op string, err *error) {
+	if r := recover(); r != nil {
+		*err = &Error{Op: op, Kind: ErrCorrupt, Err: fmt.Errorf("%v", r)}
+	}
+}
+
+// pageCount checks that rs is a readable PDF and returns its page count,
+// leaving rs at its beginning
+func pageCount(op string, rs io.ReadSeeker) (int, error) {
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	ok, err := IsPDF(rs)
+	if err != nil {
+		return 0, err
+	}
+	if !ok {
+		return 0, &Error{Op: op, Kind: ErrNotPDF}
+	}
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	count, err := api.PageCount(rs, nil)
+	if err != nil {
+		if encrypted(rs) {
+			return 0, &Error{Op: op, Kind: ErrEncrypted, Err: err}
+		}
+		return 0, readErr(op, err)
+	}
+	_, err = rs.Seek(0, io.SeekStart)
+	return count, err
+}
+
+// PageCount checks that rs is a readable PDF and returns its page count
+func PageCount(rs io.ReadSeeker) (count int, err error) {
+	const op = "page count"
+	defer recoverCorrupt(op, &err)
+	return pageCount(op, rs)
+}
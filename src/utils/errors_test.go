@@ -0,0 +1,171 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// encryptedPDF returns testPDF(pages) encrypted with the user password
+func encryptedPDF(pages int) []byte {
+	var b bytes.Buffer
+	if err := api.Encrypt(bytes.NewReader(testPDF(pages)), &b, model.NewAESConfiguration("secret", "owner", 256)); err != nil {
+		panic(err)
+	}
+	return b.Bytes()
+}
+
+// unknownEncryptionPDF returns a one-page PDF encrypted, by its
+// trailer, with a security handler pdfcpu does not support
+func unknownEncryptionPDF() []byte {
+	return trailerPDF(1, "<</Filter/Acme/V 9>>", "/Encrypt %d 0 R/ID[<01><01>]")
+}
+
+func TestStampErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		opts func(*WatermarkOptions)
+		want error
+	}{
+		{"not a PDF", "hello, world", func(o *WatermarkOptions) {}, ErrNotPDF},
+		{"corrupt", "%PDF-1.4\n1 0 obj garbage", func(o *WatermarkOptions) {}, ErrCorrupt},
+		{"bad font", "%PDF-1.4\n", func(o *WatermarkOptions) { o.FontName = "NoSuchFont" }, ErrInvalidOption},
+		{"bad pages", "%PDF-1.4\n", func(o *WatermarkOptions) { o.Pages = "x" }, ErrInvalidOption},
+		{"encrypted", string(encryptedPDF(1)), func(o *WatermarkOptions) {}, ErrEncrypted},
+		{"unknown encryption", string(unknownEncryptionPDF()), func(o *WatermarkOptions) {}, ErrEncrypted},
+		{"encrypted scrubbed", string(encryptedPDF(1)), func(o *WatermarkOptions) { o.Scrub = true }, ErrEncrypted},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultWatermarkOptions("DRAFT")
+			tt.opts(&opts)
+			var b bytes.Buffer
+			err := TextStampRS(strings.NewReader(tt.in), &b, opts)
+			if !errors.Is(err, tt.want) {
+				t.Errorf("TextStampRS() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// testPDF returns a minimal PDF with the given number of blank Letter pages
+func testPDF(pages int) []byte {
+	return trailerPDF(pages, "", "")
+}
+
+// trailerPDF returns testPDF(pages) with the object obj, if any, after
+// the pages, and the entries trailer added to its trailer, formatted with
+// the object number of obj
+func trailerPDF(pages int, obj, trailer string) []byte {
+	objs := []string{"<</Type/Catalog/Pages 2 0 R>>", ""}
+	kids := []string{}
+	for i := 0; i < pages; i++ {
+		kids = append(kids, fmt.Sprintf("%d 0 R", i+3))
+		objs = append(objs, "<</Type/Page/Parent 2 0 R/Resources<<>>>>")
+	}
+	objs[1] = fmt.Sprintf("<</Type/Pages/Kids[%s]/Count %d/MediaBox[0 0 612 792]>>", strings.Join(kids, " "), pages)
+	if obj != "" {
+		objs = append(objs, obj)
+		trailer = fmt.Sprintf(trailer, len(objs))
+	}
+
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	// pdfcpu looks for startxref in the last 512 bytes and needs at least that many
+	b.WriteString("%" + strings.Repeat(" ", 512) + "\n")
+	offsets := []int{}
+	for i, o := range objs {
+		offsets = append(offsets, b.Len())
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&b, "trailer\n<</Size %d/Root 1 0 R%s>>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, trailer, xref)
+	return b.Bytes()
+}
+
+func TestPageOutOfRange(t *testing.T) {
+	opts := DefaultWatermarkOptions("DRAFT")
+	opts.Pages = "5"
+	var b bytes.Buffer
+	err := TextStampRS(bytes.NewReader(testPDF(3)), &b, opts)
+	if !errors.Is(err, ErrPageOutOfRange) {
+		t.Errorf("TextStampRS() error = %v, want %v", err, ErrPageOutOfRange)
+	}
+
+	opts.Pages = "2-3"
+	if err := TextStampRS(bytes.NewReader(testPDF(3)), &b, opts); err != nil {
+		t.Errorf("TextStampRS() error = %v", err)
+	}
+}
+
+func TestBatesEndorseRS(t *testing.T) {
+	var b bytes.Buffer
+	err := BatesEndorseRS(bytes.NewReader(testPDF(2)), &b, "ABC%04d", 1, "CONFIDENTIAL", DefaultBatesStyle())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(b.Bytes(), pdfHeader) {
+		t.Errorf("BatesEndorseRS() did not write a PDF")
+	}
+
+	style := DefaultBatesStyle()
+	style.Position = "middle"
+	err = BatesEndorseRS(bytes.NewReader(testPDF(2)), &b, "ABC%04d", 1, "", style)
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("BatesEndorseRS() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestEncrypted(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"plain", testPDF(1), false},
+		{"encrypted", encryptedPDF(1), true},
+		{"unknown encryption", unknownEncryptionPDF(), true},
+		{"no trailer", []byte("%PDF-1.4\n"), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := encrypted(bytes.NewReader(tt.data)); got != tt.want {
+				t.Errorf("encrypted() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsPDF(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want bool
+	}{
+		{"pdf", testPDF(1), true},
+		{"leading junk", append([]byte("junk\n"), testPDF(1)...), true},
+		{"named pdf", []byte("PK\x03\x04 not a pdf"), false},
+		{"empty", nil, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := IsPDF(bytes.NewReader(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("IsPDF() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
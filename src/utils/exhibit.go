@@ -0,0 +1,130 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// ExhibitScheme describes how exhibits are labeled
+type ExhibitScheme struct {
+	Style   string `json:"scheme"`  // "letters" (Exhibit A), "numbers" (Exhibit 12) or "prefixed" (PX-0043)
+	Caption string `json:"caption"` // word preceding letters and numbers, e.g. "Exhibit"
+	Prefix  string `json:"prefix"`  // prefix of prefixed labels, e.g. "PX-"
+	Width   int    `json:"width"`   // number of digits of prefixed labels
+	Start   int    `json:"start"`   // number of the first exhibit (1 for A)
+}
+
+// DefaultExhibitScheme returns the scheme labeling exhibits Exhibit A, Exhibit B, ...
+func DefaultExhibitScheme() ExhibitScheme {
+	return ExhibitScheme{
+		Style:   "letters",
+		Caption: "Exhibit",
+		Prefix:  "PX-",
+		Width:   4,
+		Start:   1,
+	}
+}
+
+// Label returns the label of exhibit i, counting from 0
+func (s ExhibitScheme) Label(i int) (string, error) {
+	n := s.Start + i
+	if n < 1 {
+		return "", fmt.Errorf("%w: exhibit number %d", ErrInvalidOption, n)
+	}
+	var id string
+	switch s.Style {
+	case "letters":
+		id = exhibitLetters(n)
+	case "numbers":
+		id = fmt.Sprintf("%d", n)
+	case "prefixed":
+		return fmt.Sprintf(GenerateFmtString(s.Prefix, "", s.Width), n), nil
+	default:
+		return "", fmt.Errorf("%w: unknown exhibit scheme `%s` (expected letters, numbers or prefixed)", ErrInvalidOption, s.Style)
+	}
+	return strings.TrimSpace(s.Caption + " " + id), nil
+}
+
+// exhibitLetters returns the letters of exhibit n (starting at 1): A to
+// Z, then AA, AB, ...
+func exhibitLetters(n int) string {
+	s := ""
+	for n > 0 {
+		n--
+		s = string(rune('A'+n%26)) + s
+		n /= 26
+	}
+	return s
+}
+
+// ExhibitOptions configures ExhibitStampRS
+type ExhibitOptions struct {
+	Style    BatesStyle `json:"style"`    // appearance of the label
+	AllPages bool       `json:"allpages"` // label every page rather than only the first
+	Cover    bool       `json:"cover"`    // prepend a cover sheet bearing the label
+}
+
+// DefaultExhibitOptions labels the first page in the top right corner
+func DefaultExhibitOptions() ExhibitOptions {
+	style := DefaultBatesStyle()
+	style.FontName = "Helvetica-Bold"
+	style.FontSize = 14
+	style.Position = "tr"
+	style.MarginY = 20
+	style.Padding = 4
+	return ExhibitOptions{Style: style}
+}
+
+// coverDescription is the watermark description of the label on a cover sheet
+const coverDescription = "font:Helvetica-Bold, points:48, scale:1 abs, pos:c, rot:0, fillc:#000000, op:1"
+
+// ExhibitStampRS labels the exhibit rs with label according to opts
+// and writes to w
+func ExhibitStampRS(rs io.ReadSeeker, w io.Writer, label string, opts ExhibitOptions) (err error) {
+	const op = "exhibit stamp"
+	defer recoverCorrupt(op, &err)
+
+	count, err := pageCount(op, rs)
+	if err != nil {
+		return err
+	}
+
+	first := 1
+	if opts.Cover {
+		var buf bytes.Buffer
+		if err := api.InsertPages(rs, &buf, []string{"1"}, true, nil); err != nil {
+			return readErr(op, err)
+		}
+		rs = bytes.NewReader(buf.Bytes())
+		first = 2
+	}
+
+	m := map[int]*model.Watermark{}
+	stamp, err := textWatermark(label, opts.Style.Description(), true)
+	if err != nil {
+		return optionErr(op, err)
+	}
+	m[first] = stamp
+	if opts.AllPages {
+		for i := first + 1; i < first+count; i++ {
+			m[i] = stamp
+		}
+	}
+	if opts.Cover {
+		cover, err := textWatermark(strings.ToUpper(label), coverDescription, true)
+		if err != nil {
+			return optionErr(op, err)
+		}
+		m[1] = cover
+	}
+
+	if err := api.AddWatermarksMap(rs, w, m, nil); err != nil {
+		return readErr(op, err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+func TestExhibitSchemeLabel(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*ExhibitScheme)
+		i      int
+		want   string
+	}{
+		{"first letter", func(s *ExhibitScheme) {}, 0, "Exhibit A"},
+		{"last letter", func(s *ExhibitScheme) {}, 25, "Exhibit Z"},
+		{"double letter", func(s *ExhibitScheme) {}, 26, "Exhibit AA"},
+		{"double letter end", func(s *ExhibitScheme) {}, 26 + 25, "Exhibit AZ"},
+		{"triple letter", func(s *ExhibitScheme) {}, 26 + 26*26, "Exhibit AAA"},
+		{"numbers", func(s *ExhibitScheme) { s.Style = "numbers"; s.Start = 12 }, 0, "Exhibit 12"},
+		{"no caption", func(s *ExhibitScheme) { s.Caption = "" }, 1, "B"},
+		{"prefixed", func(s *ExhibitScheme) { s.Style = "prefixed"; s.Start = 40 }, 3, "PX-0043"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := DefaultExhibitScheme()
+			tt.modify(&s)
+			got, err := s.Label(tt.i)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Label() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	s := DefaultExhibitScheme()
+	s.Style = "roman"
+	if _, err := s.Label(0); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("Label() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestExhibitStampRSCover(t *testing.T) {
+	opts := DefaultExhibitOptions()
+	opts.Cover = true
+	var b bytes.Buffer
+	if err := ExhibitStampRS(bytes.NewReader(testPDF(2)), &b, "Exhibit A", opts); err != nil {
+		t.Fatal(err)
+	}
+	n, err := api.PageCount(bytes.NewReader(b.Bytes()), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 3 {
+		t.Errorf("page count = %d, want 3", n)
+	}
+}
@@ -0,0 +1,351 @@
+package utils
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrUnknownJob is returned for a job ID that is not (or no longer) known
+var ErrUnknownJob = errors.New("unknown job")
+
+// JobState is the state of a job
+type JobState string
+
+const (
+	JobPending JobState = "pending" // created, inputs being spooled
+	JobQueued  JobState = "queued"  // waiting for a worker
+	JobRunning JobState = "running"
+	JobDone    JobState = "done"
+	JobFailed  JobState = "failed"
+)
+
+// Job describes a job of a JobQueue
+type Job struct {
+	ID       string    `json:"id"`
+	Kind     string    `json:"kind"` // e.g. "bates"
+	User     string    `json:"user"` // who submitted it
+	State    JobState  `json:"state"`
+	Progress float64   `json:"progress"` // 0.0 to 1.0
+	Error    string    `json:"error,omitempty"`
+	Result   string    `json:"result,omitempty"` // filename of the result
+	Created  time.Time `json:"created"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Dir      string    `json:"-"` // spool directory of the job
+}
+
+// JobFunc does the work of a job whose inputs are spooled in dir,
+// reporting its progress (0.0 to 1.0) as it goes. It returns the
+// filename of its result, which it must write in dir.
+type JobFunc func(dir string, progress func(float64)) (result string, err error)
+
+// JobQueue runs jobs on a pool of workers, spooling their inputs and
+// results to a directory of its own. Finished jobs are removed after the
+// retention period.
+type JobQueue struct {
+	Dir       string // spool directory, created by NewJobQueue
+	Retention time.Duration
+
+	mu      sync.Mutex
+	jobs    map[string]*Job
+	closing bool // no more jobs are started
+	runs    chan jobRun
+	done    chan struct{}
+	wg      sync.WaitGroup
+	close   sync.Once
+}
+
+// jobRun is a queued job
+type jobRun struct {
+	job *Job
+	run JobFunc
+}
+
+// NewJobQueue returns a queue with the given number of workers, spooling
+// to a new directory it creates in dir. Nothing else in dir is touched.
+func NewJobQueue(dir string, workers int, retention time.Duration) (*JobQueue, error) {
+	if workers < 1 {
+		return nil, fmt.Errorf("%w: %d job workers", ErrInvalidOption, workers)
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	spool, err := os.MkdirTemp(dir, "pdftool-jobs-")
+	if err != nil {
+		return nil, err
+	}
+	q := &JobQueue{
+		Dir:       spool,
+		Retention: retention,
+		jobs:      map[string]*Job{},
+		runs:      make(chan jobRun, 1024),
+		done:      make(chan struct{}),
+	}
+	for i := 0; i < workers; i++ {
+		q.wg.Add(1)
+		go q.work()
+	}
+	q.wg.Add(1)
+	go q.janitor()
+	return q, nil
+}
+
+// Close stops the workers once the queued and running jobs are finished
+// and removes the spool directory
+func (q *JobQueue) Close() error {
+	return q.Shutdown(context.Background())
+}
+
+// Shutdown stops starting jobs, waits for the queued and running jobs to
+// finish and removes the spool directory. If ctx is done first, the jobs
+// still queued are failed and Shutdown returns the error of ctx, leaving
+// the spool directory in place and the running jobs to be cut off when
+// the program exits.
+func (q *JobQueue) Shutdown(ctx context.Context) error {
+	q.close.Do(func() {
+		q.mu.Lock()
+		q.closing = true
+		q.mu.Unlock()
+		close(q.done)
+	})
+	idle := make(chan struct{})
+	go func() {
+		q.wg.Wait()
+		close(idle)
+	}()
+	select {
+	case <-idle:
+		return os.RemoveAll(q.Dir)
+	case <-ctx.Done():
+		for {
+			select {
+			case r := <-q.runs:
+				q.finish(r.job, "", errors.New("server shut down before the job ran"))
+			default:
+				return ctx.Err()
+			}
+		}
+	}
+}
+
+// Create returns a new pending job of user with an empty spool
+// directory, into which the caller writes the inputs before calling
+// Start
+func (q *JobQueue) Create(kind string, user string) (Job, error) {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return Job{}, err
+	}
+	j := &Job{
+		ID:      hex.EncodeToString(id),
+		Kind:    kind,
+		User:    user,
+		State:   JobPending,
+		Created: time.Now(),
+	}
+	j.Dir = filepath.Join(q.Dir, j.ID)
+	if err := os.Mkdir(j.Dir, 0o700); err != nil {
+		return Job{}, err
+	}
+	q.mu.Lock()
+	q.jobs[j.ID] = j
+	q.mu.Unlock()
+	return *j, nil
+}
+
+// Start queues the pending job id to be run by run
+func (q *JobQueue) Start(id string, run JobFunc) error {
+	q.mu.Lock()
+	j, ok := q.jobs[id]
+	if !ok {
+		q.mu.Unlock()
+		return fmt.Errorf("%w: %s", ErrUnknownJob, id)
+	}
+	if j.State != JobPending {
+		q.mu.Unlock()
+		return fmt.Errorf("job %s is already %s", id, j.State)
+	}
+	if q.closing {
+		q.mu.Unlock()
+		q.finish(j, "", errors.New("job queue is shut down"))
+		return fmt.Errorf("job queue is shut down")
+	}
+	// queued under the lock, so that Shutdown sees every queued job
+	select {
+	case q.runs <- jobRun{j, run}:
+		j.State = JobQueued
+		q.mu.Unlock()
+		return nil
+	default:
+		q.mu.Unlock()
+		q.finish(j, "", errors.New("job queue is full"))
+		return fmt.Errorf("job queue is full")
+	}
+}
+
+// Job returns the current state of the job id
+func (q *JobQueue) Job(id string) (Job, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("%w: %s", ErrUnknownJob, id)
+	}
+	return *j, nil
+}
+
+// Jobs returns the current state of all jobs, oldest first
+func (q *JobQueue) Jobs() []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	jobs := make([]Job, 0, len(q.jobs))
+	for _, j := range q.jobs {
+		jobs = append(jobs, *j)
+	}
+	sort.Slice(jobs, func(a, b int) bool { return jobs[a].Created.Before(jobs[b].Created) })
+	return jobs
+}
+
+// Remove forgets the job id and removes its spool directory. A queued or
+// running job is removed when it finishes.
+func (q *JobQueue) Remove(id string) error {
+	q.mu.Lock()
+	j, ok := q.jobs[id]
+	running := false
+	if ok {
+		delete(q.jobs, id)
+		running = j.State == JobQueued || j.State == JobRunning
+	}
+	q.mu.Unlock()
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownJob, id)
+	}
+	if running {
+		return nil
+	}
+	return os.RemoveAll(j.Dir)
+}
+
+// Cleanup removes the jobs finished before now less the retention
+// period, as well as pending jobs abandoned for as long
+func (q *JobQueue) Cleanup(now time.Time) {
+	q.mu.Lock()
+	expired := []*Job{}
+	for id, j := range q.jobs {
+		switch {
+		case (j.State == JobDone || j.State == JobFailed) && now.Sub(j.Finished) > q.Retention,
+			j.State == JobPending && now.Sub(j.Created) > q.Retention:
+			delete(q.jobs, id)
+			expired = append(expired, j)
+		}
+	}
+	q.mu.Unlock()
+	for _, j := range expired {
+		os.RemoveAll(j.Dir)
+	}
+}
+
+// janitor periodically cleans up expired jobs
+func (q *JobQueue) janitor() {
+	defer q.wg.Done()
+	interval := q.Retention / 10
+	if interval < time.Second {
+		interval = time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-q.done:
+			return
+		case now := <-ticker.C:
+			q.Cleanup(now)
+		}
+	}
+}
+
+// work runs queued jobs until the queue is closed and no job is left
+// queued
+func (q *JobQueue) work() {
+	defer q.wg.Done()
+	for {
+		select {
+		case r := <-q.runs:
+			q.execute(r)
+		case <-q.done:
+			for {
+				select {
+				case r := <-q.runs:
+					q.execute(r)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// execute runs r and records its outcome
+func (q *JobQueue) execute(r jobRun) {
+	q.mu.Lock()
+	r.job.State = JobRunning
+	r.job.Started = time.Now()
+	q.mu.Unlock()
+	result, err := q.run(r)
+	q.finish(r.job, result, err)
+}
+
+// run runs r, turning a panic into an error
+func (q *JobQueue) run(r jobRun) (result string, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("job panicked: %v", p)
+		}
+	}()
+	return r.run(r.job.Dir, func(p float64) {
+		q.mu.Lock()
+		r.job.Progress = p
+		q.mu.Unlock()
+	})
+}
+
+// finish records the outcome of the job j
+func (q *JobQueue) finish(j *Job, result string, err error) {
+	q.mu.Lock()
+	j.Finished = time.Now()
+	if err != nil {
+		j.State = JobFailed
+		j.Error = err.Error()
+	} else {
+		j.State = JobDone
+		j.Progress = 1
+		j.Result = result
+	}
+	_, known := q.jobs[j.ID]
+	q.mu.Unlock()
+	if !known {
+		// removed while running
+		os.RemoveAll(j.Dir)
+	}
+}
+
+// ResultPath returns the path of the result of the job id, which must
+// be done
+func (q *JobQueue) ResultPath(id string) (string, error) {
+	j, err := q.Job(id)
+	if err != nil {
+		return "", err
+	}
+	if j.State != JobDone {
+		return "", fmt.Errorf("job %s is %s", id, j.State)
+	}
+	return filepath.Join(j.Dir, j.Result), nil
+}
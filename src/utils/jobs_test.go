@@ -0,0 +1,214 @@
+package utils
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// waitJob waits for the job id to finish
+func waitJob(t *testing.T, q *JobQueue, id string) Job {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		j, err := q.Job(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if j.State == JobDone || j.State == JobFailed {
+			return j
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	t.Fatalf("job %s did not finish", id)
+	return Job{}
+}
+
+func TestJobQueue(t *testing.T) {
+	q, err := NewJobQueue(filepath.Join(t.TempDir(), "jobs"), 2, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	tests := []struct {
+		name    string
+		run     JobFunc
+		state   JobState
+		message string
+	}{
+		{"done", func(dir string, progress func(float64)) (string, error) {
+			in, err := os.ReadFile(filepath.Join(dir, "in.txt"))
+			if err != nil {
+				return "", err
+			}
+			progress(0.5)
+			return "out.txt", os.WriteFile(filepath.Join(dir, "out.txt"), append(in, '!'), 0o600)
+		}, JobDone, ""},
+		{"failed", func(dir string, progress func(float64)) (string, error) {
+			return "", errors.New("boom")
+		}, JobFailed, "boom"},
+		{"panicked", func(dir string, progress func(float64)) (string, error) {
+			panic("boom")
+		}, JobFailed, "job panicked: boom"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			j, err := q.Create("test", "alice")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if j.User != "alice" {
+				t.Errorf("job user = %q, want %q", j.User, "alice")
+			}
+			if err := os.WriteFile(filepath.Join(j.Dir, "in.txt"), []byte("hello"), 0o600); err != nil {
+				t.Fatal(err)
+			}
+			if err := q.Start(j.ID, tt.run); err != nil {
+				t.Fatal(err)
+			}
+			j = waitJob(t, q, j.ID)
+			if j.State != tt.state || j.Error != tt.message {
+				t.Fatalf("job = %s %q, want %s %q", j.State, j.Error, tt.state, tt.message)
+			}
+			if j.State != JobDone {
+				return
+			}
+			path, err := q.ResultPath(j.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if b, _ := os.ReadFile(path); string(b) != "hello!" {
+				t.Errorf("result = %q, want %q", b, "hello!")
+			}
+		})
+	}
+
+	if got := len(q.Jobs()); got != len(tests) {
+		t.Errorf("len(Jobs()) = %d, want %d", got, len(tests))
+	}
+	q.Cleanup(time.Now().Add(2 * time.Hour))
+	if got := len(q.Jobs()); got != 0 {
+		t.Errorf("len(Jobs()) after cleanup = %d, want 0", got)
+	}
+	if _, err := q.Job("nope"); !errors.Is(err, ErrUnknownJob) {
+		t.Errorf("Job() error = %v, want %v", err, ErrUnknownJob)
+	}
+}
+
+func TestJobQueueShutdown(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "keep.txt"), nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	q, err := NewJobQueue(dir, 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	j, err := q.Create("test", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	if err := q.Start(j.ID, func(dir string, progress func(float64)) (string, error) {
+		close(started)
+		<-release
+		return "", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	queued, err := q.Create("test", "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Start(queued.ID, func(dir string, progress func(float64)) (string, error) {
+		return "", nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := q.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Shutdown() with a running job = %v, want %v", err, context.DeadlineExceeded)
+	}
+	if queued, _ := q.Job(queued.ID); queued.State != JobFailed {
+		t.Errorf("queued job = %s, want %s", queued.State, JobFailed)
+	}
+	if _, err := os.Stat(q.Dir); err != nil {
+		t.Errorf("spool directory removed with a job running: %v", err)
+	}
+	close(release)
+	if err := q.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if j, _ := q.Job(j.ID); j.State != JobDone {
+		t.Errorf("job = %s, want %s", j.State, JobDone)
+	}
+	if _, err := os.Stat(q.Dir); !os.IsNotExist(err) {
+		t.Errorf("spool directory not removed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "keep.txt")); err != nil {
+		t.Errorf("file beside the spool directory removed: %v", err)
+	}
+}
+
+func TestJobQueueShutdownDrains(t *testing.T) {
+	q, err := NewJobQueue(t.TempDir(), 1, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	started, release := make(chan struct{}), make(chan struct{})
+	ids := []string{}
+	for i := 0; i < 3; i++ {
+		j, err := q.Create("test", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		first := i == 0
+		if err := q.Start(j.ID, func(dir string, progress func(float64)) (string, error) {
+			if first {
+				close(started)
+				<-release
+			}
+			return "out.txt", os.WriteFile(filepath.Join(dir, "out.txt"), nil, 0o600)
+		}); err != nil {
+			t.Fatal(err)
+		}
+		ids = append(ids, j.ID)
+	}
+	<-started
+
+	shutdown := make(chan error)
+	go func() { shutdown <- q.Shutdown(context.Background()) }()
+	// jobs are no longer started once Shutdown is called
+	for {
+		late, err := q.Create("test", "alice")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Start(late.ID, func(dir string, progress func(float64)) (string, error) {
+			return "", nil
+		}); err != nil {
+			if late, _ := q.Job(late.ID); late.State != JobFailed {
+				t.Errorf("job started after shutdown = %s, want %s", late.State, JobFailed)
+			}
+			break
+		}
+		ids = append(ids, late.ID)
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	if err := <-shutdown; err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range ids {
+		if j, _ := q.Job(id); j.State != JobDone {
+			t.Errorf("job %s = %s, want %s", id, j.State, JobDone)
+		}
+	}
+}
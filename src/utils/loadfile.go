@@ -0,0 +1,285 @@
+package utils
+
+import (
+	"encoding/csv"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// ProductionDocument describes one Bates-numbered document of a production
+type ProductionDocument struct {
+	FmtString string // Bates format string (see GenerateFmtString)
+	StartNo   int64  // Bates number of the first page
+	PageCount int    // number of pages
+	FileName  string // name of the original document
+	Path      string // path of the produced document, relative to the load files
+	MD5       string // MD5 hash of the original document
+}
+
+// Natives maps the first Bates number of each document produced natively
+// to the path of its native, relative to the load files
+type Natives map[string]string
+
+// Bates returns the Bates number of page i (starting at 0) of d
+func (d ProductionDocument) Bates(i int) string {
+	return fmt.Sprintf(d.FmtString, d.StartNo+int64(i))
+}
+
+// BegBates returns the Bates number of the first page of d
+func (d ProductionDocument) BegBates() string {
+	return d.Bates(0)
+}
+
+// EndBates returns the Bates number of the last page of d
+func (d ProductionDocument) EndBates() string {
+	return d.Bates(d.PageCount - 1)
+}
+
+// loadFileFields are the column names of the DAT and CSV load files
+var loadFileFields = []string{
+	"BEGBATES", "ENDBATES", "BEGATTACH", "ENDATTACH", "FILENAME", "PAGECOUNT", "MD5HASH",
+}
+
+// nativePathField is the column of the paths of natives, added to the
+// load files of productions with natives
+const nativePathField = "NATIVEPATH"
+
+// loadFileColumns returns the column names of the DAT and CSV load files
+// of a production with natives
+func loadFileColumns(natives Natives) []string {
+	if len(natives) == 0 {
+		return loadFileFields
+	}
+	return append(append([]string{}, loadFileFields...), nativePathField)
+}
+
+// loadFileRecord returns the DAT and CSV columns for d
+func loadFileRecord(d ProductionDocument, natives Natives) []string {
+	// every document is its own family, so the attachment range
+	// matches the Bates range
+	record := []string{
+		d.BegBates(),
+		d.EndBates(),
+		d.BegBates(),
+		d.EndBates(),
+		d.FileName,
+		strconv.Itoa(d.PageCount),
+		d.MD5,
+	}
+	if len(natives) > 0 {
+		record = append(record, natives[d.BegBates()])
+	}
+	return record
+}
+
+// DATOptions configures the delimiters of a Concordance DAT load file
+type DATOptions struct {
+	Delimiter string // separates fields
+	Quote     string // surrounds each field
+	Newline   string // replaces line breaks inside a field
+}
+
+// DefaultDATOptions returns the standard Concordance delimiters: fields
+// separated by ASCII 20 (¶), quoted with þ, and ® for embedded newlines
+func DefaultDATOptions() DATOptions {
+	return DATOptions{
+		Delimiter: "\x14",
+		Quote:     "þ",
+		Newline:   "®",
+	}
+}
+
+// ParseDelimiter interprets Go escape sequences such as `\x14` or
+// `\u00b6` in s, returning s unchanged if it has none.
+func ParseDelimiter(s string) string {
+	if u, err := strconv.Unquote(`"` + s + `"`); err == nil {
+		return u
+	}
+	return s
+}
+
+// WriteDAT writes a Concordance DAT load file for docs to w
+func WriteDAT(w io.Writer, docs []ProductionDocument, opts DATOptions) error {
+	return WriteNativeDAT(w, docs, nil, opts)
+}
+
+// WriteNativeDAT writes a DAT load file as WriteDAT, adding a NATIVEPATH
+// column for the natives if there are any
+func WriteNativeDAT(w io.Writer, docs []ProductionDocument, natives Natives, opts DATOptions) error {
+	newlines := strings.NewReplacer("\r\n", opts.Newline, "\n", opts.Newline, "\r", opts.Newline)
+	writeRow := func(fields []string) error {
+		quoted := make([]string, len(fields))
+		for i, f := range fields {
+			quoted[i] = opts.Quote + newlines.Replace(f) + opts.Quote
+		}
+		_, err := io.WriteString(w, strings.Join(quoted, opts.Delimiter)+"\r\n")
+		return err
+	}
+
+	if err := writeRow(loadFileColumns(natives)); err != nil {
+		return err
+	}
+	for _, d := range docs {
+		if err := writeRow(loadFileRecord(d, natives)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteOPT writes an Opticon OPT image cross-reference for docs to w,
+// with one line per page
+func WriteOPT(w io.Writer, docs []ProductionDocument, volume string) error {
+	for _, d := range docs {
+		for i := 0; i < d.PageCount; i++ {
+			docBreak := ""
+			pages := ""
+			if i == 0 {
+				docBreak = "Y"
+				pages = strconv.Itoa(d.PageCount)
+			}
+			_, err := fmt.Fprintf(w, "%s,%s,%s,%s,,,%s\r\n", d.Bates(i), volume, d.Path, docBreak, pages)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// WriteLoadCSV writes the DAT load file fields for docs to w as CSV
+func WriteLoadCSV(w io.Writer, docs []ProductionDocument) error {
+	return WriteNativeLoadCSV(w, docs, nil)
+}
+
+// WriteNativeLoadCSV writes a CSV load file as WriteLoadCSV, adding a
+// NATIVEPATH column for the natives if there are any
+func WriteNativeLoadCSV(w io.Writer, docs []ProductionDocument, natives Natives) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(loadFileColumns(natives)); err != nil {
+		return err
+	}
+	for _, d := range docs {
+		if err := cw.Write(loadFileRecord(d, natives)); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// HashFile returns the hex encoded digest of the contents of path using h
+func HashFile(path string, h hash.Hash) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// ReadLoadFile reads the documents of a load file written by WriteDAT
+// (format "dat", with the delimiters of opts), WriteLoadCSV ("csv") or
+// WriteOPT ("opt"), whose Bates numbers are formatted with fmtString. Only
+// OPT files give the Path of the documents, and only DAT and CSV files
+// their FileName and MD5.
+func ReadLoadFile(r io.Reader, format string, fmtString string, opts DATOptions) ([]ProductionDocument, error) {
+	rows := [][]string{}
+	switch format {
+	case "csv":
+		var err error
+		if rows, err = csv.NewReader(r).ReadAll(); err != nil {
+			return nil, err
+		}
+	case "dat", "opt":
+		b, err := io.ReadAll(r)
+		if err != nil {
+			return nil, err
+		}
+		for _, line := range strings.Split(strings.ReplaceAll(string(b), "\r\n", "\n"), "\n") {
+			if line == "" {
+				continue
+			}
+			if format == "opt" {
+				rows = append(rows, strings.Split(line, ","))
+				continue
+			}
+			fields := strings.Split(line, opts.Delimiter)
+			for i := range fields {
+				fields[i] = strings.TrimSuffix(strings.TrimPrefix(fields[i], opts.Quote), opts.Quote)
+			}
+			rows = append(rows, fields)
+		}
+	default:
+		return nil, fmt.Errorf("unknown load file format `%s` (expected dat, csv or opt)", format)
+	}
+
+	number := func(bates string) (int64, error) {
+		n, err := FindBates(fmtString, bates)
+		if err != nil {
+			return 0, err
+		}
+		if len(n) != 1 {
+			return 0, fmt.Errorf("`%s` is not a Bates number like %s", bates, fmt.Sprintf(fmtString, 1))
+		}
+		return n[0], nil
+	}
+
+	docs := []ProductionDocument{}
+	if format == "opt" {
+		for i, row := range rows {
+			if len(row) < 4 {
+				return nil, fmt.Errorf("line %d: expected at least 4 fields", i+1)
+			}
+			n, err := number(row[0])
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", i+1, err)
+			}
+			if row[3] == "Y" || len(docs) == 0 {
+				docs = append(docs, ProductionDocument{FmtString: fmtString, StartNo: n, Path: row[2]})
+			}
+			docs[len(docs)-1].PageCount++
+		}
+		return docs, nil
+	}
+
+	if len(rows) == 0 {
+		return nil, fmt.Errorf("load file is empty")
+	}
+	columns := map[string]int{}
+	for i, name := range rows[0] {
+		columns[strings.ToUpper(strings.TrimSpace(name))] = i
+	}
+	field := func(row []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(row) {
+			return row[i]
+		}
+		return ""
+	}
+	if _, ok := columns["BEGBATES"]; !ok {
+		return nil, fmt.Errorf("load file has no BEGBATES column")
+	}
+	for i, row := range rows[1:] {
+		beg, err := number(field(row, "BEGBATES"))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+2, err)
+		}
+		d := ProductionDocument{FmtString: fmtString, StartNo: beg, FileName: field(row, "FILENAME"), MD5: field(row, "MD5HASH")}
+		if end, err := number(field(row, "ENDBATES")); err == nil {
+			d.PageCount = int(end-beg) + 1
+		} else if d.PageCount, err = strconv.Atoi(field(row, "PAGECOUNT")); err != nil {
+			return nil, fmt.Errorf("line %d: no ENDBATES or PAGECOUNT", i+2)
+		}
+		docs = append(docs, d)
+	}
+	return docs, nil
+}
@@ -0,0 +1,149 @@
+package utils
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func testDocs() []ProductionDocument {
+	return []ProductionDocument{
+		{"ABC_%04d", 1, 2, "first.pdf", "first-ABC_0001-ABC_0002.pdf", "d41d8cd98f00b204e9800998ecf8427e"},
+		{"ABC_%04d", 3, 1, "second.pdf", "second-ABC_0003-ABC_0003.pdf", "0cc175b9c0f1b6a831c399e269772661"},
+	}
+}
+
+func TestWriteDAT(t *testing.T) {
+	tests := []struct {
+		name string
+		opts DATOptions
+		want string
+	}{
+		{
+			"pipes",
+			DATOptions{"|", "", " "},
+			"BEGBATES|ENDBATES|BEGATTACH|ENDATTACH|FILENAME|PAGECOUNT|MD5HASH\r\n" +
+				"ABC_0001|ABC_0002|ABC_0001|ABC_0002|first.pdf|2|d41d8cd98f00b204e9800998ecf8427e\r\n" +
+				"ABC_0003|ABC_0003|ABC_0003|ABC_0003|second.pdf|1|0cc175b9c0f1b6a831c399e269772661\r\n",
+		},
+		{
+			"concordance",
+			DefaultDATOptions(),
+			"þBEGBATESþ\x14þENDBATESþ\x14þBEGATTACHþ\x14þENDATTACHþ\x14þFILENAMEþ\x14þPAGECOUNTþ\x14þMD5HASHþ\r\n" +
+				"þABC_0001þ\x14þABC_0002þ\x14þABC_0001þ\x14þABC_0002þ\x14þfirst.pdfþ\x14þ2þ\x14þd41d8cd98f00b204e9800998ecf8427eþ\r\n" +
+				"þABC_0003þ\x14þABC_0003þ\x14þABC_0003þ\x14þABC_0003þ\x14þsecond.pdfþ\x14þ1þ\x14þ0cc175b9c0f1b6a831c399e269772661þ\r\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := WriteDAT(&b, testDocs(), tt.opts); err != nil {
+				t.Fatal(err)
+			}
+			if got := b.String(); got != tt.want {
+				t.Errorf("WriteDAT() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteOPT(t *testing.T) {
+	want := "ABC_0001,VOL001,first-ABC_0001-ABC_0002.pdf,Y,,,2\r\n" +
+		"ABC_0002,VOL001,first-ABC_0001-ABC_0002.pdf,,,,\r\n" +
+		"ABC_0003,VOL001,second-ABC_0003-ABC_0003.pdf,Y,,,1\r\n"
+	var b bytes.Buffer
+	if err := WriteOPT(&b, testDocs(), "VOL001"); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.String(); got != want {
+		t.Errorf("WriteOPT() = %q, want %q", got, want)
+	}
+}
+
+func TestParseDelimiter(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`\x14`, "\x14"},
+		{`þ`, "þ"},
+		{"|", "|"},
+		{`"`, `"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			if got := ParseDelimiter(tt.in); got != tt.want {
+				t.Errorf("ParseDelimiter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadLoadFile(t *testing.T) {
+	write := map[string]func(b *bytes.Buffer) error{
+		"dat": func(b *bytes.Buffer) error { return WriteDAT(b, testDocs(), DefaultDATOptions()) },
+		"csv": func(b *bytes.Buffer) error { return WriteLoadCSV(b, testDocs()) },
+		"opt": func(b *bytes.Buffer) error { return WriteOPT(b, testDocs(), "VOL001") },
+	}
+	for format, f := range write {
+		t.Run(format, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := f(&b); err != nil {
+				t.Fatal(err)
+			}
+			docs, err := ReadLoadFile(&b, format, "ABC_%04d", DefaultDATOptions())
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := testDocs()
+			if len(docs) != len(want) {
+				t.Fatalf("ReadLoadFile() = %d documents, want %d", len(docs), len(want))
+			}
+			for i, d := range docs {
+				if d.StartNo != want[i].StartNo || d.PageCount != want[i].PageCount {
+					t.Errorf("document %d = %d+%d pages, want %d+%d", i, d.StartNo, d.PageCount, want[i].StartNo, want[i].PageCount)
+				}
+				if format == "opt" && d.Path != want[i].Path {
+					t.Errorf("document %d path = %q, want %q", i, d.Path, want[i].Path)
+				}
+				if format != "opt" && d.FileName != want[i].FileName {
+					t.Errorf("document %d filename = %q, want %q", i, d.FileName, want[i].FileName)
+				}
+			}
+		})
+	}
+}
+
+func TestWriteNativeLoadFiles(t *testing.T) {
+	natives := Natives{"ABC_0003": "ABC_0003.xlsx"}
+	var dat bytes.Buffer
+	if err := WriteNativeDAT(&dat, testDocs(), natives, DATOptions{"|", "", " "}); err != nil {
+		t.Fatal(err)
+	}
+	want := "BEGBATES|ENDBATES|BEGATTACH|ENDATTACH|FILENAME|PAGECOUNT|MD5HASH|NATIVEPATH\r\n" +
+		"ABC_0001|ABC_0002|ABC_0001|ABC_0002|first.pdf|2|d41d8cd98f00b204e9800998ecf8427e|\r\n" +
+		"ABC_0003|ABC_0003|ABC_0003|ABC_0003|second.pdf|1|0cc175b9c0f1b6a831c399e269772661|ABC_0003.xlsx\r\n"
+	if got := dat.String(); got != want {
+		t.Errorf("WriteNativeDAT() = %q, want %q", got, want)
+	}
+
+	var csv bytes.Buffer
+	if err := WriteNativeLoadCSV(&csv, testDocs(), natives); err != nil {
+		t.Fatal(err)
+	}
+	want = "BEGBATES,ENDBATES,BEGATTACH,ENDATTACH,FILENAME,PAGECOUNT,MD5HASH,NATIVEPATH\n" +
+		"ABC_0001,ABC_0002,ABC_0001,ABC_0002,first.pdf,2,d41d8cd98f00b204e9800998ecf8427e,\n" +
+		"ABC_0003,ABC_0003,ABC_0003,ABC_0003,second.pdf,1,0cc175b9c0f1b6a831c399e269772661,ABC_0003.xlsx\n"
+	if got := csv.String(); got != want {
+		t.Errorf("WriteNativeLoadCSV() = %q, want %q", got, want)
+	}
+
+	// without natives, the load files are as ever
+	var plain bytes.Buffer
+	if err := WriteNativeDAT(&plain, testDocs(), Natives{}, DATOptions{"|", "", " "}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(plain.String(), "NATIVEPATH") {
+		t.Errorf("WriteNativeDAT() without natives = %q", plain.String())
+	}
+}
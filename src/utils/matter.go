@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrUnknownMatter is returned for a matter that is not in the registry
+var ErrUnknownMatter = errors.New("unknown matter")
+
+// ErrRangeOverlap is returned when a requested Bates range overlaps a
+// range already issued for the matter
+var ErrRangeOverlap = errors.New("bates range overlaps an issued range")
+
+// lockTimeout is how long to wait for another process to release the
+// registry; lockStale is the age after which an abandoned lock is removed
+const (
+	lockTimeout = 10 * time.Second
+	lockStale   = time.Minute
+)
+
+// IssuedRange records a range of Bates numbers issued for a matter
+type IssuedRange struct {
+	Start  int64     `json:"start"`
+	Stop   int64     `json:"stop"`
+	Issued time.Time `json:"issued"`
+	User   string    `json:"user,omitempty"`
+	Note   string    `json:"note,omitempty"`
+}
+
+// Matter records the Bates numbering of a matter across productions
+type Matter struct {
+	Name      string        `json:"name"`
+	Prefix    string        `json:"prefix"`
+	Separator string        `json:"separator"`
+	Width     int           `json:"width"`
+	NextNo    int64         `json:"next"`
+	Ranges    []IssuedRange `json:"ranges"`
+}
+
+// FmtString returns the Bates format string of the matter
+func (m Matter) FmtString() string {
+	return GenerateFmtString(m.Prefix, m.Separator, m.Width)
+}
+
+// overlap returns the first issued range overlapping start to stop
+func (m Matter) overlap(start, stop int64) (IssuedRange, bool) {
+	for _, r := range m.Ranges {
+		if start <= r.Stop && r.Start <= stop {
+			return r, true
+		}
+	}
+	return IssuedRange{}, false
+}
+
+// MatterRegistry is a file-backed registry of matters. It is safe for
+// concurrent use by multiple goroutines and multiple processes.
+type MatterRegistry struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewMatterRegistry returns the registry stored at path
+func NewMatterRegistry(path string) *MatterRegistry {
+	return &MatterRegistry{Path: path}
+}
+
+// Matter returns the named matter
+func (r *MatterRegistry) Matter(name string) (Matter, error) {
+	var m Matter
+	err := r.update(func(matters []*Matter) ([]*Matter, bool, error) {
+		found := findMatter(matters, name)
+		if found == nil {
+			return matters, false, fmt.Errorf("%w `%s`", ErrUnknownMatter, name)
+		}
+		m = *found
+		return matters, false, nil
+	})
+	return m, err
+}
+
+// Matters returns all matters in the registry sorted by name
+func (r *MatterRegistry) Matters() ([]Matter, error) {
+	var ms []Matter
+	err := r.update(func(matters []*Matter) ([]*Matter, bool, error) {
+		for _, m := range matters {
+			ms = append(ms, *m)
+		}
+		return matters, false, nil
+	})
+	sort.Slice(ms, func(i, j int) bool { return ms[i].Name < ms[j].Name })
+	return ms, err
+}
+
+// Reserve issues count Bates numbers for the named matter, starting at
+// start or, if start is 0, where the last production ended. A matter
+// that does not exist yet is created with the numbering format of
+// defaults. The updated matter and the issued range are returned.
+func (r *MatterRegistry) Reserve(name string, start, count int64, defaults Matter, user, note string) (Matter, IssuedRange, error) {
+	var m Matter
+	var issued IssuedRange
+	err := r.update(func(matters []*Matter) ([]*Matter, bool, error) {
+		var err error
+		matters, m, issued, err = issue(matters, name, start, count, defaults, user, note)
+		return matters, err == nil, err
+	})
+	return m, issued, err
+}
+
+// Next returns the matter and the range Reserve would issue, without
+// issuing it, so that a production may be made before its numbers are
+// reserved
+func (r *MatterRegistry) Next(name string, start, count int64, defaults Matter) (Matter, IssuedRange, error) {
+	var m Matter
+	var issued IssuedRange
+	err := r.update(func(matters []*Matter) ([]*Matter, bool, error) {
+		var err error
+		_, m, issued, err = issue(matters, name, start, count, defaults, "", "")
+		return matters, false, err
+	})
+	return m, issued, err
+}
+
+// Release returns the range issued by Reserve for a production that
+// failed, so that its numbers are issued again
+func (r *MatterRegistry) Release(name string, issued IssuedRange) error {
+	return r.update(func(matters []*Matter) ([]*Matter, bool, error) {
+		found := findMatter(matters, name)
+		if found == nil {
+			return matters, false, fmt.Errorf("%w `%s`", ErrUnknownMatter, name)
+		}
+		ranges := []IssuedRange{}
+		for _, rng := range found.Ranges {
+			if rng.Start != issued.Start || rng.Stop != issued.Stop || !rng.Issued.Equal(issued.Issued) {
+				ranges = append(ranges, rng)
+			}
+		}
+		if len(ranges) == len(found.Ranges) {
+			return matters, false, fmt.Errorf("range %d-%d was not issued for matter `%s`", issued.Start, issued.Stop, found.Name)
+		}
+		found.Ranges = ranges
+		found.NextNo = 1
+		for _, rng := range ranges {
+			if rng.Stop >= found.NextNo {
+				found.NextNo = rng.Stop + 1
+			}
+		}
+		return matters, true, nil
+	})
+}
+
+// issue adds to matters the range of count numbers of the named matter
+// starting at start, or where the last production ended
+func issue(matters []*Matter, name string, start, count int64, defaults Matter, user, note string) ([]*Matter, Matter, IssuedRange, error) {
+	if count < 1 {
+		return matters, Matter{}, IssuedRange{}, fmt.Errorf("cannot reserve %d bates numbers", count)
+	}
+	found := findMatter(matters, name)
+	if found == nil {
+		found = &Matter{
+			Name:      name,
+			Prefix:    defaults.Prefix,
+			Separator: defaults.Separator,
+			Width:     defaults.Width,
+			NextNo:    1,
+		}
+		matters = append(matters, found)
+	}
+	if start == 0 {
+		start = found.NextNo
+	}
+	issued := IssuedRange{
+		Start:  start,
+		Stop:   start + count - 1,
+		Issued: time.Now(),
+		User:   user,
+		Note:   note,
+	}
+	if prev, ok := found.overlap(issued.Start, issued.Stop); ok {
+		fmtString := found.FmtString()
+		return matters, Matter{}, IssuedRange{}, fmt.Errorf(
+			"%w: %s-%s was issued %s",
+			ErrRangeOverlap,
+			fmt.Sprintf(fmtString, prev.Start),
+			fmt.Sprintf(fmtString, prev.Stop),
+			prev.Issued.Format("2006-01-02 15:04"),
+		)
+	}
+	found.Ranges = append(found.Ranges, issued)
+	if issued.Stop >= found.NextNo {
+		found.NextNo = issued.Stop + 1
+	}
+	return matters, *found, issued, nil
+}
+
+func findMatter(matters []*Matter, name string) *Matter {
+	for _, m := range matters {
+		if strings.EqualFold(m.Name, name) {
+			return m
+		}
+	}
+	return nil
+}
+
+// update loads the registry while holding its lock, calls f and saves
+// the matters f returns if f reports a change
+func (r *MatterRegistry) update(f func([]*Matter) ([]*Matter, bool, error)) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	unlock, err := lockFile(r.Path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	var matters []*Matter
+	data, err := os.ReadFile(r.Path)
+	if err == nil {
+		if err := json.Unmarshal(data, &matters); err != nil {
+			return fmt.Errorf("reading matter registry `%s`: %w", r.Path, err)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	matters, changed, err := f(matters)
+	if err != nil || !changed {
+		return err
+	}
+
+	data, err = json.MarshalIndent(matters, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(r.Path), 0o755); err != nil {
+		return err
+	}
+	tmp := r.Path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, r.Path)
+}
+
+// lockFile acquires an exclusive lock by creating path, returning a
+// function that releases it
+func lockFile(path string) (func(), error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	deadline := time.Now().Add(lockTimeout)
+	for {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0o644)
+		if err == nil {
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			f.Close()
+			return func() { os.Remove(path) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+		if info, err := os.Stat(path); err == nil && time.Since(info.ModTime()) > lockStale {
+			os.Remove(path)
+			continue
+		}
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("timed out waiting for lock `%s`", path)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
@@ -0,0 +1,105 @@
+package utils
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestMatterRegistryReserve(t *testing.T) {
+	r := NewMatterRegistry(filepath.Join(t.TempDir(), "matters.json"))
+	defaults := Matter{Prefix: "ACME", Separator: "_", Width: 6}
+
+	tests := []struct {
+		name      string
+		start     int64
+		count     int64
+		wantStart int64
+		wantStop  int64
+		wantErr   error
+	}{
+		{"first production", 0, 10, 1, 10, nil},
+		{"continues", 0, 5, 11, 15, nil},
+		{"explicit start", 100, 5, 100, 104, nil},
+		{"overlap", 12, 2, 0, 0, ErrRangeOverlap},
+		{"continues after gap", 0, 1, 105, 105, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, issued, err := r.Reserve("acme", tt.start, tt.count, defaults, "", "")
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Reserve() error = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if issued.Start != tt.wantStart || issued.Stop != tt.wantStop {
+				t.Errorf("Reserve() = %d-%d, want %d-%d", issued.Start, issued.Stop, tt.wantStart, tt.wantStop)
+			}
+			if m.FmtString() != "ACME_%06d" {
+				t.Errorf("FmtString() = %s", m.FmtString())
+			}
+		})
+	}
+
+	m, err := r.Matter("ACME")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m.Ranges) != 4 || m.NextNo != 106 {
+		t.Errorf("Matter() = %+v", m)
+	}
+	if _, err := r.Matter("other"); !errors.Is(err, ErrUnknownMatter) {
+		t.Errorf("Matter() error = %v, want %v", err, ErrUnknownMatter)
+	}
+}
+
+func TestMatterRegistryNextAndRelease(t *testing.T) {
+	r := NewMatterRegistry(filepath.Join(t.TempDir(), "matters.json"))
+	defaults := Matter{Prefix: "ACME", Separator: "_", Width: 6}
+
+	m, next, err := r.Next("acme", 0, 10, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next.Start != 1 || next.Stop != 10 || m.FmtString() != "ACME_%06d" {
+		t.Errorf("Next() = %s %d-%d, want ACME_%%06d 1-10", m.FmtString(), next.Start, next.Stop)
+	}
+	if _, err := r.Matter("acme"); !errors.Is(err, ErrUnknownMatter) {
+		t.Errorf("Next() created the matter: %v", err)
+	}
+
+	first, err := reserve(r, 0, 10, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	failed, err := reserve(r, 0, 5, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Release("ACME", failed); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Release("ACME", failed); err == nil {
+		t.Error("Release() of a released range succeeded")
+	}
+	again, err := reserve(r, 0, 5, defaults)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Start != failed.Start {
+		t.Errorf("Reserve() after Release() starts at %d, want %d", again.Start, failed.Start)
+	}
+	if _, err := reserve(r, first.Start, 1, defaults); !errors.Is(err, ErrRangeOverlap) {
+		t.Errorf("Reserve() of a kept range = %v, want %v", err, ErrRangeOverlap)
+	}
+	if err := r.Release("other", first); !errors.Is(err, ErrUnknownMatter) {
+		t.Errorf("Release() error = %v, want %v", err, ErrUnknownMatter)
+	}
+}
+
+// reserve reserves count numbers of the matter acme
+func reserve(r *MatterRegistry, start, count int64, defaults Matter) (IssuedRange, error) {
+	_, issued, err := r.Reserve("acme", start, count, defaults, "", "")
+	return issued, err
+}
@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// mergedDoc is the place of a document in a merged PDF
+type mergedDoc struct {
+	firstPage int
+	lastPage  int
+	bookmarks []pdfcpu.Bookmark // of the document, numbered as merged
+}
+
+// mergeDocs reads docs and merges them, in order, into a single context.
+// With duplex, a blank page is added after each document but the last
+// ending on an odd page, so that each starts on an odd page. The
+// documents' own bookmarks are read before merging.
+func mergeDocs(op string, docs []io.ReadSeeker, duplex bool) (*model.Context, []mergedDoc, error) {
+	conf := model.NewDefaultConfiguration()
+	var ctx *model.Context
+	merged := make([]mergedDoc, len(docs))
+	for i, rs := range docs {
+		if _, err := pageCount(op, rs); err != nil {
+			return nil, nil, err
+		}
+		src, err := api.ReadContext(rs, conf)
+		if err != nil {
+			return nil, nil, readErr(op, err)
+		}
+		if err := api.ValidateContext(src); err != nil {
+			return nil, nil, readErr(op, err)
+		}
+		bookmarks := documentBookmarks(src)
+
+		first := 1
+		if ctx == nil {
+			ctx = src
+			ctx.EnsureVersionForWriting()
+		} else {
+			if duplex && ctx.PageCount%2 == 1 {
+				if err := ctx.InsertBlankPages(types.IntSet{ctx.PageCount: true}, false); err != nil {
+					return nil, nil, readErr(op, err)
+				}
+				ctx.PageCount++
+				merged[i-1].lastPage++
+			}
+			first = ctx.PageCount + 1
+			if err := pdfcpu.MergeXRefTables(src, ctx); err != nil {
+				return nil, nil, readErr(op, err)
+			}
+			offsetBookmarks(bookmarks, first-1)
+		}
+		merged[i] = mergedDoc{firstPage: first, lastPage: ctx.PageCount, bookmarks: bookmarks}
+	}
+	return ctx, merged, nil
+}
+
+// documentBookmarks returns the bookmarks of ctx, ordered as AddBookmarks
+// requires, or nil if it has none or they cannot be read
+func documentBookmarks(ctx *model.Context) (bms []pdfcpu.Bookmark) {
+	defer func() {
+		if recover() != nil {
+			bms = nil
+		}
+	}()
+	bms, err := pdfcpu.BookmarksForOutline(ctx)
+	if err != nil {
+		return nil
+	}
+	return orderBookmarks(bms, 1)
+}
+
+// orderBookmarks sorts bms and their children by page and detaches them
+// from their parents. Bookmarks before page min are moved to it.
+func orderBookmarks(bms []pdfcpu.Bookmark, min int) []pdfcpu.Bookmark {
+	for i := range bms {
+		bms[i].Parent = nil
+		if bms[i].PageFrom < min {
+			bms[i].PageFrom = min
+		}
+	}
+	sort.SliceStable(bms, func(a, b int) bool { return bms[a].PageFrom < bms[b].PageFrom })
+	for i := range bms {
+		if bms[i].Children != nil {
+			bms[i].Children = orderBookmarks(bms[i].Children, bms[i].PageFrom)
+		}
+	}
+	return bms
+}
+
+// offsetBookmarks adds offset to the pages of bms and their children
+func offsetBookmarks(bms []pdfcpu.Bookmark, offset int) {
+	for i := range bms {
+		bms[i].PageFrom += offset
+		if bms[i].PageThru > 0 {
+			bms[i].PageThru += offset
+		}
+		offsetBookmarks(bms[i].Children, offset)
+	}
+}
+
+// setBookmarks replaces the bookmarks of ctx with bms
+func setBookmarks(ctx *model.Context, bms []pdfcpu.Bookmark) error {
+	root, err := ctx.Catalog()
+	if err != nil {
+		return err
+	}
+	root.Delete("Outlines")
+	if len(bms) == 0 {
+		return nil
+	}
+	return pdfcpu.AddBookmarks(ctx, bms)
+}
+
+// MergeOptions configures MergeRS
+type MergeOptions struct {
+	// Titles are the bookmark titles of the documents. A document
+	// without a title gets no bookmark of its own; its own bookmarks,
+	// if any, are kept at the top level.
+	Titles []string
+
+	// Duplex adds blank pages so that each document starts on an odd
+	// page, for double-sided printing
+	Duplex bool
+
+	// FmtString, unless empty, Bates stamps the merged PDF with
+	// continuous numbers starting at StartNo, in Style. Blank pages
+	// added for Duplex are numbered with the document before them.
+	FmtString string
+	StartNo   int64
+	Style     BatesStyle
+
+	// Designations are the designation legends of the documents when
+	// Bates stamped (see BatesEndorseRS); missing or empty for none
+	Designations []string
+}
+
+// MergedDocument is the place of a document in a merged PDF
+type MergedDocument struct {
+	FirstPage int
+	LastPage  int // including any blank page added after it
+	BegBates  string
+	EndBates  string
+}
+
+// MergeRS merges docs, in order, into a single PDF written to w, as
+// configured by opts. Each document is bookmarked with its title, with
+// its own bookmarks nested below. It returns the place of each document
+// in the merged PDF.
+func MergeRS(docs []io.ReadSeeker, w io.Writer, opts MergeOptions) (merged []MergedDocument, err error) {
+	const op = "merge"
+	defer recoverCorrupt(op, &err)
+
+	if len(docs) == 0 {
+		return nil, optionErr(op, fmt.Errorf("no documents to merge"))
+	}
+	ctx, docPlaces, err := mergeDocs(op, docs, opts.Duplex)
+	if err != nil {
+		return nil, err
+	}
+
+	bookmarks := []pdfcpu.Bookmark{}
+	merged = make([]MergedDocument, len(docs))
+	for i, d := range docPlaces {
+		merged[i] = MergedDocument{FirstPage: d.firstPage, LastPage: d.lastPage}
+		title := ""
+		if i < len(opts.Titles) {
+			title = opts.Titles[i]
+		}
+		if title == "" {
+			bookmarks = append(bookmarks, d.bookmarks...)
+			continue
+		}
+		bookmarks = append(bookmarks, pdfcpu.Bookmark{Title: title, PageFrom: d.firstPage, Children: d.bookmarks})
+	}
+	if err := setBookmarks(ctx, bookmarks); err != nil {
+		return nil, readErr(op, err)
+	}
+
+	if opts.FmtString != "" {
+		watermarks := map[int][]*model.Watermark{}
+		for i, d := range merged {
+			designation := ""
+			if i < len(opts.Designations) {
+				designation = opts.Designations[i]
+			}
+			startno := opts.StartNo + int64(d.FirstPage-1)
+			m, err := batesWatermarks(d.LastPage-d.FirstPage+1, opts.FmtString, startno, designation, opts.Style)
+			if err != nil {
+				return nil, optionErr(op, err)
+			}
+			for page, wms := range m {
+				watermarks[d.FirstPage+page-1] = wms
+			}
+			merged[i].BegBates = fmt.Sprintf(opts.FmtString, startno)
+			merged[i].EndBates = fmt.Sprintf(opts.FmtString, startno+int64(d.LastPage-d.FirstPage))
+		}
+		if err := pdfcpu.AddWatermarksSliceMap(ctx, watermarks); err != nil {
+			return nil, optionErr(op, err)
+		}
+	}
+
+	if err := api.OptimizeContext(ctx); err != nil {
+		return nil, readErr(op, err)
+	}
+	if err := api.WriteContext(ctx, w); err != nil {
+		return nil, readErr(op, err)
+	}
+	return merged, nil
+}
@@ -0,0 +1,104 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+// bookmarkedPDF returns a PDF of pages pages with bookmarks bms
+func bookmarkedPDF(t *testing.T, pages int, bms []pdfcpu.Bookmark) []byte {
+	t.Helper()
+	ctx, err := api.ReadContext(bytes.NewReader(testPDF(pages)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+	if err := pdfcpu.AddBookmarks(ctx, bms); err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := api.WriteContext(ctx, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// flatBookmarks returns "title@page" of bms and their children, depth first
+func flatBookmarks(bms []pdfcpu.Bookmark, indent string) []string {
+	s := []string{}
+	for _, bm := range bms {
+		s = append(s, fmt.Sprintf("%s%s@%d", indent, bm.Title, bm.PageFrom))
+		s = append(s, flatBookmarks(bm.Children, indent+"  ")...)
+	}
+	return s
+}
+
+func TestMergeRS(t *testing.T) {
+	second := bookmarkedPDF(t, 2, []pdfcpu.Bookmark{{Title: "Intro", PageFrom: 1}, {Title: "Terms", PageFrom: 2}})
+
+	tests := []struct {
+		name      string
+		opts      MergeOptions
+		bookmarks []string
+		merged    []MergedDocument
+	}{
+		{
+			"titles",
+			MergeOptions{Titles: []string{"Motion", "Contract", "Order"}},
+			[]string{"Motion@1", "Contract@2", "  Intro@2", "  Terms@3", "Order@4"},
+			[]MergedDocument{{1, 1, "", ""}, {2, 3, "", ""}, {4, 6, "", ""}},
+		},
+		{
+			"duplex",
+			MergeOptions{Titles: []string{"Motion", "", "Order"}, Duplex: true},
+			[]string{"Motion@1", "Intro@3", "Terms@4", "Order@5"},
+			[]MergedDocument{{1, 2, "", ""}, {3, 4, "", ""}, {5, 7, "", ""}},
+		},
+		{
+			"bates",
+			MergeOptions{Duplex: true, FmtString: GenerateFmtString("ABC", "", 4), StartNo: 10, Style: DefaultBatesStyle()},
+			[]string{"Intro@3", "Terms@4"},
+			[]MergedDocument{{1, 2, "ABC0010", "ABC0011"}, {3, 4, "ABC0012", "ABC0013"}, {5, 7, "ABC0014", "ABC0016"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			docs := []io.ReadSeeker{bytes.NewReader(testPDF(1)), bytes.NewReader(second), bytes.NewReader(testPDF(3))}
+			var b bytes.Buffer
+			merged, err := MergeRS(docs, &b, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(merged, tt.merged) {
+				t.Errorf("MergeRS() = %v, want %v", merged, tt.merged)
+			}
+
+			ctx, err := api.ReadContext(bytes.NewReader(b.Bytes()), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := ctx.EnsurePageCount(); err != nil {
+				t.Fatal(err)
+			}
+			want := tt.merged[len(tt.merged)-1].LastPage
+			if ctx.PageCount != want {
+				t.Errorf("page count = %d, want %d", ctx.PageCount, want)
+			}
+			bms, err := pdfcpu.BookmarksForOutline(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := flatBookmarks(bms, ""); !reflect.DeepEqual(got, tt.bookmarks) {
+				t.Errorf("bookmarks = %v, want %v", got, tt.bookmarks)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Metrics is a registry of counters, gauges and histograms, written in
+// the Prometheus text exposition format
+type Metrics struct {
+	mu      sync.Mutex
+	metrics []*metric
+}
+
+// metric is a family of series of one metric, keyed by label values
+type metric struct {
+	name    string
+	help    string
+	kind    string // counter, gauge or histogram
+	labels  []string
+	buckets []float64 // upper bounds, for histograms
+	series  map[string]*series
+}
+
+// series is the value of a metric for one set of label values
+type series struct {
+	values []string
+	value  float64  // counters and gauges
+	counts []uint64 // histograms, per bucket
+	sum    float64
+	count  uint64
+}
+
+// Counter is a metric that only goes up
+type Counter struct{ *metricRef }
+
+// Gauge is a metric that goes up and down
+type Gauge struct{ *metricRef }
+
+// Histogram counts observations, e.g. durations, in buckets
+type Histogram struct{ *metricRef }
+
+type metricRef struct {
+	r *Metrics
+	m *metric
+}
+
+// DefaultBuckets are histogram buckets for request durations in seconds
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30, 60, 120}
+
+func (r *Metrics) add(name string, help string, kind string, buckets []float64, labels []string) *metricRef {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, m := range r.metrics {
+		if m.name == name {
+			panic(fmt.Sprintf("metric %s registered twice", name))
+		}
+	}
+	m := &metric{name, help, kind, labels, buckets, map[string]*series{}}
+	r.metrics = append(r.metrics, m)
+	return &metricRef{r, m}
+}
+
+// Counter registers a counter with the given label names
+func (r *Metrics) Counter(name string, help string, labels ...string) Counter {
+	return Counter{r.add(name, help, "counter", nil, labels)}
+}
+
+// Gauge registers a gauge with the given label names
+func (r *Metrics) Gauge(name string, help string, labels ...string) Gauge {
+	return Gauge{r.add(name, help, "gauge", nil, labels)}
+}
+
+// Histogram registers a histogram with the given bucket upper bounds
+// and label names
+func (r *Metrics) Histogram(name string, help string, buckets []float64, labels ...string) Histogram {
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	return Histogram{r.add(name, help, "histogram", b, labels)}
+}
+
+// with calls f with the series of the label values, under the lock
+func (ref *metricRef) with(values []string, f func(s *series)) {
+	if len(values) != len(ref.m.labels) {
+		panic(fmt.Sprintf("metric %s: %d label values for labels %v", ref.m.name, len(values), ref.m.labels))
+	}
+	key := strings.Join(values, "\xff")
+	ref.r.mu.Lock()
+	defer ref.r.mu.Unlock()
+	s, ok := ref.m.series[key]
+	if !ok {
+		s = &series{values: append([]string{}, values...)}
+		if ref.m.kind == "histogram" {
+			s.counts = make([]uint64, len(ref.m.buckets))
+		}
+		ref.m.series[key] = s
+	}
+	f(s)
+}
+
+// Add adds v, which must not be negative, to the counter
+func (c Counter) Add(v float64, values ...string) {
+	if v < 0 {
+		panic(fmt.Sprintf("counter %s decreased", c.m.name))
+	}
+	c.with(values, func(s *series) { s.value += v })
+}
+
+// Inc adds 1 to the counter
+func (c Counter) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Set sets the gauge to v
+func (g Gauge) Set(v float64, values ...string) {
+	g.with(values, func(s *series) { s.value = v })
+}
+
+// Add adds v to the gauge
+func (g Gauge) Add(v float64, values ...string) {
+	g.with(values, func(s *series) { s.value += v })
+}
+
+// Observe records the observation v
+func (h Histogram) Observe(v float64, values ...string) {
+	h.with(values, func(s *series) {
+		for i, le := range h.m.buckets {
+			if v <= le {
+				s.counts[i]++
+			}
+		}
+		s.sum += v
+		s.count++
+	})
+}
+
+// Write writes all metrics to w in the Prometheus text format
+func (r *Metrics) Write(w io.Writer) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var b strings.Builder
+	for _, m := range r.metrics {
+		fmt.Fprintf(&b, "# HELP %s %s\n", m.name, escapeHelp(m.help))
+		fmt.Fprintf(&b, "# TYPE %s %s\n", m.name, m.kind)
+		keys := make([]string, 0, len(m.series))
+		for k := range m.series {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := m.series[k]
+			if m.kind != "histogram" {
+				fmt.Fprintf(&b, "%s%s %s\n", m.name, labelString(m.labels, s.values), formatValue(s.value))
+				continue
+			}
+			names := append(append([]string{}, m.labels...), "le")
+			values := append(append([]string{}, s.values...), "")
+			for i, le := range m.buckets {
+				values[len(values)-1] = formatValue(le)
+				fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, labelString(names, values), s.counts[i])
+			}
+			values[len(values)-1] = "+Inf"
+			fmt.Fprintf(&b, "%s_bucket%s %d\n", m.name, labelString(names, values), s.count)
+			fmt.Fprintf(&b, "%s_sum%s %s\n", m.name, labelString(m.labels, s.values), formatValue(s.sum))
+			fmt.Fprintf(&b, "%s_count%s %d\n", m.name, labelString(m.labels, s.values), s.count)
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// labelString returns {name="value",...}, or nothing without labels
+func labelString(names []string, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, n := range names {
+		v := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(values[i])
+		pairs[i] = n + `="` + v + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
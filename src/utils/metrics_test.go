@@ -0,0 +1,56 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMetricsWrite(t *testing.T) {
+	var m Metrics
+	requests := m.Counter("test_requests_total", "Requests served.", "operation", "status")
+	inFlight := m.Gauge("test_in_flight", "Requests in flight.")
+	latency := m.Histogram("test_duration_seconds", "Request duration.", []float64{1, 0.5}, "operation")
+
+	requests.Inc("bates", "200")
+	requests.Add(2, "bates", "200")
+	requests.Inc("draft", `4"1"5`)
+	inFlight.Add(3)
+	inFlight.Add(-1)
+	latency.Observe(0.2, "bates")
+	latency.Observe(0.7, "bates")
+	latency.Observe(3, "bates")
+
+	var b strings.Builder
+	if err := m.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP test_requests_total Requests served.
+# TYPE test_requests_total counter
+test_requests_total{operation="bates",status="200"} 3
+test_requests_total{operation="draft",status="4\"1\"5"} 1
+# HELP test_in_flight Requests in flight.
+# TYPE test_in_flight gauge
+test_in_flight 2
+# HELP test_duration_seconds Request duration.
+# TYPE test_duration_seconds histogram
+test_duration_seconds_bucket{operation="bates",le="0.5"} 1
+test_duration_seconds_bucket{operation="bates",le="1"} 2
+test_duration_seconds_bucket{operation="bates",le="+Inf"} 3
+test_duration_seconds_sum{operation="bates"} 3.9
+test_duration_seconds_count{operation="bates"} 3
+`
+	if got := b.String(); got != want {
+		t.Errorf("Write() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestMetricsLabelCount(t *testing.T) {
+	var m Metrics
+	c := m.Counter("test_total", "Test.", "operation")
+	defer func() {
+		if recover() == nil {
+			t.Error("Inc() with missing label values did not panic")
+		}
+	}()
+	c.Inc()
+}
@@ -0,0 +1,140 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// PagePositions are the header (tl, tc, tr) and footer (bl, bc, br)
+// positions of page templates
+var PagePositions = []string{"tl", "tc", "tr", "bl", "bc", "br"}
+
+// PaginateOptions configures PaginateRS
+type PaginateOptions struct {
+	// Templates are the header and footer texts, keyed by position (see
+	// PagePositions). They may contain the placeholders {page}, {pages},
+	// {filename}, {date} and {bates}.
+	Templates map[string]string `json:"templates"`
+
+	Style     BatesStyle `json:"style"`     // appearance; the position is that of each template
+	FileName  string     `json:"filename"`  // value of {filename}
+	Date      string     `json:"date"`      // value of {date}
+	FirstPage int        `json:"firstpage"` // value of {page} on the first page
+	FmtString string     `json:"-"`         // format of {bates} (see GenerateFmtString)
+	StartNo   int64      `json:"-"`         // {bates} of the first page
+}
+
+// DefaultPaginateOptions numbers the pages "Page X of Y" at the bottom
+// center, in plain 10pt Helvetica
+func DefaultPaginateOptions() PaginateOptions {
+	style := DefaultBatesStyle()
+	style.FontSize = 10
+	style.MarginX = 36
+	style.MarginY = 24
+	style.BgColor = ""
+	style.BorderWidth = 0
+	return PaginateOptions{
+		Templates: map[string]string{"bc": "Page {page} of {pages}"},
+		Style:     style,
+		FirstPage: 1,
+	}
+}
+
+// pagePlaceholder matches the placeholders of page templates
+var pagePlaceholder = regexp.MustCompile(`\{[a-z]*\}`)
+
+// expand returns tmpl with the placeholders replaced for page i (from 0)
+// of count
+func (o PaginateOptions) expand(tmpl string, i int, count int) (string, error) {
+	var err error
+	text := pagePlaceholder.ReplaceAllStringFunc(tmpl, func(p string) string {
+		switch p {
+		case "{page}":
+			return strconv.Itoa(o.FirstPage + i)
+		case "{pages}":
+			return strconv.Itoa(o.FirstPage + count - 1)
+		case "{filename}":
+			return o.FileName
+		case "{date}":
+			return o.Date
+		case "{bates}":
+			if o.FmtString == "" {
+				err = fmt.Errorf("{bates} used without Bates numbering")
+				return p
+			}
+			return fmt.Sprintf(o.FmtString, o.StartNo+int64(i))
+		}
+		err = fmt.Errorf("unknown placeholder %s (expected {page}, {pages}, {filename}, {date} or {bates})", p)
+		return p
+	})
+	return text, err
+}
+
+// paginateWatermarks returns the header and footer watermarks for each
+// of count pages
+func paginateWatermarks(count int, opts PaginateOptions) (map[int][]*model.Watermark, error) {
+	positions := []string{}
+	for pos := range opts.Templates {
+		known := false
+		for _, p := range PagePositions {
+			known = known || p == pos
+		}
+		if !known {
+			return nil, fmt.Errorf("page template position `%s` (expected tl, tc, tr, bl, bc or br)", pos)
+		}
+		if opts.Templates[pos] != "" {
+			positions = append(positions, pos)
+		}
+	}
+	sort.Strings(positions)
+
+	m := map[int][]*model.Watermark{}
+	for _, pos := range positions {
+		style := opts.Style
+		style.Position = pos
+		desc := style.Description()
+		for i := 0; i < count; i++ {
+			text, err := opts.expand(opts.Templates[pos], i, count)
+			if err != nil {
+				return nil, err
+			}
+			wm, err := textWatermark(text, desc, true)
+			if err != nil {
+				return nil, err
+			}
+			m[i+1] = append(m[i+1], wm)
+		}
+	}
+	return m, nil
+}
+
+// PaginateRS adds the header and footer templates of opts to each page
+// of rs and writes to w
+func PaginateRS(rs io.ReadSeeker, w io.Writer, opts PaginateOptions) (err error) {
+	const op = "paginate"
+	defer recoverCorrupt(op, &err)
+
+	count, err := pageCount(op, rs)
+	if err != nil {
+		return err
+	}
+
+	m, err := paginateWatermarks(count, opts)
+	if err != nil {
+		return optionErr(op, err)
+	}
+	if len(m) == 0 {
+		return optionErr(op, fmt.Errorf("no header or footer text given"))
+	}
+
+	if err := api.AddWatermarksSliceMap(rs, w, m, nil); err != nil {
+		return readErr(op, err)
+	}
+	return nil
+}
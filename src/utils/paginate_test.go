@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestPaginateExpand(t *testing.T) {
+	opts := DefaultPaginateOptions()
+	opts.FileName = "motion.pdf"
+	opts.Date = "May 1, 2024"
+	opts.FmtString = GenerateFmtString("ABC", "-", 6)
+	opts.StartNo = 100
+
+	tests := []struct {
+		name    string
+		tmpl    string
+		i       int
+		want    string
+		wantErr bool
+	}{
+		{"page of pages", "Page {page} of {pages}", 1, "Page 2 of 3", false},
+		{"caption", "Case No. 3:24-cv-01234 – Document 45", 0, "Case No. 3:24-cv-01234 – Document 45", false},
+		{"filename and date", "{filename}, filed {date}", 2, "motion.pdf, filed May 1, 2024", false},
+		{"bates", "{bates}", 2, "ABC-000102", false},
+		{"unknown", "{pg}", 0, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := opts.expand(tt.tmpl, tt.i, 3)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("expand() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Errorf("expand() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	opts.FirstPage = 5
+	if got, _ := opts.expand("{page}/{pages}", 0, 3); got != "5/7" {
+		t.Errorf("expand() from page 5 = %q, want %q", got, "5/7")
+	}
+}
+
+func TestPaginateRS(t *testing.T) {
+	opts := DefaultPaginateOptions()
+	opts.Templates["tl"] = "Case No. 3:24-cv-01234"
+	var b bytes.Buffer
+	if err := PaginateRS(bytes.NewReader(testPDF(3)), &b, opts); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := PageCount(bytes.NewReader(b.Bytes())); err != nil || n != 3 {
+		t.Errorf("page count = %d, %v, want 3", n, err)
+	}
+
+	// percent signs are shown as given, not read as pdfcpu placeholders
+	opts = DefaultPaginateOptions()
+	opts.Templates = map[string]string{"bc": "100% of %p and %P, {page}%"}
+	b.Reset()
+	if err := PaginateRS(bytes.NewReader(testPDF(1)), &b, opts); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := pageText(t, readTestPDF(t, b.Bytes()))
+	if got, want := strings.ReplaceAll(text, "\x01", ""), "100% of %p and %P, 1%"; got != want {
+		t.Errorf("page text = %q, want %q", got, want)
+	}
+
+	tests := []struct {
+		name      string
+		templates map[string]string
+	}{
+		{"bates without numbering", map[string]string{"br": "{bates}"}},
+		{"unknown position", map[string]string{"c": "Page {page}"}},
+		{"nothing", map[string]string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultPaginateOptions()
+			opts.Templates = tt.templates
+			err := PaginateRS(bytes.NewReader(testPDF(1)), &bytes.Buffer{}, opts)
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Errorf("PaginateRS() error = %v, want %v", err, ErrInvalidOption)
+			}
+		})
+	}
+}
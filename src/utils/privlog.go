@@ -0,0 +1,468 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// PrivilegeEntry describes one document of a privilege log, withheld or
+// produced with redactions
+type PrivilegeEntry struct {
+	BegBates    string `yaml:"begbates"`
+	EndBates    string `yaml:"endbates"`
+	Path        string `yaml:"path"` // the document, to match its redactions
+	Date        string `yaml:"date"`
+	Author      string `yaml:"author"`
+	Recipients  string `yaml:"recipients"`
+	Basis       string `yaml:"basis"` // e.g. "Attorney-Client Privilege"
+	Description string `yaml:"description"`
+	Treatment   string `yaml:"treatment"` // "Withheld" or "Redacted"
+
+	Redactions []RedactionRecord `yaml:"-"` // regions redacted from the document
+}
+
+// privilegeFields are the recognized columns of a CSV privilege manifest
+var privilegeFields = []string{
+	"begbates", "endbates", "path", "date", "author", "recipients", "basis", "description", "treatment",
+}
+
+// ReadPrivilegeManifest reads the documents of a privilege log from r,
+// either a CSV file with a header row naming its columns (begbates,
+// endbates, path, date, author, recipients, basis, description,
+// treatment) or, if format is "yaml", a YAML list of entries with the
+// same keys. Each entry needs a begbates or a path.
+func ReadPrivilegeManifest(r io.Reader, format string) ([]PrivilegeEntry, error) {
+	entries := []PrivilegeEntry{}
+	switch strings.ToLower(format) {
+	case "yaml", "yml":
+		if err := yaml.NewDecoder(r).Decode(&entries); err != nil && err != io.EOF {
+			return nil, err
+		}
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return entries, nil
+		}
+		columns := map[string]int{}
+		for i, name := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		_, bates := columns["begbates"]
+		if _, path := columns["path"]; !bates && !path {
+			return nil, fmt.Errorf("privilege manifest has no `begbates` or `path` column (expected %s)", strings.Join(privilegeFields, ","))
+		}
+		field := func(record []string, name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		for _, record := range records[1:] {
+			entries = append(entries, PrivilegeEntry{
+				BegBates:    field(record, "begbates"),
+				EndBates:    field(record, "endbates"),
+				Path:        field(record, "path"),
+				Date:        field(record, "date"),
+				Author:      field(record, "author"),
+				Recipients:  field(record, "recipients"),
+				Basis:       field(record, "basis"),
+				Description: field(record, "description"),
+				Treatment:   field(record, "treatment"),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown privilege manifest format `%s` (expected csv or yaml)", format)
+	}
+	for i, e := range entries {
+		if e.BegBates == "" && e.Path == "" {
+			return nil, fmt.Errorf("privilege manifest entry %d has no begbates or path", i+1)
+		}
+	}
+	return entries, nil
+}
+
+// batesNumber returns the number of s, a single Bates number of
+// fmtString with any padding
+func batesNumber(fmtString string, s string) (int64, error) {
+	n, err := FindBates(regexp.MustCompile(`%0?\d*d`).ReplaceAllString(fmtString, "%d"), s)
+	if err != nil {
+		return 0, err
+	}
+	if len(n) != 1 {
+		return 0, fmt.Errorf("`%s` is not a Bates number like %s", s, fmt.Sprintf(fmtString, 1))
+	}
+	return n[0], nil
+}
+
+// recordBates returns the Bates number of fmtString naming file, as the
+// bates command names its outputs, or "" if it is not so named
+func recordBates(file string, fmtString string) string {
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	n, err := batesNumber(fmtString, name)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf(fmtString, n)
+}
+
+// PrivilegeLog returns the entries of a privilege log: those of the
+// manifest, with their Bates numbers formatted with fmtString (see
+// GenerateFmtString), followed by one for each other file of the
+// redaction records. Records are matched to entries by their path or,
+// failing that, by the Bates number naming their file. Entries with
+// redactions default to the treatment "Redacted", with the labels of
+// their regions as the basis; the others to "Withheld".
+func PrivilegeLog(entries []PrivilegeEntry, records []RedactionRecord, fmtString string) ([]PrivilegeEntry, error) {
+	log := []PrivilegeEntry{}
+	byPath := map[string]int{}
+	byBates := map[string]int{}
+	for i, e := range entries {
+		for _, s := range []*string{&e.BegBates, &e.EndBates} {
+			if *s == "" {
+				continue
+			}
+			n, err := batesNumber(fmtString, *s)
+			if err != nil {
+				return nil, fmt.Errorf("privilege log entry %d: %w", i+1, err)
+			}
+			*s = fmt.Sprintf(fmtString, n)
+		}
+		if e.Path != "" {
+			byPath[filepath.Clean(e.Path)] = len(log)
+		}
+		if e.BegBates != "" {
+			byBates[e.BegBates] = len(log)
+		}
+		e.Redactions = nil
+		log = append(log, e)
+	}
+	for _, r := range records {
+		i, ok := byPath[filepath.Clean(r.File)]
+		if !ok {
+			i, ok = byBates[recordBates(r.File, fmtString)]
+		}
+		if !ok {
+			i = len(log)
+			byPath[filepath.Clean(r.File)] = i
+			log = append(log, PrivilegeEntry{Path: r.File})
+		}
+		log[i].Redactions = append(log[i].Redactions, r)
+	}
+
+	for i := range log {
+		e := &log[i]
+		if e.Treatment == "" {
+			e.Treatment = "Withheld"
+			if len(e.Redactions) > 0 {
+				e.Treatment = "Redacted"
+			}
+		}
+		if e.Basis == "" {
+			labels := []string{}
+			seen := map[string]bool{}
+			for _, r := range e.Redactions {
+				if r.Label != "" && !seen[r.Label] {
+					seen[r.Label] = true
+					labels = append(labels, r.Label)
+				}
+			}
+			e.Basis = strings.Join(labels, "; ")
+		}
+	}
+	return log, nil
+}
+
+// BatesRange returns the Bates range of e, or its path if it has none
+func (e PrivilegeEntry) BatesRange() string {
+	switch {
+	case e.BegBates == "":
+		return e.Path
+	case e.EndBates == "" || e.EndBates == e.BegBates:
+		return e.BegBates
+	}
+	return e.BegBates + " - " + e.EndBates
+}
+
+// RedactedPages lists the pages of e with redactions and their number,
+// e.g. "ABC-00000002 (2), ABC-00000004", by Bates number if the entry
+// has one of fmtString
+func (e PrivilegeEntry) RedactedPages(fmtString string) string {
+	counts := map[int]int{}
+	pages := []int{}
+	for _, r := range e.Redactions {
+		if counts[r.Page] == 0 {
+			pages = append(pages, r.Page)
+		}
+		counts[r.Page]++
+	}
+	sort.Ints(pages)
+
+	beg, err := batesNumber(fmtString, e.BegBates)
+	parts := []string{}
+	for _, p := range pages {
+		s := fmt.Sprintf("p. %d", p)
+		if err == nil {
+			s = fmt.Sprintf(fmtString, beg+int64(p)-1)
+		}
+		if counts[p] > 1 {
+			s += fmt.Sprintf(" (%d)", counts[p])
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// privilegeColumns are the columns of a privilege log
+var privilegeColumns = []string{
+	"No.", "Bates Range", "Date", "Author", "Recipients", "Privilege Basis", "Description", "Treatment", "Redactions",
+}
+
+// privilegeRow returns the columns of entry i (starting at 0) of a log
+func privilegeRow(i int, e PrivilegeEntry, fmtString string) []string {
+	return []string{
+		strconv.Itoa(i + 1),
+		e.BatesRange(),
+		e.Date,
+		e.Author,
+		e.Recipients,
+		e.Basis,
+		e.Description,
+		e.Treatment,
+		e.RedactedPages(fmtString),
+	}
+}
+
+// WritePrivilegeLogCSV writes log to w as CSV. If excel, it is written
+// for spreadsheets to open as is: with a UTF-8 byte order mark, CRLF line
+// endings, and fields that would be read as formulas quoted with a
+// leading apostrophe.
+func WritePrivilegeLogCSV(w io.Writer, log []PrivilegeEntry, fmtString string, excel bool) error {
+	if excel {
+		if _, err := io.WriteString(w, "\ufeff"); err != nil {
+			return err
+		}
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = excel
+	if err := cw.Write(privilegeColumns); err != nil {
+		return err
+	}
+	for i, e := range log {
+		row := privilegeRow(i, e, fmtString)
+		if excel {
+			for j, f := range row {
+				if f != "" && strings.ContainsRune("=+-@\t\r", rune(f[0])) {
+					row[j] = "'" + f
+				}
+			}
+		}
+		if err := cw.Write(row); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// PrivilegeLogOptions configures the PDF table of a privilege log
+type PrivilegeLogOptions struct {
+	Title    string  // heading of each page
+	FontSize float64 // of the table
+}
+
+// DefaultPrivilegeLogOptions returns the options of a "Privilege Log"
+func DefaultPrivilegeLogOptions() PrivilegeLogOptions {
+	return PrivilegeLogOptions{
+		Title:    "Privilege Log",
+		FontSize: 8,
+	}
+}
+
+// privilege log layout, in points, on landscape Letter pages
+const (
+	logWidth   = 792
+	logHeight  = 612
+	logMargin  = 36
+	logPadding = 3 // inside each cell
+)
+
+// logColumnWidths are the widths of the columns of the PDF table, the
+// description taking what remains
+var logColumnWidths = []float64{24, 100, 56, 74, 96, 84, 0, 56, 80}
+
+// wrapText breaks s into lines of at most width points in the core font
+// fontName of the given size, breaking words only when they do not fit
+// on a line of their own
+func wrapText(s string, fontName string, size, width float64) [][]byte {
+	lines := [][]byte{}
+	for _, para := range strings.Split(s, "\n") {
+		start := len(lines)
+		line := []byte{}
+		for _, word := range strings.Fields(para) {
+			w := winAnsiBytes(word)
+			candidate := append(append(append([]byte{}, line...), ' '), w...)
+			if len(line) == 0 {
+				candidate = w
+			}
+			if coreTextWidth(candidate, fontName)*size <= width {
+				line = candidate
+				continue
+			}
+			if len(line) > 0 {
+				lines = append(lines, line)
+			}
+			line = nil
+			for len(w) > 0 {
+				n := len(w)
+				for n > 1 && coreTextWidth(w[:n], fontName)*size > width {
+					n--
+				}
+				if n == len(w) {
+					line = w
+					break
+				}
+				lines = append(lines, w[:n])
+				w = w[n:]
+			}
+		}
+		if len(line) > 0 || len(lines) == start {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// PrivilegeLogPDF writes log to w as a PDF table on landscape Letter
+// pages, repeating the heading and the column names on each page and
+// numbering the pages. Rows too tall for a page are continued on the
+// next.
+func PrivilegeLogPDF(w io.Writer, log []PrivilegeEntry, fmtString string, opts PrivilegeLogOptions) (err error) {
+	const op = "privlog"
+	defer recoverCorrupt(op, &err)
+
+	if opts.FontSize <= 0 || opts.FontSize > 24 {
+		return optionErr(op, fmt.Errorf("font size %g out of range (expected up to 24)", opts.FontSize))
+	}
+	widths := append([]float64{}, logColumnWidths...)
+	rest := float64(logWidth - 2*logMargin)
+	for _, cw := range widths {
+		rest -= cw
+	}
+	for i, cw := range widths {
+		if cw == 0 {
+			widths[i] = rest
+		}
+	}
+	size := opts.FontSize
+	leading := 1.2 * size
+	top := float64(logHeight - logMargin)
+	if opts.Title != "" {
+		top -= 2 * (size + 4)
+	}
+	bottom := float64(logMargin) + 2*size // above the page number
+
+	// rowHeight returns the height of a row of the lines of each column
+	rowHeight := func(lines [][][]byte) float64 {
+		height := 0.0
+		for _, cell := range lines {
+			height = math.Max(height, float64(len(cell))*leading+2*logPadding)
+		}
+		return height
+	}
+	// cells returns the lines of each column of a row and its height
+	cells := func(row []string, fontName string) ([][][]byte, float64) {
+		lines := make([][][]byte, len(row))
+		for i, s := range row {
+			lines[i] = wrapText(s, fontName, size, widths[i]-2*logPadding)
+		}
+		return lines, rowHeight(lines)
+	}
+	header, headerHeight := cells(privilegeColumns, "Helvetica-Bold")
+	fit := int((top - headerHeight - bottom - 2*logPadding) / leading)
+	if fit < 1 {
+		return optionErr(op, fmt.Errorf("font size %g is too large for the privilege log", size))
+	}
+
+	// drawRow draws a row with its top at y
+	drawRow := func(b *bytes.Buffer, lines [][][]byte, height, y float64, font string) {
+		x := float64(logMargin)
+		for i, cell := range lines {
+			fmt.Fprintf(b, "%s %s %s %s re S\n", formatNumber(x), formatNumber(y-height), formatNumber(widths[i]), formatNumber(height))
+			for j, line := range cell {
+				if len(line) == 0 {
+					continue
+				}
+				fmt.Fprintf(b, "BT %s %s Tf %s %s Td <%x> Tj ET\n", font, formatNumber(size),
+					formatNumber(x+logPadding), formatNumber(y-logPadding-float64(j)*leading-0.8*size), line)
+			}
+			x += widths[i]
+		}
+	}
+
+	pages := []*bytes.Buffer{}
+	var b *bytes.Buffer
+	y := 0.0
+	newPage := func() {
+		b = &bytes.Buffer{}
+		pages = append(pages, b)
+		b.WriteString("q 0.5 w 0 G 0 g\n")
+		if opts.Title != "" {
+			fmt.Fprintf(b, "BT /F2 %s Tf %s %s Td <%x> Tj ET\n", formatNumber(size+4), formatNumber(logMargin),
+				formatNumber(logHeight-logMargin-size-4), winAnsiBytes(opts.Title))
+		}
+		fmt.Fprintf(b, "0.85 g %s %s %s %s re f 0 g\n", formatNumber(logMargin), formatNumber(top-headerHeight),
+			formatNumber(logWidth-2*logMargin), formatNumber(headerHeight))
+		drawRow(b, header, headerHeight, top, "/F2")
+		y = top - headerHeight
+	}
+	newPage()
+	for i, e := range log {
+		lines, height := cells(privilegeRow(i, e, fmtString), "Helvetica")
+		if y-height < bottom && y < top-headerHeight {
+			newPage()
+		}
+		for y-height < bottom {
+			// too tall for a page: draw the lines that fit and continue
+			// the row on the next
+			n := int((y - bottom - 2*logPadding) / leading)
+			part := make([][][]byte, len(lines))
+			for j := range lines {
+				if len(lines[j]) > n {
+					part[j], lines[j] = lines[j][:n], lines[j][n:]
+				} else {
+					part[j], lines[j] = lines[j], nil
+				}
+			}
+			drawRow(b, part, y-bottom, y, "/F1")
+			newPage()
+			height = rowHeight(lines)
+		}
+		drawRow(b, lines, height, y, "/F1")
+		y -= height
+	}
+
+	contents := [][]byte{}
+	for i, content := range pages {
+		number := winAnsiBytes(fmt.Sprintf("Page %d of %d", i+1, len(pages)))
+		fmt.Fprintf(content, "BT /F1 %s Tf %s %s Td <%x> Tj ET\nQ\n", formatNumber(size),
+			formatNumber(logWidth-logMargin-coreTextWidth(number, "Helvetica")*size), formatNumber(logMargin+size/2), number)
+		contents = append(contents, content.Bytes())
+	}
+	return writeContentPDF(w, logWidth, logHeight, contents)
+}
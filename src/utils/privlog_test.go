@@ -0,0 +1,228 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+func TestReadPrivilegeManifest(t *testing.T) {
+	csvManifest := "BegBates,EndBates,Date,Author,Recipients,Basis,Description\n" +
+		"ABC-120,ABC-123,2021-03-02,J. Smith,K. Lee,Attorney-Client,Email re: contract\n"
+	yamlManifest := "- path: memo.pdf\n  treatment: Withheld\n  basis: Work Product\n"
+
+	tests := []struct {
+		name    string
+		format  string
+		input   string
+		want    []PrivilegeEntry
+		wantErr bool
+	}{
+		{"csv", "csv", csvManifest, []PrivilegeEntry{{
+			BegBates: "ABC-120", EndBates: "ABC-123", Date: "2021-03-02", Author: "J. Smith",
+			Recipients: "K. Lee", Basis: "Attorney-Client", Description: "Email re: contract",
+		}}, false},
+		{"yaml", "yml", yamlManifest, []PrivilegeEntry{{Path: "memo.pdf", Treatment: "Withheld", Basis: "Work Product"}}, false},
+		{"no document", "csv", "date,author\n2021-03-02,J. Smith\n", nil, true},
+		{"empty entry", "csv", "begbates,path\n,\n", nil, true},
+		{"unknown format", "xlsx", "", nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadPrivilegeManifest(strings.NewReader(tt.input), tt.format)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ReadPrivilegeManifest() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ReadPrivilegeManifest() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// testPrivilegeLog returns a log of a withheld document and a redacted one
+func testPrivilegeLog(t *testing.T) []PrivilegeEntry {
+	t.Helper()
+	entries := []PrivilegeEntry{
+		{BegBates: "ABC-120", EndBates: "ABC-00000123", Author: "J. Smith", Basis: "Attorney-Client"},
+		{BegBates: "ABC-00000200", EndBates: "ABC-00000205", Path: "in/ABC-00000200.pdf", Description: "Memo"},
+	}
+	region := func(file string, page int, label string) RedactionRecord {
+		return RedactionRecord{File: file, RedactedRegion: RedactedRegion{Redaction: Redaction{Page: page, Label: label}}}
+	}
+	records := []RedactionRecord{
+		region("ABC-00000200.pdf", 4, "PRIVILEGE"),
+		region("ABC-00000200.pdf", 2, "PRIVILEGE"),
+		region("ABC-00000200.pdf", 4, "PII"),
+		region("other.pdf", 1, ""),
+	}
+	log, err := PrivilegeLog(entries, records, GenerateFmtString("ABC", "-", 8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return log
+}
+
+func TestPrivilegeLog(t *testing.T) {
+	fmtString := GenerateFmtString("ABC", "-", 8)
+	log := testPrivilegeLog(t)
+	if len(log) != 3 {
+		t.Fatalf("PrivilegeLog() = %d entries, want 3", len(log))
+	}
+
+	tests := []struct {
+		name       string
+		entry      PrivilegeEntry
+		bates      string
+		treatment  string
+		basis      string
+		redactions string
+	}{
+		{"withheld", log[0], "ABC-00000120 - ABC-00000123", "Withheld", "Attorney-Client", ""},
+		{"redacted", log[1], "ABC-00000200 - ABC-00000205", "Redacted", "PRIVILEGE; PII", "ABC-00000201, ABC-00000203 (2)"},
+		{"redacted without entry", log[2], "other.pdf", "Redacted", "", "p. 1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.entry.BatesRange(); got != tt.bates {
+				t.Errorf("BatesRange() = %q, want %q", got, tt.bates)
+			}
+			if tt.entry.Treatment != tt.treatment || tt.entry.Basis != tt.basis {
+				t.Errorf("treatment and basis = %q, %q, want %q, %q", tt.entry.Treatment, tt.entry.Basis, tt.treatment, tt.basis)
+			}
+			if got := tt.entry.RedactedPages(fmtString); got != tt.redactions {
+				t.Errorf("RedactedPages() = %q, want %q", got, tt.redactions)
+			}
+		})
+	}
+
+	// documents of the same name are told apart by their paths
+	entries := []PrivilegeEntry{{Path: "a/memo.pdf"}, {Path: "b/memo.pdf"}}
+	records := []RedactionRecord{
+		{File: "b/memo.pdf", RedactedRegion: RedactedRegion{Redaction: Redaction{Page: 2}}},
+		{File: "./a/memo.pdf", RedactedRegion: RedactedRegion{Redaction: Redaction{Page: 1}}},
+		{File: "c/memo.pdf", RedactedRegion: RedactedRegion{Redaction: Redaction{Page: 3}}},
+	}
+	log, err := PrivilegeLog(entries, records, fmtString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []string{}
+	for _, e := range log {
+		got = append(got, e.BatesRange()+" "+e.RedactedPages(fmtString))
+	}
+	if want := []string{"a/memo.pdf p. 1", "b/memo.pdf p. 2", "c/memo.pdf p. 3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PrivilegeLog() of documents of the same name = %q, want %q", got, want)
+	}
+
+	if _, err := PrivilegeLog([]PrivilegeEntry{{BegBates: "XYZ-1"}}, nil, fmtString); err == nil {
+		t.Error("PrivilegeLog() of another prefix succeeded")
+	}
+}
+
+func TestWritePrivilegeLogCSV(t *testing.T) {
+	fmtString := GenerateFmtString("ABC", "-", 8)
+	log := []PrivilegeEntry{{BegBates: "ABC-00000001", Author: "=HYPERLINK(\"x\")", Description: "two\nlines", Treatment: "Withheld"}}
+
+	var b bytes.Buffer
+	if err := WritePrivilegeLogCSV(&b, log, fmtString, false); err != nil {
+		t.Fatal(err)
+	}
+	want := "No.,Bates Range,Date,Author,Recipients,Privilege Basis,Description,Treatment,Redactions\n" +
+		"1,ABC-00000001,,\"=HYPERLINK(\"\"x\"\")\",,,\"two\nlines\",Withheld,\n"
+	if b.String() != want {
+		t.Errorf("WritePrivilegeLogCSV() = %q, want %q", b.String(), want)
+	}
+
+	b.Reset()
+	if err := WritePrivilegeLogCSV(&b, log, fmtString, true); err != nil {
+		t.Fatal(err)
+	}
+	want = "\ufeffNo.,Bates Range,Date,Author,Recipients,Privilege Basis,Description,Treatment,Redactions\r\n" +
+		"1,ABC-00000001,,\"'=HYPERLINK(\"\"x\"\")\",,,\"two\r\nlines\",Withheld,\r\n"
+	if b.String() != want {
+		t.Errorf("WritePrivilegeLogCSV() for excel = %q, want %q", b.String(), want)
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		width float64
+		want  []string
+	}{
+		{"fits", "Attorney-Client Privilege", 200, []string{"Attorney-Client Privilege"}},
+		{"words", "Email from counsel re: terms", 60, []string{"Email from", "counsel re:", "terms"}},
+		{"long word", "ABC-00000001", 30, []string{"ABC-00", "000001"}},
+		{"line breaks", "a\n\nb", 60, []string{"a", "", "b"}},
+		{"empty", "", 60, []string{""}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := []string{}
+			for _, line := range wrapText(tt.s, "Helvetica", 8, tt.width) {
+				got = append(got, string(line))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("wrapText() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrivilegeLogPDF(t *testing.T) {
+	fmtString := GenerateFmtString("ABC", "-", 8)
+	log := testPrivilegeLog(t)
+	for i := 0; i < 40; i++ {
+		log = append(log, PrivilegeEntry{BegBates: "ABC-00000300", Description: strings.Repeat("long description ", 10), Treatment: "Withheld"})
+	}
+	log = append(log, PrivilegeEntry{BegBates: "ABC-00000400", Description: strings.Repeat("too tall ", 2000), Treatment: "Withheld"})
+
+	var b bytes.Buffer
+	if err := PrivilegeLogPDF(&b, log, fmtString, DefaultPrivilegeLogOptions()); err != nil {
+		t.Fatal(err)
+	}
+	ctx := readTestPDF(t, b.Bytes())
+	if err := api.ValidateContext(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.PageCount < 3 {
+		t.Fatalf("page count = %d, want at least 3", ctx.PageCount)
+	}
+	text, _ := pageText(t, ctx)
+	for _, want := range []string{"Privilege Log", "Bates Range", "ABC-00000120 -\nABC-00000123", "PRIVILEGE; PII", "ABC-00000203 (2)", "Page 1 of"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("page 1 does not show %q:\n%s", want, text)
+		}
+	}
+
+	// the table, continued where too tall, stays within the margins
+	const e = 0.01
+	all := ""
+	for nr := 1; nr <= ctx.PageCount; nr++ {
+		glyphs, err := pageGlyphs(ctx, nr, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, g := range glyphs {
+			all += g.text
+			if g.box.LL.Y < logMargin-e || g.box.UR.Y > logHeight-logMargin+e || g.box.LL.X < logMargin-e || g.box.UR.X > logWidth-logMargin+e {
+				t.Fatalf("page %d: %q at %v is outside the margins", nr, g.text, g.box)
+			}
+		}
+	}
+	if n := strings.Count(all, "tall"); n != 2000 {
+		t.Errorf("the tall row shows %d of its 2000 words", n)
+	}
+
+	opts := DefaultPrivilegeLogOptions()
+	opts.FontSize = 30
+	if err := PrivilegeLogPDF(&bytes.Buffer{}, log, fmtString, opts); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("PrivilegeLogPDF() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
@@ -0,0 +1,1068 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"io"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/filter"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/matrix"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// Redaction is a region of a page to redact, in points from the lower
+// left corner of the page's crop box, before any rotation of the page
+type Redaction struct {
+	Page   int     `json:"page"`
+	X      float64 `json:"x"`
+	Y      float64 `json:"y"`
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
+	Label  string  `json:"label,omitempty"` // e.g. "REDACTED – PRIVILEGE"
+}
+
+// redactionFields are the recognized columns of a CSV file of redactions
+var redactionFields = []string{"page", "x", "y", "width", "height", "label"}
+
+// ReadRedactions reads redaction regions from r, either a JSON list of
+// objects with the keys page, x, y, width, height and label or, if
+// format is "csv", a CSV file with a header row naming the same columns.
+// Only label is optional.
+func ReadRedactions(r io.Reader, format string) ([]Redaction, error) {
+	regions := []Redaction{}
+	switch strings.ToLower(format) {
+	case "json":
+		if err := json.NewDecoder(r).Decode(&regions); err != nil && err != io.EOF {
+			return nil, err
+		}
+	case "csv":
+		cr := csv.NewReader(r)
+		cr.FieldsPerRecord = -1
+		records, err := cr.ReadAll()
+		if err != nil {
+			return nil, err
+		}
+		if len(records) == 0 {
+			return regions, nil
+		}
+		columns := map[string]int{}
+		for i, name := range records[0] {
+			columns[strings.ToLower(strings.TrimSpace(name))] = i
+		}
+		for _, name := range redactionFields[:5] {
+			if _, ok := columns[name]; !ok {
+				return nil, fmt.Errorf("redactions have no `%s` column (expected %s)", name, strings.Join(redactionFields, ","))
+			}
+		}
+		field := func(record []string, name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(record) {
+				return ""
+			}
+			return strings.TrimSpace(record[i])
+		}
+		for n, record := range records[1:] {
+			nums := make([]float64, 5)
+			for i, name := range redactionFields[:5] {
+				if nums[i], err = strconv.ParseFloat(field(record, name), 64); err != nil {
+					return nil, fmt.Errorf("redaction %d: invalid %s `%s`", n+1, name, field(record, name))
+				}
+			}
+			regions = append(regions, Redaction{
+				Page:   int(nums[0]),
+				X:      nums[1],
+				Y:      nums[2],
+				Width:  nums[3],
+				Height: nums[4],
+				Label:  field(record, "label"),
+			})
+		}
+	default:
+		return nil, fmt.Errorf("unknown redactions format `%s` (expected csv or json)", format)
+	}
+	return regions, nil
+}
+
+// RedactOptions configures redaction
+type RedactOptions struct {
+	Regions  []Redaction
+	Terms    []string // text to find and redact, ignoring case
+	Patterns []string // regular expressions to find and redact
+	Label    string   // for regions without a label of their own
+}
+
+// RedactedRegion reports a region redacted and what was removed under it
+type RedactedRegion struct {
+	Redaction
+	Match       string `json:"match,omitempty"` // the term or pattern that found the region
+	Glyphs      int    `json:"glyphs"`          // characters of text removed
+	Paths       int    `json:"paths"`           // vector paths removed or cut back
+	Images      int    `json:"images"`          // images removed or blacked out
+	Annotations int    `json:"annotations"`     // annotations removed
+}
+
+// RedactionRecord is a region redacted from a file, as kept in the
+// redaction log of the redact command. A log is also a JSON list of
+// redactions (see ReadRedactions).
+type RedactionRecord struct {
+	File string `json:"file"` // the file redacted
+	RedactedRegion
+}
+
+// ReadRedactionLog reads the records of a redaction log from r
+func ReadRedactionLog(r io.Reader) ([]RedactionRecord, error) {
+	records := []RedactionRecord{}
+	if err := json.NewDecoder(r).Decode(&records); err != nil && err != io.EOF {
+		return nil, err
+	}
+	return records, nil
+}
+
+// WriteRedactionLog writes records to w as a redaction log
+func WriteRedactionLog(w io.Writer, records []RedactionRecord) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(records)
+}
+
+// redactionTag marks the content drawing the boxes over redactions
+const redactionTag = "PDFToolRedaction"
+
+// label sizes, in points
+const (
+	maxLabelSize = 10
+	minLabelSize = 4
+)
+
+// redactRegion is a region being redacted, in the user space of its page
+type redactRegion struct {
+	box    types.Rectangle
+	report *RedactedRegion
+}
+
+// sliver is the overlap, in points, below which content merely touching
+// a region is not redacted
+const sliver = 0.5
+
+// overlaps reports whether box overlaps region by more than a sliver, or
+// lies within it
+func overlaps(box, region types.Rectangle) bool {
+	overlap := func(lo, hi, rlo, rhi float64) bool {
+		d := math.Min(hi, rhi) - math.Max(lo, rlo)
+		return d > math.Min(sliver, (hi-lo)/2) || d >= 0 && lo >= rlo && hi <= rhi
+	}
+	return overlap(box.LL.X, box.UR.X, region.LL.X, region.UR.X) &&
+		overlap(box.LL.Y, box.UR.Y, region.LL.Y, region.UR.Y)
+}
+
+// invert returns the inverse of m, if any
+func invert(m matrix.Matrix) (matrix.Matrix, bool) {
+	a, b, c, d, e, f := m[0][0], m[0][1], m[1][0], m[1][1], m[2][0], m[2][1]
+	det := a*d - b*c
+	if det == 0 {
+		return m, false
+	}
+	return matrix.Matrix{{d / det, -b / det, 0}, {-c / det, a / det, 0}, {(c*f - d*e) / det, (b*e - a*f) / det, 1}}, true
+}
+
+// pageOrigin returns the lower left corner of the crop box of a page
+func pageOrigin(inh *model.InheritedPageAttrs) types.Point {
+	switch {
+	case inh.CropBox != nil:
+		return inh.CropBox.LL
+	case inh.MediaBox != nil:
+		return inh.MediaBox.LL
+	}
+	return types.Point{}
+}
+
+// pageGlyphs returns the glyphs shown on page nr, in its user space,
+// passing over marked content tagged skip
+func pageGlyphs(ctx *model.Context, nr int, skip string) ([]glyph, error) {
+	page, _, inh, err := ctx.PageDict(nr, false)
+	if err != nil {
+		return nil, err
+	}
+	content, err := ctx.PageContent(page)
+	if err != nil {
+		return nil, err
+	}
+	glyphs := []glyph{}
+	err = walkGlyphs(ctx, content, inh.Resources, matrix.IdentMatrix, skip, func(g glyph) {
+		glyphs = append(glyphs, g)
+	})
+	return glyphs, err
+}
+
+// glyphBreak returns the space or newline read between the glyphs prev
+// and g, if any
+func glyphBreak(prev, g glyph) string {
+	dx, dy := prev.to.X-prev.from.X, prev.to.Y-prev.from.Y
+	n := math.Hypot(dx, dy)
+	if n == 0 {
+		dx, dy, n = 1, 0, 1
+	}
+	dx, dy = dx/n, dy/n
+	h := math.Max(prev.height, g.height)
+	ox, oy := g.from.X-prev.to.X, g.from.Y-prev.to.Y
+	across := math.Abs(ox*dy - oy*dx)
+	along := ox*dx + oy*dy
+	switch {
+	case across > h/2 || along < -h:
+		return "\n"
+	case along > h/5 && prev.text != " " && g.text != " ":
+		return " "
+	}
+	return ""
+}
+
+// findText returns the boxes of the glyphs whose text matches re, a box
+// for each line of a match
+func findText(glyphs []glyph, re *regexp.Regexp) []types.Rectangle {
+	var text strings.Builder
+	owners := []int{} // the glyph of each byte of text, or -1 between glyphs
+	for i, g := range glyphs {
+		if i > 0 {
+			sep := glyphBreak(glyphs[i-1], g)
+			text.WriteString(sep)
+			for range sep {
+				owners = append(owners, -1)
+			}
+		}
+		text.WriteString(g.text)
+		for j := 0; j < len(g.text); j++ {
+			owners = append(owners, i)
+		}
+	}
+
+	s := text.String()
+	boxes := []types.Rectangle{}
+	for _, m := range re.FindAllStringIndex(s, -1) {
+		var box *types.Rectangle
+		for j := m[0]; j < m[1]; j++ {
+			i := owners[j]
+			switch {
+			case i < 0 && s[j] == '\n' && box != nil:
+				boxes = append(boxes, *box)
+				box = nil
+			case i < 0:
+			case box == nil:
+				b := glyphs[i].box
+				box = &b
+			default:
+				*box = extendBox(extendBox(*box, glyphs[i].box.LL), glyphs[i].box.UR)
+			}
+		}
+		if box != nil {
+			boxes = append(boxes, *box)
+		}
+	}
+	return boxes
+}
+
+// redactPatterns returns the regular expressions of opts, by the term or
+// pattern they are made from
+func redactPatterns(opts RedactOptions) ([]*regexp.Regexp, []string, error) {
+	res, sources := []*regexp.Regexp{}, []string{}
+	for _, term := range opts.Terms {
+		if strings.TrimSpace(term) == "" {
+			continue
+		}
+		words := strings.Fields(term)
+		for i := range words {
+			words[i] = regexp.QuoteMeta(words[i])
+		}
+		res = append(res, regexp.MustCompile(`(?i)`+strings.Join(words, `\s+`)))
+		sources = append(sources, term)
+	}
+	for _, p := range opts.Patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, nil, err
+		}
+		res = append(res, re)
+		sources = append(sources, p)
+	}
+	return res, sources, nil
+}
+
+// redactor removes what lies under regions from the content of a page
+type redactor struct {
+	ctx     *model.Context
+	regions []*redactRegion
+}
+
+// hit returns the first region overlapping box, or nil
+func (r *redactor) hit(box types.Rectangle) *redactRegion {
+	for _, rg := range r.regions {
+		if overlaps(box, rg.box) {
+			return rg
+		}
+	}
+	return nil
+}
+
+// addResource adds o to category of resources, e.g. "XObject", under a
+// new name starting with prefix, and returns the name
+func (r *redactor) addResource(resources types.Dict, category, prefix string, o types.Object) string {
+	d, _ := r.ctx.DereferenceDict(resources[category])
+	if d == nil {
+		d = types.Dict{}
+		resources[category] = d
+	}
+	for n := 1; ; n++ {
+		name := prefix + strconv.Itoa(n)
+		if _, ok := d[name]; !ok {
+			d[name] = o
+			return name
+		}
+	}
+}
+
+// rewriteText returns the text operator op showing glyphs without those
+// removed, moving the glyphs after each run of removed ones as far as
+// before. A run is replaced by a single adjustment, so that the widths of
+// the glyphs removed cannot be read from it.
+func rewriteText(op contentOp, glyphs []glyph, removed map[int]bool) string {
+	var b strings.Builder
+	elems := []token{}
+	if op.name == "TJ" {
+		a, _ := op.operand(tokArray)
+		elems = a.elems
+	} else {
+		s, _ := op.operand(tokString)
+		elems = []token{s}
+	}
+	switch op.name {
+	case "'":
+		b.WriteString("T* ")
+	case "\"":
+		fmt.Fprintf(&b, "%s Tw %s Tc T* ", formatNumber(op.operands[0].num), formatNumber(op.operands[1].num))
+	}
+
+	// adjustments are summed until the next glyph kept
+	b.WriteByte('[')
+	adjust := 0.0
+	k := 0
+	for e, t := range elems {
+		switch t.kind {
+		case tokNumber:
+			adjust += t.num
+		case tokString:
+			kept := []byte{}
+			flush := func() {
+				if len(kept) > 0 {
+					b.WriteString("<" + hex.EncodeToString(kept) + ">")
+					kept = []byte{}
+				}
+			}
+			for ; k < len(glyphs) && glyphs[k].elem == e; k++ {
+				g := glyphs[k]
+				if !removed[k] {
+					if adjust != 0 {
+						b.WriteString(" " + formatNumber(adjust) + " ")
+						adjust = 0
+					}
+					kept = append(kept, t.str[g.lo:g.hi]...)
+					continue
+				}
+				flush()
+				if g.size != 0 {
+					adjust -= g.advance * 1000 / g.size
+				}
+			}
+			flush()
+		}
+	}
+	if adjust != 0 {
+		b.WriteString(" " + formatNumber(adjust) + " ")
+	}
+	b.WriteString("] TJ")
+	return b.String()
+}
+
+// cutRects returns rects less the regions
+func (r *redactor) cutRects(rects []types.Rectangle) []types.Rectangle {
+	for _, rg := range r.regions {
+		g := rg.box
+		cut := []types.Rectangle{}
+		for _, p := range rects {
+			if p.UR.X <= g.LL.X || g.UR.X <= p.LL.X || p.UR.Y <= g.LL.Y || g.UR.Y <= p.LL.Y {
+				cut = append(cut, p)
+				continue
+			}
+			lo, hi := math.Max(p.LL.Y, g.LL.Y), math.Min(p.UR.Y, g.UR.Y)
+			if p.LL.Y < g.LL.Y {
+				cut = append(cut, *types.NewRectangle(p.LL.X, p.LL.Y, p.UR.X, g.LL.Y))
+			}
+			if g.UR.Y < p.UR.Y {
+				cut = append(cut, *types.NewRectangle(p.LL.X, g.UR.Y, p.UR.X, p.UR.Y))
+			}
+			if p.LL.X < g.LL.X {
+				cut = append(cut, *types.NewRectangle(p.LL.X, lo, g.LL.X, hi))
+			}
+			if g.UR.X < p.UR.X {
+				cut = append(cut, *types.NewRectangle(g.UR.X, lo, p.UR.X, hi))
+			}
+		}
+		rects = cut
+	}
+	return rects
+}
+
+// imageComponents returns the color components of the image sd, and the
+// value of each painting black. Image masks have a component painting
+// nothing.
+func (r *redactor) imageComponents(sd *types.StreamDict) ([]int, int, bool) {
+	if mask := sd.BooleanEntry("ImageMask"); mask != nil && *mask {
+		return []int{1}, 1, true
+	}
+	bpc := sd.IntEntry("BitsPerComponent")
+	if bpc == nil {
+		return nil, 0, false
+	}
+	max := 1<<*bpc - 1
+	space := ""
+	n := 0
+	cs, _ := r.ctx.Dereference(sd.Dict["ColorSpace"])
+	switch cs := cs.(type) {
+	case types.Name:
+		space = cs.Value()
+	case types.Array:
+		if len(cs) == 2 {
+			if name, ok := cs[0].(types.Name); ok {
+				space = name.Value()
+			}
+			if space == "ICCBased" {
+				if icc, _, _ := r.ctx.DereferenceStreamDict(cs[1]); icc != nil && icc.IntEntry("N") != nil {
+					n = *icc.IntEntry("N")
+				}
+			}
+		}
+	}
+	switch {
+	case space == "DeviceGray" || space == "CalGray" || n == 1:
+		return []int{0}, *bpc, true
+	case space == "DeviceRGB" || space == "CalRGB" || n == 3:
+		return []int{0, 0, 0}, *bpc, true
+	case space == "DeviceCMYK" || n == 4:
+		return []int{0, 0, 0, max}, *bpc, true
+	}
+	return nil, 0, false
+}
+
+// blackOut returns a copy of the image sd, drawn with ctm, blacked out
+// under the regions, or cleared for image masks. It fails for images it
+// cannot decode.
+func (r *redactor) blackOut(sd *types.StreamDict, ctm matrix.Matrix) (*types.StreamDict, bool) {
+	inv, ok := invert(ctm)
+	w, h := sd.IntEntry("Width"), sd.IntEntry("Height")
+	if !ok || w == nil || h == nil || *w <= 0 || *h <= 0 {
+		return nil, false
+	}
+	width, height := *w, *h
+	clamp := func(v float64) float64 { return math.Max(0, math.Min(1, v)) }
+	pixels := []image.Rectangle{}
+	for _, rg := range r.regions {
+		// images fill the unit square, their first row at the top
+		b := transformBox(inv, rg.box.LL.X, rg.box.LL.Y, rg.box.UR.X, rg.box.UR.Y)
+		p := image.Rect(
+			int(math.Floor(clamp(b.LL.X)*float64(width))), int(math.Floor((1-clamp(b.UR.Y))*float64(height))),
+			int(math.Ceil(clamp(b.UR.X)*float64(width))), int(math.Ceil((1-clamp(b.LL.Y))*float64(height))))
+		if !p.Empty() {
+			pixels = append(pixels, p)
+		}
+	}
+
+	img := sd.Clone().(types.StreamDict)
+	if img.HasSoleFilterNamed(filter.DCT) {
+		if _, ok := img.Find("Decode"); ok {
+			return nil, false
+		}
+		src, err := jpeg.Decode(bytes.NewReader(img.Raw))
+		if err != nil {
+			return nil, false
+		}
+		bounds := src.Bounds()
+		var dst draw.Image
+		switch src.(type) {
+		case *image.Gray:
+			dst = image.NewGray(bounds)
+		case *image.YCbCr:
+			dst = image.NewRGBA(bounds)
+		default:
+			return nil, false
+		}
+		draw.Draw(dst, bounds, src, bounds.Min, draw.Src)
+		for _, p := range pixels {
+			draw.Draw(dst, p.Add(bounds.Min), image.Black, image.Point{}, draw.Src)
+		}
+		var b bytes.Buffer
+		if err := jpeg.Encode(&b, dst, &jpeg.Options{Quality: 90}); err != nil {
+			return nil, false
+		}
+		img.Raw, img.Content = b.Bytes(), nil
+		length := int64(b.Len())
+		img.StreamLength = &length
+		img.Update("Length", types.Integer(length))
+		img.Delete("DecodeParms")
+		return &img, true
+	}
+
+	for _, f := range img.FilterPipeline {
+		if f.Name == filter.DCT || f.Name == filter.JPX || f.Name == filter.JBIG2 {
+			return nil, false
+		}
+	}
+	black, bpc, ok := r.imageComponents(&img)
+	if !ok || bpc != 1 && bpc != 2 && bpc != 4 && bpc != 8 && bpc != 16 {
+		return nil, false
+	}
+	if err := img.Decode(); err != nil {
+		return nil, false
+	}
+	comps := len(black)
+	rowBytes := (width*comps*bpc + 7) / 8
+	if len(img.Content) < rowBytes*height {
+		return nil, false
+	}
+	// a copy, as the content may be the raw bytes of sd
+	pix := append([]byte{}, img.Content...)
+	max := 1<<bpc - 1
+	if decode := img.ArrayEntry("Decode"); len(decode) >= 2*comps {
+		for c := range black {
+			lo, _ := number(r.ctx, decode[2*c])
+			hi, _ := number(r.ctx, decode[2*c+1])
+			if lo > hi {
+				black[c] = max - black[c]
+			}
+		}
+	}
+	for _, p := range pixels {
+		for y := p.Min.Y; y < p.Max.Y; y++ {
+			for x := p.Min.X; x < p.Max.X; x++ {
+				for c, v := range black {
+					bit := (x*comps + c) * bpc
+					i := y*rowBytes + bit/8
+					switch bpc {
+					case 8:
+						pix[i] = byte(v)
+					case 16:
+						pix[i], pix[i+1] = byte(v>>8), byte(v)
+					default:
+						shift := 8 - bpc - bit%8
+						mask := byte(max << shift)
+						pix[i] = pix[i]&^mask | byte(v<<shift)&mask
+					}
+				}
+			}
+		}
+	}
+	img.Content, img.Raw = pix, nil
+	img.FilterPipeline = []types.PDFFilter{{Name: filter.Flate}}
+	img.Update("Filter", types.Name(filter.Flate))
+	img.Delete("DecodeParms")
+	if err := img.Encode(); err != nil {
+		return nil, false
+	}
+	return &img, true
+}
+
+// ownResources returns a copy of resources, with copies of the
+// categories content adds to and removes from, to change for one page or
+// form only
+func (r *redactor) ownResources(resources types.Dict) types.Dict {
+	own := types.Dict{}
+	for k, v := range resources {
+		own[k] = v
+	}
+	for _, category := range []string{"Font", "XObject", "Properties"} {
+		if d, _ := r.ctx.DereferenceDict(own[category]); d != nil {
+			c := types.Dict{}
+			for k, v := range d {
+				c[k] = v
+			}
+			own[category] = c
+		}
+	}
+	return own
+}
+
+// alternatives are the entries of marked content properties repeating
+// its text
+var alternatives = []string{"ActualText", "Alt", "E"}
+
+// dropAlternatives returns the BDC operator op without the text
+// alternatives of its properties, dropping those of named properties
+// from resources, and whether it changed
+func (r *redactor) dropAlternatives(op contentOp, resources types.Dict) (string, bool) {
+	if op.name != "BDC" || len(op.operands) != 2 {
+		return "", false
+	}
+	switch props := op.operands[1]; props.kind {
+	case tokDict:
+		kept := []token{}
+		for i := 0; i+1 < len(props.elems); i += 2 {
+			drop := false
+			for _, key := range alternatives {
+				drop = drop || string(props.elems[i].str) == key
+			}
+			if !drop {
+				kept = append(kept, props.elems[i], props.elems[i+1])
+			}
+		}
+		if len(kept) == len(props.elems) {
+			return "", false
+		}
+		return formatToken(op.operands[0]) + " " + formatToken(token{kind: tokDict, elems: kept}) + " BDC", true
+	case tokName:
+		named, _ := r.ctx.DereferenceDict(resources["Properties"])
+		d, _ := r.ctx.DereferenceDict(named[string(props.str)])
+		if d == nil {
+			return "", false
+		}
+		c := d.Clone().(types.Dict)
+		for _, key := range alternatives {
+			c.Delete(key)
+		}
+		if len(c) < len(d) {
+			named[string(props.str)] = c
+		}
+	}
+	return "", false
+}
+
+// pathOps are the operators building and painting paths
+var pathOps = map[string]bool{
+	"m": true, "l": true, "c": true, "v": true, "y": true, "h": true, "re": true, "W": true, "W*": true,
+	"S": true, "s": true, "f": true, "F": true, "f*": true, "B": true, "B*": true, "b": true, "b*": true, "n": true,
+}
+
+// content returns content, drawn with resources and ctm, without what
+// lies under the regions, and whether anything was removed. Images are
+// blacked out and forms rewritten in copies added to resources, which
+// must be the content's own (see ownResources).
+func (r *redactor) content(content []byte, resources types.Dict, ctm matrix.Matrix, depth int) ([]byte, bool, error) {
+	ops, err := parseContent(content)
+	if err != nil {
+		return nil, false, err
+	}
+	edits := map[int]string{}     // replacement operators, by index, "" for none
+	replaced := map[string]bool{} // XObjects no longer drawn where they were
+	var formErr error
+	w := &contentWalker{ctx: r.ctx}
+
+	w.text = func(i int, glyphs []glyph) {
+		removed := map[int]bool{}
+		for k, g := range glyphs {
+			if rg := r.hit(g.box); rg != nil {
+				removed[k] = true
+				rg.report.Glyphs++
+			}
+		}
+		if len(removed) > 0 {
+			edits[i] = rewriteText(ops[i], glyphs, removed)
+		}
+	}
+	w.path = func(from, to int, box types.Rectangle, rects []types.Rectangle, clip bool, pctm matrix.Matrix) {
+		rg := r.hit(box)
+		if rg == nil || clip && ops[to].name == "n" {
+			return
+		}
+		rg.report.Paths++
+		if clip {
+			// keep the clipping path, painting nothing
+			edits[to] = "n"
+			return
+		}
+		for j := from; j <= to; j++ {
+			if pathOps[ops[j].name] {
+				edits[j] = ""
+			}
+		}
+		// filled rectangles, such as backgrounds and rules, are cut back
+		// to outside the regions
+		inv, ok := invert(pctm)
+		cut := r.cutRects(rects)
+		if rects == nil || len(cut) == 0 || !ok {
+			return
+		}
+		var b strings.Builder
+		fmt.Fprintf(&b, "q %s %s %s %s %s %s cm", formatNumber(inv[0][0]), formatNumber(inv[0][1]),
+			formatNumber(inv[1][0]), formatNumber(inv[1][1]), formatNumber(inv[2][0]), formatNumber(inv[2][1]))
+		for _, c := range cut {
+			fmt.Fprintf(&b, " %s %s %s %s re", formatNumber(c.LL.X), formatNumber(c.LL.Y), formatNumber(c.Width()), formatNumber(c.Height()))
+		}
+		fmt.Fprintf(&b, " %s Q", ops[to].name)
+		edits[from] = b.String()
+	}
+	w.image = func(i int, box types.Rectangle, name string, sd *types.StreamDict, ictm matrix.Matrix) {
+		rg := r.hit(box)
+		if rg == nil {
+			return
+		}
+		rg.report.Images++
+		edits[i] = ""
+		if sd == nil {
+			return
+		}
+		replaced[name] = true
+		if img, ok := r.blackOut(sd, ictm); ok {
+			ir, err := r.ctx.IndRefForNewObject(*img)
+			if err != nil {
+				formErr = err
+				return
+			}
+			edits[i] = formatName(r.addResource(resources, "XObject", "Redacted", *ir)) + " Do"
+		}
+	}
+	w.form = func(i int, box types.Rectangle, name string, sd *types.StreamDict, fctm matrix.Matrix) {
+		if r.hit(box) == nil || formErr != nil {
+			return
+		}
+		if depth >= maxFormDepth {
+			edits[i] = ""
+			replaced[name] = true
+			return
+		}
+		form := sd.Clone().(types.StreamDict)
+		if err := form.Decode(); err != nil {
+			formErr = err
+			return
+		}
+		formRes := r.ownResources(formResources(r.ctx, &form, resources))
+		out, changed, err := r.content(form.Content, formRes, fctm, depth+1)
+		if err != nil || !changed {
+			formErr = err
+			return
+		}
+		form.Dict["Resources"] = formRes
+		form.Content, form.Raw = out, nil
+		form.FilterPipeline = []types.PDFFilter{{Name: filter.Flate}}
+		form.Update("Filter", types.Name(filter.Flate))
+		form.Delete("DecodeParms")
+		if err := form.Encode(); err != nil {
+			formErr = err
+			return
+		}
+		ir, err := r.ctx.IndRefForNewObject(form)
+		if err != nil {
+			formErr = err
+			return
+		}
+		edits[i] = formatName(r.addResource(resources, "XObject", "Redacted", *ir)) + " Do"
+		replaced[name] = true
+	}
+	w.walk(ops, resources, ctm)
+	if formErr != nil {
+		return nil, false, formErr
+	}
+	if len(edits) == 0 {
+		return content, false, nil
+	}
+
+	// drop the XObjects replaced, unless still drawn, and the text
+	// alternatives of marked content with anything removed
+	used := map[string]bool{}
+	open := []int{}           // marked content, by its BMC or BDC operator
+	touched := map[int]bool{} // marked content with anything removed
+	for i, op := range ops {
+		switch op.name {
+		case "BMC", "BDC":
+			open = append(open, i)
+		case "EMC":
+			if len(open) > 0 {
+				open = open[:len(open)-1]
+			}
+		}
+		if _, ok := edits[i]; ok {
+			for _, j := range open {
+				touched[j] = true
+			}
+			continue
+		}
+		if t, ok := op.operand(tokName); ok && op.name == "Do" {
+			used[string(t.str)] = true
+		}
+	}
+	if xobjects, _ := r.ctx.DereferenceDict(resources["XObject"]); xobjects != nil {
+		for name := range replaced {
+			if !used[name] {
+				delete(xobjects, name)
+			}
+		}
+	}
+	for i := range touched {
+		if e, ok := r.dropAlternatives(ops[i], resources); ok {
+			edits[i] = e
+		}
+	}
+
+	var b bytes.Buffer
+	for i, op := range ops {
+		e, ok := edits[i]
+		if !ok {
+			b.Write(op.raw)
+			continue
+		}
+		b.WriteString("\n" + e)
+	}
+	return b.Bytes(), true, nil
+}
+
+// boxes returns the content drawing the boxes of the regions, labelled
+// in a font added to resources
+func (r *redactor) boxes(resources types.Dict) string {
+	var b strings.Builder
+	b.WriteString(formatName(redactionTag) + " BMC\nq 0 g\n")
+	for _, rg := range r.regions {
+		fmt.Fprintf(&b, "%s %s %s %s re f\n", formatNumber(rg.box.LL.X), formatNumber(rg.box.LL.Y),
+			formatNumber(rg.box.Width()), formatNumber(rg.box.Height()))
+	}
+	fontName := ""
+	for _, rg := range r.regions {
+		label := winAnsiBytes(rg.report.Label)
+		if len(label) == 0 {
+			continue
+		}
+		w, h := rg.box.Width(), rg.box.Height()
+		width := coreTextWidth(label, "Helvetica")
+		size := math.Min(maxLabelSize, h*0.6)
+		if width > 0 {
+			size = math.Min(size, (w-4)/width)
+		}
+		if size < minLabelSize {
+			continue
+		}
+		if fontName == "" {
+			fontName = r.addResource(resources, "Font", "Redact", types.Dict{
+				"Type":     types.Name("Font"),
+				"Subtype":  types.Name("Type1"),
+				"BaseFont": types.Name("Helvetica"),
+				"Encoding": types.Name("WinAnsiEncoding"),
+			})
+		}
+		fmt.Fprintf(&b, "BT %s %s Tf 1 g %s %s Td <%x> Tj ET\n", formatName(fontName), formatNumber(size),
+			formatNumber(rg.box.LL.X+(w-width*size)/2), formatNumber(rg.box.LL.Y+(h-0.7*size)/2), label)
+	}
+	b.WriteString("Q\nEMC\n")
+	return b.String()
+}
+
+// redactPage removes what lies under the regions from page nr, its
+// annotations included, and draws the boxes over them
+func (r *redactor) redactPage(nr int) error {
+	page, _, inh, err := r.ctx.PageDict(nr, false)
+	if err != nil {
+		return err
+	}
+	resources := r.ownResources(inh.Resources)
+	page["Resources"] = resources
+	content, err := r.ctx.PageContent(page)
+	if err != nil {
+		return err
+	}
+	out, _, err := r.content(content, resources, matrix.IdentMatrix, 0)
+	if err != nil {
+		return err
+	}
+	sd, err := r.ctx.NewStreamDictForBuf([]byte("q\n" + string(out) + "\nQ\n" + r.boxes(resources)))
+	if err != nil {
+		return err
+	}
+	if err := sd.Encode(); err != nil {
+		return err
+	}
+	ir, err := r.ctx.IndRefForNewObject(*sd)
+	if err != nil {
+		return err
+	}
+	page.Update("Contents", *ir)
+
+	annots, err := r.ctx.DereferenceArray(page["Annots"])
+	if err != nil || annots == nil {
+		return nil
+	}
+	kept := types.Array{}
+	for _, o := range annots {
+		annot, _ := r.ctx.DereferenceDict(o)
+		if rect, _ := r.ctx.DereferenceArray(annot["Rect"]); annot != nil && len(rect) == 4 {
+			n := make([]float64, 4)
+			for i, o := range rect {
+				n[i], _ = number(r.ctx, o)
+			}
+			if rg := r.hit(*types.NewRectangle(math.Min(n[0], n[2]), math.Min(n[1], n[3]), math.Max(n[0], n[2]), math.Max(n[1], n[3]))); rg != nil {
+				rg.report.Annotations++
+				// form fields keep their values in the field
+				parent, _ := r.ctx.DereferenceDict(annot["Parent"])
+				for _, d := range []types.Dict{annot, parent} {
+					if d != nil {
+						d.Delete("V")
+						d.Delete("AP")
+					}
+				}
+				continue
+			}
+		}
+		kept = append(kept, o)
+	}
+	if len(kept) == 0 {
+		page.Delete("Annots")
+	} else {
+		page.Update("Annots", kept)
+	}
+	return nil
+}
+
+// verifyRedactions reads the PDF b back and checks that no text remains
+// under the regions, by page
+func verifyRedactions(b []byte, regions map[int][]*redactRegion) error {
+	ctx, err := api.ReadContext(bytes.NewReader(b), model.NewDefaultConfiguration())
+	if err != nil {
+		return err
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		return err
+	}
+	pages := []int{}
+	for nr := range regions {
+		pages = append(pages, nr)
+	}
+	sort.Ints(pages)
+	for _, nr := range pages {
+		glyphs, err := pageGlyphs(ctx, nr, redactionTag)
+		if err != nil {
+			return err
+		}
+		for _, g := range glyphs {
+			for _, rg := range regions[nr] {
+				if overlaps(g.box, rg.box) {
+					return &Error{Op: "redact", Kind: ErrNotRedacted,
+						Err: fmt.Errorf("text remains under the region at %s,%s on page %d", formatNumber(rg.report.X), formatNumber(rg.report.Y), nr)}
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// RedactRS redacts rs, writing to w, and reports the regions redacted:
+// those of opts and those found by its terms and patterns. Under each
+// region it removes the text, the vector paths and the inline images,
+// and annotations, blacks out images (or removes those it cannot
+// decode), and does the same within forms; filled rectangles crossing a
+// region are cut back to outside it. It then draws a black box over the
+// region with its label, if any, and reads the PDF back to verify that
+// no text remains under the boxes. Text alternatives of the content
+// removed, and the tagged structure of the PDF, are removed as well.
+// Terms and patterns cannot be found in text whose font has a custom
+// encoding and no ToUnicode map; RedactRS fails with ErrNotRedacted
+// rather than report such a page clean.
+func RedactRS(rs io.ReadSeeker, w io.Writer, opts RedactOptions) (report []RedactedRegion, err error) {
+	const op = "redact"
+	defer recoverCorrupt(op, &err)
+
+	patterns, sources, err := redactPatterns(opts)
+	if err != nil {
+		return nil, optionErr(op, err)
+	}
+	ctx, err := readSplitContext(op, rs)
+	if err != nil {
+		return nil, err
+	}
+
+	report = []RedactedRegion{}
+	boxes := []types.Rectangle{}
+	for _, rd := range opts.Regions {
+		if rd.Page < 1 || rd.Page > ctx.PageCount {
+			return nil, &Error{Op: op, Kind: ErrPageOutOfRange, Err: fmt.Errorf("redaction on page %d of %d", rd.Page, ctx.PageCount)}
+		}
+		if rd.Width <= 0 || rd.Height <= 0 {
+			return nil, optionErr(op, fmt.Errorf("redaction on page %d has no area", rd.Page))
+		}
+		_, _, inh, err := ctx.PageDict(rd.Page, false)
+		if err != nil {
+			return nil, readErr(op, err)
+		}
+		o := pageOrigin(inh)
+		if rd.Label == "" {
+			rd.Label = opts.Label
+		}
+		report = append(report, RedactedRegion{Redaction: rd})
+		boxes = append(boxes, *types.NewRectangle(o.X+rd.X, o.Y+rd.Y, o.X+rd.X+rd.Width, o.Y+rd.Y+rd.Height))
+	}
+	for nr := 1; len(patterns) > 0 && nr <= ctx.PageCount; nr++ {
+		glyphs, err := pageGlyphs(ctx, nr, "")
+		if err != nil {
+			return nil, readErr(op, err)
+		}
+		_, _, inh, err := ctx.PageDict(nr, false)
+		if err != nil {
+			return nil, readErr(op, err)
+		}
+		o := pageOrigin(inh)
+		for _, g := range glyphs {
+			if g.unknown {
+				return nil, &Error{Op: op, Kind: ErrNotRedacted,
+					Err: fmt.Errorf("text on page %d is in a font without a ToUnicode map and cannot be searched; redact it by region", nr)}
+			}
+		}
+		for i, re := range patterns {
+			for _, box := range findText(glyphs, re) {
+				report = append(report, RedactedRegion{
+					Redaction: Redaction{Page: nr, X: box.LL.X - o.X, Y: box.LL.Y - o.Y, Width: box.Width(), Height: box.Height(), Label: opts.Label},
+					Match:     sources[i],
+				})
+				boxes = append(boxes, box)
+			}
+		}
+	}
+
+	regions := map[int][]*redactRegion{}
+	for i := range report {
+		nr := report[i].Page
+		regions[nr] = append(regions[nr], &redactRegion{box: boxes[i], report: &report[i]})
+	}
+	for nr := 1; nr <= ctx.PageCount; nr++ {
+		if len(regions[nr]) == 0 {
+			continue
+		}
+		r := &redactor{ctx: ctx, regions: regions[nr]}
+		if err := r.redactPage(nr); err != nil {
+			return nil, readErr(op, err)
+		}
+	}
+
+	if len(report) > 0 {
+		// the tagged structure of the PDF may repeat its text
+		root, err := ctx.Catalog()
+		if err != nil {
+			return nil, readErr(op, err)
+		}
+		root.Delete("StructTreeRoot")
+		root.Delete("MarkInfo")
+	}
+
+	var b bytes.Buffer
+	if err := api.WriteContext(ctx, &b); err != nil {
+		return nil, readErr(op, err)
+	}
+	if err := verifyRedactions(b.Bytes(), regions); err != nil {
+		return nil, readErr(op, err)
+	}
+	_, err = w.Write(b.Bytes())
+	return report, err
+}
@@ -0,0 +1,347 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/matrix"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// textPDF returns a PDF of two pages, the first with two lines of text in
+// Helvetica 12pt, a filled rectangle and an image
+func textPDF(t *testing.T) []byte {
+	t.Helper()
+	ctx, err := api.ReadContext(bytes.NewReader(testPDF(2)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+	newStream := func(d types.Dict, content string) types.IndirectRef {
+		sd, err := ctx.NewStreamDictForBuf([]byte(content))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range d {
+			sd.Insert(k, v)
+		}
+		if err := sd.Encode(); err != nil {
+			t.Fatal(err)
+		}
+		ir, err := ctx.IndRefForNewObject(*sd)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *ir
+	}
+
+	page, _, _, err := ctx.PageDict(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page["Resources"] = types.Dict{
+		"Font": types.Dict{"F1": types.Dict{
+			"Type": types.Name("Font"), "Subtype": types.Name("Type1"),
+			"BaseFont": types.Name("Helvetica"), "Encoding": types.Name("WinAnsiEncoding"),
+		}},
+		"XObject": types.Dict{"Im1": newStream(types.Dict{
+			"Type": types.Name("XObject"), "Subtype": types.Name("Image"),
+			"Width": types.Integer(2), "Height": types.Integer(2),
+			"ColorSpace": types.Name("DeviceGray"), "BitsPerComponent": types.Integer(8),
+		}, "\xff\xff\xff\xff")},
+	}
+	page["Contents"] = newStream(types.Dict{}, "BT /F1 12 Tf 72 700 Td (Hello Secret World) Tj ET\n"+
+		"BT /F1 12 Tf 72 650 Td [(Top) -250 (secret)] TJ ET\n"+
+		"0 0 1 rg 72 600 100 20 re f\n"+
+		"q 50 0 0 50 300 300 cm /Im1 Do Q\n")
+
+	var b bytes.Buffer
+	if err := api.WriteContext(ctx, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// readTestPDF reads pdf for inspection
+func readTestPDF(t *testing.T, pdf []byte) *model.Context {
+	t.Helper()
+	ctx, err := api.ReadContext(bytes.NewReader(pdf), model.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+	return ctx
+}
+
+// pageText returns the text of page 1 of ctx, but for redaction labels,
+// and its content stream
+func pageText(t *testing.T, ctx *model.Context) (string, string) {
+	t.Helper()
+	glyphs, err := pageGlyphs(ctx, 1, redactionTag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	for i, g := range glyphs {
+		if i > 0 {
+			text.WriteString(glyphBreak(glyphs[i-1], g))
+		}
+		text.WriteString(g.text)
+	}
+	page, _, _, err := ctx.PageDict(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ctx.PageContent(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return text.String(), string(content)
+}
+
+func TestFindText(t *testing.T) {
+	ctx := readTestPDF(t, textPDF(t))
+	glyphs, err := pageGlyphs(ctx, 1, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	boxes := findText(glyphs, regexp.MustCompile(`(?i)secret`))
+	if len(boxes) != 2 {
+		t.Fatalf("findText() = %v, want 2 boxes", boxes)
+	}
+	// "Hello " is 30.672pt and "Secret" 34.68pt wide in Helvetica 12pt
+	if b := boxes[0]; !near(b.LL.X, 102.672) || !near(b.UR.X, 137.352) || b.LL.Y > 700 || b.UR.Y < 708 {
+		t.Errorf("findText() box = %v, want x 102.672-137.352 around y 700", b)
+	}
+	if got := findText(glyphs, regexp.MustCompile(`Top secret`)); len(got) != 1 {
+		t.Errorf("findText() across a TJ adjustment = %v, want 1 box", got)
+	}
+	if got := findText(glyphs, regexp.MustCompile(`World\nTop`)); len(got) != 2 {
+		t.Errorf("findText() across lines = %v, want 2 boxes", got)
+	}
+}
+
+// near reports whether a and b are equal but for rounding
+func near(a, b float64) bool {
+	return a-b < 0.01 && b-a < 0.01
+}
+
+func TestRedactRS(t *testing.T) {
+	pdf := textPDF(t)
+
+	tests := []struct {
+		name    string
+		opts    RedactOptions
+		want    []string // text kept
+		removed []string // text removed
+		report  []RedactedRegion
+	}{
+		{
+			name: "region",
+			opts: RedactOptions{Regions: []Redaction{{Page: 1, X: 103, Y: 695, Width: 33, Height: 14, Label: "PRIV"}}},
+			want: []string{"Hello", "World", "Top secret"}, removed: []string{"Secret"},
+			report: []RedactedRegion{{Redaction: Redaction{Page: 1, X: 103, Y: 695, Width: 33, Height: 14, Label: "PRIV"}, Glyphs: 6}},
+		},
+		{
+			name: "terms",
+			opts: RedactOptions{Terms: []string{"SECRET"}, Label: "REDACTED – PRIVILEGE"},
+			want: []string{"Hello", "World", "Top"}, removed: []string{"Secret", "secret"},
+		},
+		{
+			name: "pattern",
+			opts: RedactOptions{Patterns: []string{`W\w+d`}},
+			want: []string{"Hello Secret", "Top secret"}, removed: []string{"World"},
+		},
+		{
+			name: "rectangle and image",
+			opts: RedactOptions{Regions: []Redaction{{Page: 1, X: 60, Y: 290, Width: 265, Height: 375}}},
+			want: []string{"Hello Secret World"}, removed: []string{"Top", "secret"},
+			report: []RedactedRegion{{Redaction: Redaction{Page: 1, X: 60, Y: 290, Width: 265, Height: 375}, Glyphs: 9, Paths: 1, Images: 1}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			report, err := RedactRS(bytes.NewReader(pdf), &b, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.report != nil && !equalReports(report, tt.report) {
+				t.Errorf("RedactRS() report = %+v, want %+v", report, tt.report)
+			}
+			text, content := pageText(t, readTestPDF(t, b.Bytes()))
+			for _, s := range tt.want {
+				if !strings.Contains(text, s) {
+					t.Errorf("RedactRS() text %q lacks %q", text, s)
+				}
+			}
+			for _, s := range tt.removed {
+				if strings.Contains(text, s) || strings.Contains(content, s) {
+					t.Errorf("RedactRS() left %q in %q", s, content)
+				}
+			}
+			if !strings.Contains(content, "/"+redactionTag+" BMC") {
+				t.Errorf("RedactRS() drew no boxes in %q", content)
+			}
+		})
+	}
+}
+
+// equalReports reports whether the regions and counts of a and b are
+// equal, but for rounding
+func equalReports(a, b []RedactedRegion) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		x, y := a[i], b[i]
+		if x.Page != y.Page || !near(x.X, y.X) || !near(x.Y, y.Y) || !near(x.Width, y.Width) || !near(x.Height, y.Height) ||
+			x.Label != y.Label || x.Match != y.Match ||
+			x.Glyphs != y.Glyphs || x.Paths != y.Paths || x.Images != y.Images || x.Annotations != y.Annotations {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRedactTextAdjustments(t *testing.T) {
+	var b bytes.Buffer
+	if _, err := RedactRS(bytes.NewReader(textPDF(t)), &b, RedactOptions{Terms: []string{"secret"}}); err != nil {
+		t.Fatal(err)
+	}
+	_, content := pageText(t, readTestPDF(t, b.Bytes()))
+	// each run of glyphs removed leaves a single adjustment, the sum of
+	// their widths and any adjustments among them, and no more
+	for _, want := range []string{"[<48656c6c6f20> -2890 <20576f726c64>] TJ", "[<546f70> -2973 ] TJ"} {
+		if !strings.Contains(content, want) {
+			t.Errorf("RedactRS() content lacks %q:\n%s", want, content)
+		}
+	}
+}
+
+func TestRedactContent(t *testing.T) {
+	ctx := readTestPDF(t, textPDF(t))
+	page, _, inh, err := ctx.PageDict(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, err := ctx.PageContent(page)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the left half of the rectangle and the image
+	r := &redactor{ctx: ctx, regions: []*redactRegion{
+		{box: *types.NewRectangle(0, 0, 122, 620), report: &RedactedRegion{}},
+		{box: *types.NewRectangle(0, 0, 325, 350), report: &RedactedRegion{}},
+	}}
+	out, changed, err := r.content(content, inh.Resources, matrix.IdentMatrix, 0)
+	if err != nil || !changed {
+		t.Fatalf("content() = %v, %v", changed, err)
+	}
+	if !strings.Contains(string(out), "122 600 50 20 re f") {
+		t.Errorf("content() did not cut back the rectangle: %q", out)
+	}
+	if !strings.Contains(string(out), "/Redacted1 Do") {
+		t.Fatalf("content() did not black out the image: %q", out)
+	}
+	sd, _, err := ctx.DereferenceStreamDict(resource(ctx, inh.Resources, "XObject", "Redacted1"))
+	if err != nil || sd == nil {
+		t.Fatalf("Redacted1 = %v, %v", sd, err)
+	}
+	if err := sd.Decode(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := sd.Content, []byte{0, 0xff, 0, 0xff}; !bytes.Equal(got, want) {
+		t.Errorf("blacked out image = %x, want %x", got, want)
+	}
+}
+
+func TestRedactErrors(t *testing.T) {
+	pdf := textPDF(t)
+	tests := []struct {
+		name string
+		opts RedactOptions
+		want error
+	}{
+		{"page out of range", RedactOptions{Regions: []Redaction{{Page: 3, Width: 1, Height: 1}}}, ErrPageOutOfRange},
+		{"no area", RedactOptions{Regions: []Redaction{{Page: 1, Width: 0, Height: 1}}}, ErrInvalidOption},
+		{"bad pattern", RedactOptions{Patterns: []string{"("}}, ErrInvalidOption},
+	}
+
+	// text in a font of custom encoding without a ToUnicode map cannot be
+	// searched
+	ctx := readTestPDF(t, pdf)
+	page, _, _, err := ctx.PageDict(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page.DictEntry("Resources").DictEntry("Font").DictEntry("F1")["Encoding"] = types.Dict{
+		"Type": types.Name("Encoding"), "Differences": types.Array{types.Integer(65), types.Name("g1")},
+	}
+	var custom bytes.Buffer
+	if err := api.WriteContext(ctx, &custom); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := RedactRS(bytes.NewReader(custom.Bytes()), &bytes.Buffer{}, RedactOptions{Terms: []string{"secret"}}); !errors.Is(err, ErrNotRedacted) {
+		t.Errorf("RedactRS() of unmapped text error = %v, want %v", err, ErrNotRedacted)
+	}
+	if _, err := RedactRS(bytes.NewReader(custom.Bytes()), &bytes.Buffer{}, RedactOptions{Regions: []Redaction{{Page: 1, X: 103, Y: 695, Width: 33, Height: 14}}}); err != nil {
+		t.Errorf("RedactRS() by region of unmapped text error = %v", err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if _, err := RedactRS(bytes.NewReader(pdf), &b, tt.opts); !errors.Is(err, tt.want) {
+				t.Errorf("RedactRS() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadRedactions(t *testing.T) {
+	want := []Redaction{{Page: 1, X: 72, Y: 700, Width: 100, Height: 12.5, Label: "PRIV"}, {Page: 2, X: 0, Y: 0, Width: 10, Height: 10}}
+	tests := []struct {
+		name, format, in string
+	}{
+		{"json", "json", `[{"page":1,"x":72,"y":700,"width":100,"height":12.5,"label":"PRIV"},{"page":2,"x":0,"y":0,"width":10,"height":10}]`},
+		{"csv", "csv", "Page,X,Y,Width,Height,Label\n1,72,700,100,12.5,PRIV\n2,0,0,10,10,\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ReadRedactions(strings.NewReader(tt.in), tt.format)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !equalReports(regionReports(got), regionReports(want)) {
+				t.Errorf("ReadRedactions() = %+v, want %+v", got, want)
+			}
+		})
+	}
+	for _, bad := range []struct{ format, in string }{
+		{"csv", "page,x,y,width\n1,2,3,4\n"},
+		{"csv", "page,x,y,width,height\n1,2,3,4,high\n"},
+		{"yaml", "- page: 1\n"},
+	} {
+		if _, err := ReadRedactions(strings.NewReader(bad.in), bad.format); err == nil {
+			t.Errorf("ReadRedactions(%q) succeeded", bad.in)
+		}
+	}
+}
+
+// regionReports returns reports of regions, to compare them
+func regionReports(regions []Redaction) []RedactedRegion {
+	reports := []RedactedRegion{}
+	for _, r := range regions {
+		reports = append(reports, RedactedRegion{Redaction: r})
+	}
+	return reports
+}
@@ -0,0 +1,345 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// ScrubFinding is an item of metadata found in a PDF
+type ScrubFinding struct {
+	Kind   string `json:"kind"`   // e.g. "info", "xmp", "javascript" (see scrubContext)
+	Where  string `json:"where"`  // "document", "page 3" or "object 12"
+	Detail string `json:"detail"` // e.g. "Author: J. Smith"
+
+	// benign findings, the producer and dates recorded by pdfcpu each
+	// time it writes a PDF, are not reported by ScrubCheckRS
+	benign bool
+}
+
+func (f ScrubFinding) String() string {
+	if f.Detail == "" {
+		return f.Where + ": " + f.Kind
+	}
+	return f.Where + ": " + f.Kind + ": " + f.Detail
+}
+
+// keptAnnotations are the annotation subtypes left by scrubbing, as part
+// of the content of the pages rather than comments on it
+var keptAnnotations = map[string]bool{"Link": true, "Widget": true}
+
+// maxDetail is the length at which the values of findings are cut
+const maxDetail = 60
+
+// scrubContext finds, and with remove removes, the metadata of ctx:
+//
+//   - info: entries of the document information dictionary
+//   - xmp: XMP metadata packets of the document, pages and resources
+//   - thumbnail: embedded page thumbnails
+//   - private data: data private to the application that wrote the PDF
+//   - javascript: document JavaScript and JavaScript actions
+//   - actions: actions run on opening the document or pages
+//   - attachment: files attached to the document
+//   - annotation: comments and other annotations, but for links and
+//     form fields
+func scrubContext(ctx *model.Context, remove bool) ([]ScrubFinding, error) {
+	findings := []ScrubFinding{}
+	found := func(kind, where, detail string) {
+		if len(detail) > maxDetail {
+			detail = detail[:maxDetail] + "..."
+		}
+		findings = append(findings, ScrubFinding{Kind: kind, Where: where, Detail: detail})
+	}
+
+	if ctx.Info != nil {
+		info, err := ctx.DereferenceDict(*ctx.Info)
+		if err != nil {
+			return nil, err
+		}
+		keys := []string{}
+		for k := range info {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			v, err := ctx.DereferenceText(info[k])
+			if err != nil {
+				v = ""
+			}
+			found("info", "document", k+": "+v)
+			switch {
+			case k == "CreationDate", k == "ModDate":
+				findings[len(findings)-1].benign = true
+			case k == "Producer" && strings.HasPrefix(v, "pdfcpu "):
+				findings[len(findings)-1].benign = true
+			}
+		}
+		if remove {
+			ctx.Info = nil
+		}
+	}
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		return nil, err
+	}
+	if names, err := ctx.DereferenceDict(root["Names"]); err == nil && names != nil {
+		for _, tree := range []struct{ key, kind string }{{"JavaScript", "javascript"}, {"EmbeddedFiles", "attachment"}} {
+			key, kind := tree.key, tree.kind
+			tree, err := ctx.DereferenceDict(names[key])
+			if err != nil || tree == nil {
+				continue
+			}
+			for _, name := range nameTreeKeys(ctx, tree) {
+				found(kind, "document", name)
+			}
+			if remove {
+				// also from the name trees pdfcpu writes back
+				delete(ctx.Names, key)
+				if err := ctx.RemoveNameTree(key); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	if o, ok := root.Find("OpenAction"); ok {
+		if action, err := ctx.DereferenceDict(o); err == nil && action != nil {
+			if s := action.NameEntry("S"); s != nil && *s == "JavaScript" {
+				found("javascript", "document", "run on opening")
+				if remove {
+					root.Delete("OpenAction")
+				}
+			}
+		}
+	}
+	if _, ok := root.Find("Collection"); ok && remove {
+		// a portfolio of the attachments removed above
+		root.Delete("Collection")
+	}
+
+	// the entries found on the catalog and pages, and where they are found
+	entries := []struct{ key, kind string }{
+		{"Metadata", "xmp"},
+		{"PieceInfo", "private data"},
+		{"AA", "actions"},
+		{"Thumb", "thumbnail"},
+	}
+	objects := map[int]string{} // where, by object number
+	dropped := map[int]bool{}   // annotations found above
+	if ctx.Root != nil {
+		objects[ctx.Root.ObjectNumber.Value()] = "document"
+	}
+	for i := 1; i <= ctx.PageCount; i++ {
+		page, ir, _, err := ctx.PageDict(i, false)
+		if err != nil {
+			return nil, err
+		}
+		where := fmt.Sprintf("page %d", i)
+		if ir != nil {
+			objects[ir.ObjectNumber.Value()] = where
+		}
+
+		annots, err := ctx.DereferenceArray(page["Annots"])
+		if err != nil || annots == nil {
+			continue
+		}
+		kept := types.Array{}
+		for _, o := range annots {
+			annot, err := ctx.DereferenceDict(o)
+			if err != nil || annot == nil {
+				continue
+			}
+			subtype := ""
+			if s := annot.NameEntry("Subtype"); s != nil {
+				subtype = *s
+			}
+			if keptAnnotations[subtype] {
+				kept = append(kept, o)
+				continue
+			}
+			if ir, ok := o.(types.IndirectRef); ok {
+				dropped[ir.ObjectNumber.Value()] = true
+			}
+			detail := subtype
+			if contents, err := ctx.DereferenceText(annot["Contents"]); err == nil && contents != "" {
+				detail += ": " + contents
+			}
+			if subtype == "FileAttachment" {
+				found("attachment", where, detail)
+			} else {
+				found("annotation", where, detail)
+			}
+		}
+		if remove && len(kept) < len(annots) {
+			if len(kept) == 0 {
+				page.Delete("Annots")
+			} else {
+				page.Update("Annots", kept)
+			}
+		}
+	}
+
+	// the entries of the catalog, pages and other objects, such as images
+	// with XMP metadata and links running JavaScript
+	nrs := []int{}
+	for nr := range ctx.Table {
+		nrs = append(nrs, nr)
+	}
+	sort.Ints(nrs)
+	for _, nr := range nrs {
+		entry := ctx.Table[nr]
+		if entry == nil || entry.Free || dropped[nr] {
+			continue
+		}
+		var d types.Dict
+		switch o := entry.Object.(type) {
+		case types.Dict:
+			d = o
+		case types.StreamDict:
+			d = o.Dict
+		default:
+			continue
+		}
+		where, ok := objects[nr]
+		if !ok {
+			where = fmt.Sprintf("object %d", nr)
+		}
+		for _, e := range entries {
+			if _, ok := d.Find(e.key); ok {
+				found(e.kind, where, "")
+				if remove {
+					d.Delete(e.key)
+				}
+			}
+		}
+		if o, ok := d.Find("A"); ok {
+			if action, err := ctx.DereferenceDict(o); err == nil && action != nil {
+				if s := action.NameEntry("S"); s != nil && *s == "JavaScript" {
+					found("javascript", where, "run by a link")
+					if remove {
+						d.Delete("A")
+					}
+				}
+			}
+		}
+	}
+	return findings, nil
+}
+
+// nameTreeKeys returns the names of the name tree rooted at d
+func nameTreeKeys(ctx *model.Context, d types.Dict) []string {
+	keys := []string{}
+	if names, err := ctx.DereferenceArray(d["Names"]); err == nil {
+		for i := 0; i < len(names); i += 2 {
+			if k, err := ctx.DereferenceText(names[i]); err == nil {
+				keys = append(keys, k)
+			}
+		}
+	}
+	if kids, err := ctx.DereferenceArray(d["Kids"]); err == nil {
+		for _, kid := range kids {
+			if kd, err := ctx.DereferenceDict(kid); err == nil && kd != nil {
+				keys = append(keys, nameTreeKeys(ctx, kd)...)
+			}
+		}
+	}
+	return keys
+}
+
+// readScrubContext reads rs for scrubbing
+func readScrubContext(op string, rs io.ReadSeeker) (*model.Context, error) {
+	if _, err := pageCount(op, rs); err != nil {
+		return nil, err
+	}
+	ctx, err := api.ReadContext(rs, model.NewDefaultConfiguration())
+	if err != nil {
+		return nil, readErr(op, err)
+	}
+	if err := api.ValidateContext(ctx); err != nil {
+		return nil, readErr(op, err)
+	}
+	if err := api.OptimizeContext(ctx); err != nil {
+		return nil, readErr(op, err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, readErr(op, err)
+	}
+	return ctx, nil
+}
+
+// ScrubRS removes the metadata of rs (see ScrubCheckRS), writes to w and
+// returns what was removed. pdfcpu records itself as the producer of the
+// PDF written, and the time of writing as its creation date.
+func ScrubRS(rs io.ReadSeeker, w io.Writer) (findings []ScrubFinding, err error) {
+	const op = "scrub"
+	defer recoverCorrupt(op, &err)
+
+	ctx, err := readScrubContext(op, rs)
+	if err != nil {
+		return nil, err
+	}
+	if findings, err = scrubContext(ctx, true); err != nil {
+		return nil, readErr(op, err)
+	}
+	if err := api.WriteContext(ctx, w); err != nil {
+		return nil, readErr(op, err)
+	}
+	return findings, nil
+}
+
+// ScrubCheckRS returns the metadata of rs that ScrubRS would remove:
+// document information such as the author, XMP metadata, thumbnails,
+// application data, JavaScript, attached files and annotations other
+// than links and form fields. The producer and dates recorded by
+// pdfcpu are not reported.
+func ScrubCheckRS(rs io.ReadSeeker) (findings []ScrubFinding, err error) {
+	const op = "scrub check"
+	defer recoverCorrupt(op, &err)
+
+	ctx, err := readScrubContext(op, rs)
+	if err != nil {
+		return nil, err
+	}
+	all, err := scrubContext(ctx, false)
+	if err != nil {
+		return nil, readErr(op, err)
+	}
+	findings = []ScrubFinding{}
+	for _, f := range all {
+		if !f.benign {
+			findings = append(findings, f)
+		}
+	}
+	return findings, nil
+}
+
+// watermarkRS adds the watermarks m, by page, to rs and writes to w, in
+// the same write scrubbing rs if scrub is set
+func watermarkRS(op string, rs io.ReadSeeker, w io.Writer, m map[int][]*model.Watermark, scrub bool) error {
+	if !scrub {
+		if err := api.AddWatermarksSliceMap(rs, w, m, nil); err != nil {
+			return readErr(op, err)
+		}
+		return nil
+	}
+	ctx, err := readScrubContext(op, rs)
+	if err != nil {
+		return err
+	}
+	if _, err := scrubContext(ctx, true); err != nil {
+		return readErr(op, err)
+	}
+	if err := pdfcpu.AddWatermarksSliceMap(ctx, m); err != nil {
+		return readErr(op, err)
+	}
+	if err := api.WriteContext(ctx, w); err != nil {
+		return readErr(op, err)
+	}
+	return nil
+}
@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
+)
+
+// metadataPDF returns a PDF of two pages with document information, an
+// XMP packet, document JavaScript, a comment and a link
+func metadataPDF(t *testing.T) []byte {
+	t.Helper()
+	ctx, err := api.ReadContext(bytes.NewReader(testPDF(2)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+	newObject := func(o types.Object) types.IndirectRef {
+		ir, err := ctx.IndRefForNewObject(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return *ir
+	}
+
+	info := newObject(types.Dict{
+		"Author":  types.StringLiteral("J. Smith"),
+		"Creator": types.StringLiteral("Word"),
+		"Matter":  types.StringLiteral("Smith v. Jones"),
+	})
+	ctx.Info = &info
+
+	root, err := ctx.Catalog()
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmp, err := ctx.NewStreamDictForBuf([]byte(`<x:xmpmeta xmlns:x="adobe:ns:meta/"></x:xmpmeta>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmp.InsertName("Type", "Metadata")
+	xmp.InsertName("Subtype", "XML")
+	if err := xmp.Encode(); err != nil {
+		t.Fatal(err)
+	}
+	root["Metadata"] = newObject(*xmp)
+	js := newObject(types.Dict{"S": types.Name("JavaScript"), "JS": types.StringLiteral("app.alert(1)")})
+	root["Names"] = types.Dict{"JavaScript": types.Dict{"Names": types.Array{types.StringLiteral("init"), js}}}
+
+	page, _, _, err := ctx.PageDict(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	page["Annots"] = types.Array{
+		newObject(types.Dict{
+			"Type": types.Name("Annot"), "Subtype": types.Name("Text"),
+			"Rect": types.Array{types.Integer(0), types.Integer(0), types.Integer(10), types.Integer(10)}, "Contents": types.StringLiteral("check this"),
+		}),
+		newObject(types.Dict{
+			"Type": types.Name("Annot"), "Subtype": types.Name("Link"),
+			"Rect": types.Array{types.Integer(0), types.Integer(20), types.Integer(10), types.Integer(30)},
+			"A":    types.Dict{"S": types.Name("URI"), "URI": types.StringLiteral("https://example.com")},
+		}),
+	}
+
+	var b bytes.Buffer
+	if err := api.WriteContext(ctx, &b); err != nil {
+		t.Fatal(err)
+	}
+	return b.Bytes()
+}
+
+// findingKinds returns "where: kind" of findings
+func findingKinds(findings []ScrubFinding) []string {
+	s := []string{}
+	for _, f := range findings {
+		s = append(s, f.Where+": "+f.Kind)
+	}
+	return s
+}
+
+// annotationTypes returns the subtypes of the annotations of page 1 of pdf
+func annotationTypes(t *testing.T, pdf []byte) []string {
+	t.Helper()
+	ctx, err := api.ReadContext(bytes.NewReader(pdf), model.NewDefaultConfiguration())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		t.Fatal(err)
+	}
+	page, _, _, err := ctx.PageDict(1, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	annots, _ := ctx.DereferenceArray(page["Annots"])
+	types := []string{}
+	for _, o := range annots {
+		d, err := ctx.DereferenceDict(o)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types = append(types, *d.NameEntry("Subtype"))
+	}
+	return types
+}
+
+func TestScrubRS(t *testing.T) {
+	pdf := metadataPDF(t)
+
+	found, err := ScrubCheckRS(bytes.NewReader(pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"document: info", "document: info", "document: info",
+		"document: javascript", "page 1: annotation", "document: xmp",
+	}
+	if got := findingKinds(found); !reflect.DeepEqual(got, want) {
+		t.Errorf("ScrubCheckRS() = %v, want %v", got, want)
+	}
+	if found[0].Detail != "Author: J. Smith" || found[4].Detail != "Text: check this" {
+		t.Errorf("ScrubCheckRS() details = %q, %q", found[0].Detail, found[4].Detail)
+	}
+
+	var out bytes.Buffer
+	removed, err := ScrubRS(bytes.NewReader(pdf), &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(removed) < len(found) {
+		t.Errorf("ScrubRS() removed %v, want at least %v", findingKinds(removed), want)
+	}
+	if left, err := ScrubCheckRS(bytes.NewReader(out.Bytes())); err != nil || len(left) > 0 {
+		t.Errorf("ScrubCheckRS() after ScrubRS = %v, %v, want none", left, err)
+	}
+	if got := annotationTypes(t, out.Bytes()); !reflect.DeepEqual(got, []string{"Link"}) {
+		t.Errorf("annotations after ScrubRS = %v, want [Link]", got)
+	}
+}
+
+func TestScrubStamp(t *testing.T) {
+	stamps := map[string]func(rs *bytes.Reader, w *bytes.Buffer) error{
+		"bates": func(rs *bytes.Reader, w *bytes.Buffer) error {
+			return ScrubBatesEndorseRS(rs, w, GenerateFmtString("ABC", "-", 4), 1, "", DefaultBatesStyle())
+		},
+		"text": func(rs *bytes.Reader, w *bytes.Buffer) error {
+			opts := DefaultWatermarkOptions("DRAFT")
+			opts.Scrub = true
+			return TextStampRS(rs, w, opts)
+		},
+	}
+	for name, stamp := range stamps {
+		t.Run(name, func(t *testing.T) {
+			var out bytes.Buffer
+			if err := stamp(bytes.NewReader(metadataPDF(t)), &out); err != nil {
+				t.Fatal(err)
+			}
+			if left, err := ScrubCheckRS(bytes.NewReader(out.Bytes())); err != nil || len(left) > 0 {
+				t.Errorf("ScrubCheckRS() after stamping = %v, %v, want none", left, err)
+			}
+			if n, err := PageCount(bytes.NewReader(out.Bytes())); err != nil || n != 2 {
+				t.Errorf("PageCount() = %d, %v, want 2", n, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package utils
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// slipSheetTexts are the texts of the slip sheets given by name
+var slipSheetTexts = map[string]string{
+	"withheld": "Document Withheld – Privileged",
+	"native":   "Produced in Native Format",
+}
+
+// SlipSheetText returns the text of the slip sheet s: "withheld" and
+// "native" stand for the usual texts, and anything else is the text
+// itself
+func SlipSheetText(s string) string {
+	if text, ok := slipSheetTexts[strings.ToLower(strings.TrimSpace(s))]; ok {
+		return text
+	}
+	return s
+}
+
+// slip sheet layout, in points, on a Letter page
+const (
+	slipWidth       = 612
+	slipHeight      = 792
+	slipMargin      = 72
+	slipFontSize    = 24 // shrunk to fit long texts
+	slipMinFontSize = 8
+	slipDetailSize  = 11 // of the details below the text
+)
+
+// SlipSheet writes to w a one-page PDF to stand in for a document
+// withheld or produced natively, to be Bates stamped with the number of
+// the document. It bears the text of the slip sheet s (see SlipSheetText)
+// in large type at its center, with a line for each line of the text.
+func SlipSheet(w io.Writer, s string) error {
+	return slipSheet("slipsheet", w, SlipSheetText(s), nil)
+}
+
+// nativeFormats are the extensions of the formats produced natively
+var nativeFormats = map[string]bool{
+	// spreadsheets and databases
+	".xls": true, ".xlsx": true, ".xlsm": true, ".xlsb": true, ".ods": true, ".csv": true, ".mdb": true, ".accdb": true,
+	// presentations and drawings
+	".ppt": true, ".pptx": true, ".pps": true, ".ppsx": true, ".odp": true, ".vsd": true, ".vsdx": true, ".dwg": true,
+	// word processing and text
+	".doc": true, ".docx": true, ".odt": true, ".rtf": true, ".wpd": true, ".txt": true,
+	// email
+	".msg": true, ".eml": true,
+	// audio and video
+	".mp3": true, ".wav": true, ".m4a": true, ".aac": true, ".wma": true, ".flac": true, ".ogg": true,
+	".mp4": true, ".m4v": true, ".mov": true, ".avi": true, ".wmv": true, ".mkv": true, ".mpg": true, ".mpeg": true,
+}
+
+// IsNative reports whether the file named name is, by its extension, of
+// a format produced natively: a spreadsheet, presentation, document,
+// email, audio or video file
+func IsNative(name string) bool {
+	return nativeFormats[strings.ToLower(filepath.Ext(name))]
+}
+
+// NativePlaceholder writes to w a slip sheet (see SlipSheet) to stand in
+// for a file produced natively, bearing "Produced in Native Format" and,
+// below it, the original filename and MD5 hash of the file
+func NativePlaceholder(w io.Writer, fileName string, hash string) error {
+	return slipSheet("placeholder", w, slipSheetTexts["native"], []string{
+		"Original filename: " + fileName,
+		"MD5 hash: " + hash,
+	})
+}
+
+// slipSheet writes to w a one-page PDF bearing text in large type, and
+// details below it in smaller type, at its center
+func slipSheet(op string, w io.Writer, text string, details []string) (err error) {
+	defer recoverCorrupt(op, &err)
+
+	if strings.TrimSpace(text) == "" {
+		return optionErr(op, fmt.Errorf("slip sheet has no text"))
+	}
+	width := float64(slipWidth - 2*slipMargin)
+	detailLines := [][]byte{}
+	for _, d := range details {
+		detailLines = append(detailLines, wrapText(d, "Helvetica", slipDetailSize, width)...)
+	}
+	detailHeight := 0.0
+	if len(detailLines) > 0 {
+		detailHeight = slipDetailSize + float64(len(detailLines))*1.4*slipDetailSize
+	}
+	size := float64(slipFontSize)
+	lines := wrapText(text, "Helvetica-Bold", size, width)
+	for size > slipMinFontSize && float64(len(lines))*1.4*size+detailHeight > slipHeight-2*slipMargin {
+		size -= 2
+		lines = wrapText(text, "Helvetica-Bold", size, width)
+	}
+
+	// lines are drawn centered from the top of their block down, the
+	// details after a blank line
+	var b strings.Builder
+	draw := func(font string, fontName string, size float64, lines [][]byte, top float64) float64 {
+		for _, line := range lines {
+			x := (slipWidth - coreTextWidth(line, fontName)*size) / 2
+			fmt.Fprintf(&b, "BT %s %s Tf %s %s Td <%x> Tj ET\n", font, formatNumber(size), formatNumber(x), formatNumber(top-size), line)
+			top -= 1.4 * size
+		}
+		return top
+	}
+	top := (slipHeight + float64(len(lines))*1.4*size + detailHeight) / 2
+	top = draw("/F2", "Helvetica-Bold", size, lines, top)
+	draw("/F1", "Helvetica", slipDetailSize, detailLines, top-slipDetailSize)
+	return writeContentPDF(w, slipWidth, slipHeight, [][]byte{[]byte(b.String())})
+}
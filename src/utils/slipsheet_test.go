@@ -0,0 +1,78 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSlipSheet(t *testing.T) {
+	tests := []struct {
+		name  string
+		s     string
+		want  string
+		lines int
+	}{
+		{"withheld", "withheld", "Document Withheld – Privileged", 1},
+		{"native", "Native", "Produced in Native Format", 1},
+		{"text", "Withheld – Privileged\nSee privilege log entry 12", "Withheld – Privileged\nSee privilege log entry 12", 2},
+		{"long text", strings.Repeat("Withheld ", 300), "", 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := SlipSheet(&b, tt.s); err != nil {
+				t.Fatal(err)
+			}
+			ctx := readTestPDF(t, b.Bytes())
+			if ctx.PageCount != 1 {
+				t.Fatalf("page count = %d, want 1", ctx.PageCount)
+			}
+			glyphs, err := pageGlyphs(ctx, 1, "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			text, _ := pageText(t, ctx)
+			if tt.want != "" && text != tt.want {
+				t.Errorf("slip sheet text = %q, want %q", text, tt.want)
+			}
+			if n := strings.Count(text, "\n") + 1; tt.lines > 0 && n != tt.lines {
+				t.Errorf("slip sheet lines = %d, want %d", n, tt.lines)
+			}
+			for _, g := range glyphs {
+				if g.box.LL.X < slipMargin || g.box.UR.X > slipWidth-slipMargin || g.box.LL.Y < slipMargin || g.box.UR.Y > slipHeight-slipMargin {
+					t.Fatalf("%q at %v is outside the margins", g.text, g.box)
+				}
+			}
+			// centered on the page
+			if tt.lines > 0 {
+				mid := (glyphs[0].box.UR.Y + glyphs[len(glyphs)-1].box.LL.Y) / 2
+				if mid < slipHeight/2-20 || mid > slipHeight/2+20 {
+					t.Errorf("text centered at %g, want about %d", mid, slipHeight/2)
+				}
+			}
+		})
+	}
+
+	var b bytes.Buffer
+	if err := NativePlaceholder(&b, "budget.xlsx", "0cc175b9c0f1b6a831c399e269772661"); err != nil {
+		t.Fatal(err)
+	}
+	text, _ := pageText(t, readTestPDF(t, b.Bytes()))
+	if want := "Produced in Native Format\nOriginal filename: budget.xlsx\nMD5 hash: 0cc175b9c0f1b6a831c399e269772661"; text != want {
+		t.Errorf("placeholder text = %q, want %q", text, want)
+	}
+
+	if err := SlipSheet(&bytes.Buffer{}, " "); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("SlipSheet() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestIsNative(t *testing.T) {
+	for name, want := range map[string]bool{"budget.XLSX": true, "call.mp3": true, "email.msg": true, "a.pdf": false, "scan.tif": false, "archive.zip": false, "noext": false} {
+		if got := IsNative(name); got != want {
+			t.Errorf("IsNative(%q) = %v, want %v", name, got, want)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package utils
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/pdfcpu/pdfcpu/pkg/api"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
+)
+
+// PageRange is a range of pages of a PDF, numbered from 1
+type PageRange struct {
+	From  int
+	Thru  int
+	Title string // of the bookmark starting the range, if split by bookmarks
+}
+
+// ParsePageRanges parses s, a comma-separated list of pages and page
+// ranges of a PDF of count pages, e.g. "1-3,4,10-". A range without a
+// start begins at the first page, and one without an end runs to the
+// last page.
+func ParsePageRanges(s string, count int) ([]PageRange, error) {
+	ranges := []PageRange{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		from, thru, isRange := strings.Cut(part, "-")
+		if !isRange {
+			thru = from
+		}
+		r := PageRange{From: 1, Thru: count}
+		var err error
+		if from != "" {
+			if r.From, err = strconv.Atoi(strings.TrimSpace(from)); err != nil {
+				return nil, fmt.Errorf("%w: page range `%s`", ErrInvalidOption, part)
+			}
+		}
+		if thru != "" {
+			if r.Thru, err = strconv.Atoi(strings.TrimSpace(thru)); err != nil {
+				return nil, fmt.Errorf("%w: page range `%s`", ErrInvalidOption, part)
+			}
+		}
+		if r.From < 1 || r.Thru > count || r.From > r.Thru {
+			return nil, fmt.Errorf("%w: page range `%s` of %d pages", ErrPageOutOfRange, part, count)
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: no page ranges given", ErrInvalidOption)
+	}
+	return ranges, nil
+}
+
+// readSplitContext reads rs for splitting or redacting
+func readSplitContext(op string, rs io.ReadSeeker) (*model.Context, error) {
+	if _, err := pageCount(op, rs); err != nil {
+		return nil, err
+	}
+	ctx, err := api.ReadContext(rs, model.NewDefaultConfiguration())
+	if err != nil {
+		return nil, readErr(op, err)
+	}
+	if err := api.ValidateContext(ctx); err != nil {
+		return nil, readErr(op, err)
+	}
+	if err := ctx.EnsurePageCount(); err != nil {
+		return nil, readErr(op, err)
+	}
+	return ctx, nil
+}
+
+// extractRange returns the pages of r as a PDF of their own
+func extractRange(ctx *model.Context, r PageRange) ([]byte, error) {
+	pages := []int{}
+	for i := r.From; i <= r.Thru; i++ {
+		pages = append(pages, i)
+	}
+	extracted, err := pdfcpu.ExtractPages(ctx, pages, false)
+	if err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	if err := api.WriteContext(extracted, &b); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// SplitRS returns each of ranges of rs as a PDF of its own
+func SplitRS(rs io.ReadSeeker, ranges []PageRange) (pdfs [][]byte, err error) {
+	const op = "split"
+	defer recoverCorrupt(op, &err)
+
+	ctx, err := readSplitContext(op, rs)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range ranges {
+		if r.From < 1 || r.Thru > ctx.PageCount || r.From > r.Thru {
+			return nil, &Error{Op: op, Kind: ErrPageOutOfRange, Err: fmt.Errorf("pages %d-%d of %d", r.From, r.Thru, ctx.PageCount)}
+		}
+		b, err := extractRange(ctx, r)
+		if err != nil {
+			return nil, readErr(op, err)
+		}
+		pdfs = append(pdfs, b)
+	}
+	return pdfs, nil
+}
+
+// BookmarkRanges returns the ranges of rs starting at each of its top
+// level bookmarks and running to the next. Pages before the first
+// bookmark make a range without a title. Of bookmarks on the same page,
+// only the first starts a range.
+func BookmarkRanges(rs io.ReadSeeker) (ranges []PageRange, err error) {
+	const op = "split"
+	defer recoverCorrupt(op, &err)
+
+	ctx, err := readSplitContext(op, rs)
+	if err != nil {
+		return nil, err
+	}
+	bookmarks := documentBookmarks(ctx)
+	if len(bookmarks) == 0 {
+		return nil, optionErr(op, fmt.Errorf("PDF has no bookmarks"))
+	}
+	if bookmarks[0].PageFrom > 1 {
+		ranges = append(ranges, PageRange{From: 1})
+	}
+	for _, bm := range bookmarks {
+		if len(ranges) > 0 && ranges[len(ranges)-1].From == bm.PageFrom {
+			continue
+		}
+		ranges = append(ranges, PageRange{From: bm.PageFrom, Title: bm.Title})
+	}
+	for i := range ranges {
+		ranges[i].Thru = ctx.PageCount
+		if i+1 < len(ranges) {
+			ranges[i].Thru = ranges[i+1].From - 1
+		}
+	}
+	return ranges, nil
+}
+
+// SplitSizeRS splits rs into as few consecutive ranges as possible each
+// making a PDF of at most maxSize bytes, and returns the ranges with
+// their PDFs. It fails if a single page exceeds maxSize.
+func SplitSizeRS(rs io.ReadSeeker, maxSize int64) (ranges []PageRange, pdfs [][]byte, err error) {
+	const op = "split"
+	defer recoverCorrupt(op, &err)
+
+	ctx, err := readSplitContext(op, rs)
+	if err != nil {
+		return nil, nil, err
+	}
+	// fits returns the range from..thru as a PDF, or nil if too large
+	fits := func(from, thru int) ([]byte, error) {
+		b, err := extractRange(ctx, PageRange{From: from, Thru: thru})
+		if err != nil || int64(len(b)) > maxSize {
+			return nil, err
+		}
+		return b, nil
+	}
+
+	for from := 1; from <= ctx.PageCount; {
+		best, err := fits(from, from)
+		if err != nil {
+			return nil, nil, readErr(op, err)
+		}
+		if best == nil {
+			return nil, nil, optionErr(op, fmt.Errorf("page %d alone is over %d bytes", from, maxSize))
+		}
+		// grow the range by doubling, then narrow down on the last
+		// page that fits
+		good, bad := from, ctx.PageCount+1
+		for step := 1; good+step < bad; step *= 2 {
+			b, err := fits(from, good+step)
+			if err != nil {
+				return nil, nil, readErr(op, err)
+			}
+			if b == nil {
+				bad = good + step
+				break
+			}
+			good, best = good+step, b
+		}
+		for good+1 < bad {
+			mid := (good + bad) / 2
+			b, err := fits(from, mid)
+			if err != nil {
+				return nil, nil, readErr(op, err)
+			}
+			if b == nil {
+				bad = mid
+			} else {
+				good, best = mid, b
+			}
+		}
+		ranges = append(ranges, PageRange{From: from, Thru: good})
+		pdfs = append(pdfs, best)
+		from = good + 1
+	}
+	return ranges, pdfs, nil
+}
+
+// batesRegexp returns a regular expression matching the Bates numbers of
+// fmtString (see GenerateFmtString), with the number as its subexpression
+func batesRegexp(fmtString string) (*regexp.Regexp, error) {
+	verb := regexp.MustCompile(`%0?(\d*)d`)
+	loc := verb.FindStringSubmatchIndex(fmtString)
+	if loc == nil {
+		return nil, fmt.Errorf("Bates format `%s` has no number", fmtString)
+	}
+	digits := `\d+`
+	if width := fmtString[loc[2]:loc[3]]; width != "" {
+		digits = `\d{` + width + `,}`
+	}
+	return regexp.Compile(regexp.QuoteMeta(fmtString[:loc[0]]) + `(` + digits + `)` + regexp.QuoteMeta(fmtString[loc[1]:]))
+}
+
+// FindBates returns the numbers of the Bates numbers of fmtString found
+// in s, in order
+func FindBates(fmtString string, s string) ([]int64, error) {
+	re, err := batesRegexp(fmtString)
+	if err != nil {
+		return nil, err
+	}
+	numbers := []int64{}
+	for _, m := range re.FindAllStringSubmatch(s, -1) {
+		n, err := strconv.ParseInt(m[1], 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		numbers = append(numbers, n)
+	}
+	return numbers, nil
+}
+
+// BatesRanges parses s, a comma-separated list of Bates numbers and
+// ranges of them (e.g. "ABC-00000010-ABC-00000020,ABC-00000031"), into
+// the page ranges of a PDF of count pages stamped from startNo with
+// fmtString
+func BatesRanges(s string, fmtString string, startNo int64, count int) ([]PageRange, error) {
+	ranges := []PageRange{}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		numbers, err := FindBates(fmtString, part)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidOption, err)
+		}
+		if len(numbers) == 1 {
+			numbers = append(numbers, numbers[0])
+		}
+		if len(numbers) != 2 {
+			return nil, fmt.Errorf("%w: Bates range `%s` (expected e.g. %s-%s)", ErrInvalidOption, part,
+				fmt.Sprintf(fmtString, startNo), fmt.Sprintf(fmtString, startNo+int64(count)-1))
+		}
+		r := PageRange{From: int(numbers[0]-startNo) + 1, Thru: int(numbers[1]-startNo) + 1}
+		if r.From < 1 || r.Thru > count || r.From > r.Thru {
+			return nil, fmt.Errorf("%w: Bates range `%s` is not within %s-%s", ErrPageOutOfRange, part,
+				fmt.Sprintf(fmtString, startNo), fmt.Sprintf(fmtString, startNo+int64(count)-1))
+		}
+		ranges = append(ranges, r)
+	}
+	if len(ranges) == 0 {
+		return nil, fmt.Errorf("%w: no Bates ranges given", ErrInvalidOption)
+	}
+	return ranges, nil
+}
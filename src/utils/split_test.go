@@ -0,0 +1,138 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
+)
+
+func TestParsePageRanges(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    []PageRange
+		wantErr error
+	}{
+		{"1-3,4,6-", []PageRange{{From: 1, Thru: 3}, {From: 4, Thru: 4}, {From: 6, Thru: 10}}, nil},
+		{" -2 , 9 ", []PageRange{{From: 1, Thru: 2}, {From: 9, Thru: 9}}, nil},
+		{"0-2", nil, ErrPageOutOfRange},
+		{"5-11", nil, ErrPageOutOfRange},
+		{"4-3", nil, ErrPageOutOfRange},
+		{"a-3", nil, ErrInvalidOption},
+		{",", nil, ErrInvalidOption},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParsePageRanges(tt.in, 10)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("ParsePageRanges() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParsePageRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSplitRS(t *testing.T) {
+	pdfs, err := SplitRS(bytes.NewReader(testPDF(5)), []PageRange{{From: 1, Thru: 2}, {From: 3, Thru: 5}, {From: 4, Thru: 4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := []int{}
+	for _, b := range pdfs {
+		n, err := PageCount(bytes.NewReader(b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, n)
+	}
+	if want := []int{2, 3, 1}; !reflect.DeepEqual(got, want) {
+		t.Errorf("SplitRS() page counts = %v, want %v", got, want)
+	}
+
+	if _, err := SplitRS(bytes.NewReader(testPDF(2)), []PageRange{{From: 2, Thru: 3}}); !errors.Is(err, ErrPageOutOfRange) {
+		t.Errorf("SplitRS() error = %v, want %v", err, ErrPageOutOfRange)
+	}
+}
+
+func TestBookmarkRanges(t *testing.T) {
+	pdf := bookmarkedPDF(t, 6, []pdfcpu.Bookmark{
+		{Title: "Motion", PageFrom: 2, Children: []pdfcpu.Bookmark{{Title: "Argument", PageFrom: 3}}},
+		{Title: "Exhibit", PageFrom: 5},
+	})
+	got, err := BookmarkRanges(bytes.NewReader(pdf))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PageRange{{From: 1, Thru: 1}, {From: 2, Thru: 4, Title: "Motion"}, {From: 5, Thru: 6, Title: "Exhibit"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("BookmarkRanges() = %v, want %v", got, want)
+	}
+
+	if _, err := BookmarkRanges(bytes.NewReader(testPDF(2))); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("BookmarkRanges() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestSplitSizeRS(t *testing.T) {
+	twoPages, err := SplitRS(bytes.NewReader(testPDF(7)), []PageRange{{From: 1, Thru: 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ranges, pdfs, err := SplitSizeRS(bytes.NewReader(testPDF(7)), int64(len(twoPages[0])))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PageRange{{From: 1, Thru: 2}, {From: 3, Thru: 4}, {From: 5, Thru: 6}, {From: 7, Thru: 7}}
+	if !reflect.DeepEqual(ranges, want) {
+		t.Errorf("SplitSizeRS() = %v, want %v", ranges, want)
+	}
+	for i, b := range pdfs {
+		if len(b) > len(twoPages[0]) {
+			t.Errorf("part %d is %d bytes, over %d", i+1, len(b), len(twoPages[0]))
+		}
+	}
+
+	if _, _, err := SplitSizeRS(bytes.NewReader(testPDF(2)), 10); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("SplitSizeRS() error = %v, want %v", err, ErrInvalidOption)
+	}
+}
+
+func TestBatesRanges(t *testing.T) {
+	fmtString := GenerateFmtString("ABC", "-", 4)
+	tests := []struct {
+		in      string
+		want    []PageRange
+		wantErr error
+	}{
+		{"ABC-0011-ABC-0013,ABC-0019", []PageRange{{From: 2, Thru: 4}, {From: 10, Thru: 10}}, nil},
+		{"ABC-0010 to ABC-0019", []PageRange{{From: 1, Thru: 10}}, nil},
+		{"ABC-0009", nil, ErrPageOutOfRange},
+		{"ABC-0015-ABC-0020", nil, ErrPageOutOfRange},
+		{"XYZ-0011", nil, ErrInvalidOption},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := BatesRanges(tt.in, fmtString, 10, 10)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("BatesRanges() error = %v, want %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("BatesRanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindBates(t *testing.T) {
+	got, err := FindBates("ABC_%06d", "report-ABC_000012-ABC_000020.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int64{12, 20}; !reflect.DeepEqual(got, want) {
+		t.Errorf("FindBates() = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,40 @@
+package utils
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"testing"
+	"time"
+)
+
+func TestSelfSignedCert(t *testing.T) {
+	certPEM, keyPEM, err := SelfSignedCert([]string{"pdftool.lan", "192.168.1.10"}, 24*time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pair, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(pair.Certificate[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		host string
+		ok   bool
+	}{
+		{"pdftool.lan", true},
+		{"192.168.1.10", true},
+		{"example.com", false},
+	}
+	for _, tt := range tests {
+		if err := cert.VerifyHostname(tt.host); (err == nil) != tt.ok {
+			t.Errorf("VerifyHostname(%q) = %v, want ok %v", tt.host, err, tt.ok)
+		}
+	}
+	if cert.NotAfter.Before(time.Now().Add(23 * time.Hour)) {
+		t.Errorf("certificate expires %s, want in 24h", cert.NotAfter)
+	}
+}
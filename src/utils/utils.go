@@ -20,178 +20,350 @@ package utils
 import (
 	"fmt"
 	"io"
-	"log"
+	"os"
+	"strings"
 
 	"github.com/pdfcpu/pdfcpu/pkg/api"
-	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/types"
 	"github.com/pdfcpu/pdfcpu/pkg/pdfcpu/model"
 )
 
-// ConfidentialStampRS adds a CONFIDENTIAL watermark to each page of rs and writes to w
-func ConfidentialStampRS(rs io.ReadSeeker, w io.Writer) error {
-	pages, err := api.ParsePageSelection("") // select all pages
-	if err != nil {
-		log.Fatalf("error: %s", err)
+// WatermarkOptions describes a text watermark or stamp
+type WatermarkOptions struct {
+	Text     string  `json:"text"`     // text of the watermark
+	FontName string  `json:"font"`     // font used for the text (see `pdfcpu fonts list`)
+	FontSize int     `json:"fontsize"` // font size in points
+	Scale    float64 `json:"scale"`    // size relative to the page width; 0 to use FontSize as is
+	Opacity  float64 `json:"opacity"`  // 0.0 (invisible) to 1.0 (opaque)
+	Rotation float64 `json:"rotation"` // rotation in degrees, counterclockwise
+	Diagonal bool    `json:"diagonal"` // run from the lower left to the upper right corner, ignoring Rotation
+	Color    string  `json:"color"`    // text color, e.g. #808080 or gray
+	Pages    string  `json:"pages"`    // page selection, e.g. "1-3,5"; empty for all pages
+	OnTop    bool    `json:"ontop"`    // stamp over the page content rather than behind it
+	Scrub    bool    `json:"scrub"`    // also remove metadata, in the same write (see ScrubRS)
+}
+
+// escapePercent escapes the percent signs of s from pdfcpu, which reads
+// %p, %P, %t and %v as placeholders and drops any other percent sign not
+// doubled. A doubled percent sign still makes the character after it a
+// placeholder, so one before p, P, t or v is set apart from it by the
+// control character 0x01, which the core fonts do not show.
+func escapePercent(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			b.WriteByte(s[i])
+			continue
+		}
+		b.WriteString("%%")
+		if i+1 < len(s) && strings.IndexByte("pPtv", s[i+1]) >= 0 {
+			b.WriteByte(0x01)
+		}
 	}
-	wm, err := pdfcpu.ParseTextWatermarkDetails("CONFIDENTIAL", "points:48, scale:1, op:0.2", true, types.POINTS)
-	if err != nil {
-		log.Printf("Error creating watermark: %s", err)
-		return err
+	return b.String()
+}
+
+// textWatermark returns the watermark of text, shown as given, with the
+// pdfcpu description desc
+func textWatermark(text, desc string, onTop bool) (*model.Watermark, error) {
+	return api.TextWatermark(escapePercent(text), desc, onTop, false, types.POINTS)
+}
+
+// DefaultWatermarkOptions returns the options of the traditional pdftool
+// watermark: translucent gray Helvetica, diagonally across each page
+func DefaultWatermarkOptions(text string) WatermarkOptions {
+	return WatermarkOptions{
+		Text:     text,
+		FontName: "Helvetica",
+		FontSize: 48,
+		Scale:    1,
+		Opacity:  0.2,
+		Diagonal: true,
+		Color:    "#808080",
+		OnTop:    true,
 	}
-	err = api.AddWatermarks(rs, w, pages, wm, nil)
-	if err != nil {
-		log.Fatalf("error: %s", err)
+}
+
+// Description returns the pdfcpu watermark description for the options.
+func (o WatermarkOptions) Description() string {
+	scale := "1 abs"
+	if o.Scale > 0 {
+		scale = fmt.Sprintf("%g rel", o.Scale)
 	}
-	return nil
+	desc := fmt.Sprintf(
+		"font:%s, points:%d, scale:%s, op:%g, fillc:%s",
+		o.FontName,
+		o.FontSize,
+		scale,
+		o.Opacity,
+		o.Color,
+	)
+	if o.Diagonal {
+		desc += ", d:1"
+	} else {
+		desc += fmt.Sprintf(", rot:%g", o.Rotation)
+	}
+	return desc
 }
 
-// DraftStampRS adds a DRAFT watermark to each page of rs and writes to w
-func DraftStampRS(rs io.ReadSeeker, w io.Writer) error {
-	pages, err := api.ParsePageSelection("") // select all pages
+// TextStampRS adds the text watermark described by opts to the selected
+// pages of rs and writes to w
+func TextStampRS(rs io.ReadSeeker, w io.Writer, opts WatermarkOptions) (err error) {
+	const op = "text stamp"
+	defer recoverCorrupt(op, &err)
+
+	pages, err := api.ParsePageSelection(opts.Pages)
 	if err != nil {
-		log.Fatalf("error: %s", err)
+		return optionErr(op, err)
 	}
-	wm, err := pdfcpu.ParseTextWatermarkDetails("DRAFT", "points:48, scale:1, op:0.2", true, types.POINTS)
+	wm, err := textWatermark(opts.Text, opts.Description(), opts.OnTop)
 	if err != nil {
-		log.Printf("Error creating watermark: %s", err)
-		return err
+		return optionErr(op, err)
 	}
-	err = api.AddWatermarks(rs, w, pages, wm, nil)
+
+	count, err := pageCount(op, rs)
 	if err != nil {
-		log.Fatalf("error: %s", err)
+		return err
+	}
+	if len(pages) > 0 {
+		selected, err := api.PagesForPageSelection(count, pages, true)
+		if err != nil {
+			return optionErr(op, err)
+		}
+		if len(selected) == 0 {
+			return &Error{Op: op, Kind: ErrPageOutOfRange, Err: fmt.Errorf("no page %s in %d pages", opts.Pages, count)}
+		}
+	}
+
+	if opts.Scrub {
+		selected, err := api.PagesForPageSelection(count, pages, true)
+		if err != nil {
+			return optionErr(op, err)
+		}
+		m := map[int][]*model.Watermark{}
+		for page, ok := range selected {
+			if ok {
+				m[page] = []*model.Watermark{wm}
+			}
+		}
+		return watermarkRS(op, rs, w, m, true)
+	}
+	if err := api.AddWatermarks(rs, w, pages, wm, nil); err != nil {
+		return readErr(op, err)
 	}
 	return nil
 }
 
+// ConfidentialStampRS adds a CONFIDENTIAL watermark to each page of rs and writes to w
+func ConfidentialStampRS(rs io.ReadSeeker, w io.Writer) error {
+	return TextStampRS(rs, w, DefaultWatermarkOptions("CONFIDENTIAL"))
+}
+
+// DraftStampRS adds a DRAFT watermark to each page of rs and writes to w
+func DraftStampRS(rs io.ReadSeeker, w io.Writer) error {
+	return TextStampRS(rs, w, DefaultWatermarkOptions("DRAFT"))
+}
+
 // CopyStampRS adds a COPY watermark to each page of rs and writes to w
 func CopyStampRS(rs io.ReadSeeker, w io.Writer) error {
-	pages, err := api.ParsePageSelection("") // select all pages
-	if err != nil {
-		log.Fatalf("error: %s", err)
+	return TextStampRS(rs, w, DefaultWatermarkOptions("COPY"))
+}
+
+// BatesStyle describes the appearance of a Bates endorsement
+type BatesStyle struct {
+	FontName    string  `json:"font"`        // font used for the endorsement (see `pdfcpu fonts list`)
+	FontSize    int     `json:"fontsize"`    // font size in points
+	Position    string  `json:"position"`    // page anchor: tl, tc, tr, l, c, r, bl, bc or br
+	MarginX     float64 `json:"marginx"`     // horizontal distance from the page edge in points
+	MarginY     float64 `json:"marginy"`     // vertical distance from the page edge in points
+	Padding     int     `json:"padding"`     // space between the text and the border in points
+	FillColor   string  `json:"color"`       // text color, e.g. #000000 or black
+	BgColor     string  `json:"bgcolor"`     // background color; empty for a transparent background
+	Opacity     float64 `json:"opacity"`     // 0.0 (invisible) to 1.0 (opaque)
+	BorderWidth int     `json:"border"`      // border width in points; 0 for no border
+	BorderColor string  `json:"bordercolor"` // border color
+
+	// DesignationPosition is the page anchor of the designation legend
+	// (see BatesEndorseRS); empty for the corner opposite the Bates number
+	DesignationPosition string `json:"designationposition"`
+}
+
+// DefaultBatesStyle returns the traditional pdftool Bates endorsement:
+// 12pt Helvetica in the bottom right corner, black on white with a
+// 1pt black border.
+func DefaultBatesStyle() BatesStyle {
+	return BatesStyle{
+		FontName:    "Helvetica",
+		FontSize:    12,
+		Position:    "br",
+		MarginX:     20,
+		MarginY:     5,
+		Padding:     2,
+		FillColor:   "#000000",
+		BgColor:     "#ffffff",
+		Opacity:     1,
+		BorderWidth: 1,
+		BorderColor: "#000000",
 	}
-	wm, err := pdfcpu.ParseTextWatermarkDetails("COPY", "points:48, scale:1, op:0.2", true, types.POINTS)
-	if err != nil {
-		log.Printf("Error creating watermark: %s", err)
-		return err
+}
+
+// offset returns the pdfcpu offset for the style's position, pointing
+// away from the page edges the endorsement is anchored to.
+func (s BatesStyle) offset() (float64, float64) {
+	var dx, dy float64
+	switch s.Position {
+	case "tl", "l", "bl":
+		dx = s.MarginX
+	case "tr", "r", "br":
+		dx = -s.MarginX
 	}
-	err = api.AddWatermarks(rs, w, pages, wm, nil)
-	if err != nil {
-		log.Fatalf("error: %s", err)
+	switch s.Position {
+	case "bl", "bc", "br":
+		dy = s.MarginY
+	case "tl", "tc", "tr":
+		dy = -s.MarginY
 	}
-	return nil
+	return dx, dy
 }
 
-// BatesStampRS adds a bates stamp to each page of rs and writes to w
-func BatesStampRS(rs io.ReadSeeker, w io.Writer, fmtString string, startno int64) error {
-	_, err := rs.Seek(0, io.SeekStart)
-	if err != nil {
-		log.Printf("Error seeking to beginning of file\n%s", err)
-		return err
+// Description returns the pdfcpu watermark description for the style.
+func (s BatesStyle) Description() string {
+	dx, dy := s.offset()
+	desc := fmt.Sprintf(
+		"font:%s, points:%d, scale:1 abs, pos:%s, rot:0, ma:%d, fillc:%s, offset:%g %g, op:%g",
+		s.FontName,
+		s.FontSize,
+		s.Position,
+		s.Padding,
+		s.FillColor,
+		dx,
+		dy,
+		s.Opacity,
+	)
+	if s.BgColor != "" {
+		desc += ", bgcolor:" + s.BgColor
 	}
+	if s.BorderWidth > 0 {
+		desc += fmt.Sprintf(", border:%d %s", s.BorderWidth, s.BorderColor)
+	}
+	return desc
+}
 
-	pageCount, err := api.PageCount(rs, nil)
-	if err != nil {
-		return err
+// designationStyle returns the style of the designation legend
+// accompanying a Bates number in style s
+func (s BatesStyle) designationStyle() BatesStyle {
+	d := s
+	d.Position = s.DesignationPosition
+	if d.Position == "" {
+		d.Position = oppositePosition(s.Position)
 	}
-	m := map[int]*model.Watermark{}
+	return d
+}
 
+// oppositePosition returns the anchor across the page from pos
+// horizontally; a centered anchor is paired with the left side
+func oppositePosition(pos string) string {
+	if len(pos) == 1 {
+		pos = "m" + pos
+	}
+	row, col := pos[:1], pos[1:]
+	switch col {
+	case "l":
+		col = "r"
+	default:
+		col = "l"
+	}
+	if row == "m" {
+		return col
+	}
+	return row + col
+}
+
+// batesWatermarks returns the watermarks for each of pageCount pages,
+// numbered from startno according to fmtString and, unless designation
+// is empty, carrying designation as a legend
+func batesWatermarks(pageCount int, fmtString string, startno int64, designation string, style BatesStyle) (map[int][]*model.Watermark, error) {
+	desc := style.Description()
+	var legend *model.Watermark
+	if designation != "" {
+		var err error
+		legend, err = textWatermark(designation, style.designationStyle().Description(), true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	m := map[int][]*model.Watermark{}
 	for i := 0; i < pageCount; i++ {
 		text := fmt.Sprintf(fmtString, startno+int64(i))
-		fontName := "Helvetica"
-		points := 12
-		pos := "br"
-		rot := 0
-		ma := "2"
-		fillc := "#000000"
-		offset := "-20 5"
-		scale := "1 abs"
-		bgcolor := "#ffffff"
-		opacity := "1"
-		border := "1 #000000"
-		desc := fmt.Sprintf(
-			"font:%s, points:%d, scale:%s, pos:%s, rot:%d, ma:%s, fillc:%s, offset:%s, bgcolor:%s, op:%s, border:%s",
-			fontName,
-			points,
-			scale,
-			pos,
-			rot,
-			ma,
-			fillc,
-			offset,
-			bgcolor,
-			opacity,
-			border,
-		)
-
-		wm, err := api.TextWatermark(text, desc, true, false, types.POINTS)
+		wm, err := textWatermark(text, desc, true)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		m[i+1] = []*model.Watermark{wm} // PDF page numbering starts at 1
+		if legend != nil {
+			m[i+1] = append(m[i+1], legend)
 		}
-		m[i+1] = wm // PDF page numbering starts at 1
 	}
+	return m, nil
+}
+
+// BatesEndorseRS adds a bates stamp in the given style to each page of rs
+// and writes to w. Unless designation is empty (e.g., "CONFIDENTIAL"),
+// each page also carries designation as a legend, by default in the
+// corner opposite the Bates number.
+func BatesEndorseRS(rs io.ReadSeeker, w io.Writer, fmtString string, startno int64, designation string, style BatesStyle) error {
+	return batesEndorseRS(rs, w, fmtString, startno, designation, style, false)
+}
+
+// ScrubBatesEndorseRS is BatesEndorseRS, also removing the metadata of rs
+// in the same write (see ScrubRS)
+func ScrubBatesEndorseRS(rs io.ReadSeeker, w io.Writer, fmtString string, startno int64, designation string, style BatesStyle) error {
+	return batesEndorseRS(rs, w, fmtString, startno, designation, style, true)
+}
+
+func batesEndorseRS(rs io.ReadSeeker, w io.Writer, fmtString string, startno int64, designation string, style BatesStyle, scrub bool) (err error) {
+	const op = "bates stamp"
+	defer recoverCorrupt(op, &err)
 
-	_, err = rs.Seek(0, io.SeekStart)
+	count, err := pageCount(op, rs)
 	if err != nil {
-		log.Printf("Error seeking to beginning of file\n%s", err)
 		return err
 	}
 
-	if err := api.AddWatermarksMap(rs, w, m, nil); err != nil {
-		return err
+	m, err := batesWatermarks(count, fmtString, startno, designation, style)
+	if err != nil {
+		return optionErr(op, err)
 	}
-	return nil
+
+	return watermarkRS(op, rs, w, m, scrub)
 }
 
-// BatesStamp adds a bates stamp to each page of inFile and writes to outFile
-func BatesStamp(inFile string, outFile string, fmtString string, startno int64) error {
+// BatesStampRS adds a bates stamp in the given style to each page of rs and writes to w
+func BatesStampRS(rs io.ReadSeeker, w io.Writer, fmtString string, startno int64, style BatesStyle) error {
+	return BatesEndorseRS(rs, w, fmtString, startno, "", style)
+}
 
-	pageCount, err := api.PageCountFile(inFile)
+// BatesEndorse adds a bates stamp and designation legend (see
+// BatesEndorseRS) to each page of inFile and writes to outFile
+func BatesEndorse(inFile string, outFile string, fmtString string, startno int64, designation string, style BatesStyle) error {
+	fIn, err := os.Open(inFile)
 	if err != nil {
 		return err
 	}
+	defer fIn.Close()
 
-	m := map[int]*model.Watermark{}
-
-	for i := 0; i < pageCount; i++ {
-		text := fmt.Sprintf(fmtString, startno+int64(i))
-		fontName := "Helvetica"
-		points := 12
-		pos := "br"
-		rot := 0
-		ma := "2"
-		fillc := "#000000"
-		offset := "-5 5"
-		scale := "1 abs"
-		bgcolor := "#ffffff"
-		opacity := "1"
-		border := "1 #000000"
-		desc := fmt.Sprintf(
-			"font:%s, points:%d, scale:%s, pos:%s, rot:%d, ma:%s, fillc:%s, offset:%s, bgcolor:%s, op:%s, border:%s",
-			fontName,
-			points,
-			scale,
-			pos,
-			rot,
-			ma,
-			fillc,
-			offset,
-			bgcolor,
-			opacity,
-			border,
-		)
-
-		wm, err := api.TextWatermark(text, desc, true, false, types.POINTS)
-		if err != nil {
-			return err
-		}
-		m[i+1] = wm // PDF page numbering starts at 1
-	}
-
-	if err := api.AddWatermarksMapFile(inFile, outFile, m, nil); err != nil {
+	fOut, err := os.Create(outFile)
+	if err != nil {
 		return err
 	}
-	return nil
+	defer fOut.Close()
+
+	return BatesEndorseRS(fIn, fOut, fmtString, startno, designation, style)
+}
+
+// BatesStamp adds a bates stamp in the given style to each page of inFile and writes to outFile
+func BatesStamp(inFile string, outFile string, fmtString string, startno int64, style BatesStyle) error {
+	return BatesEndorse(inFile, outFile, fmtString, startno, "", style)
 }
 
 func GenerateFmtString(prefix string, separator string, padding int) string {
@@ -1,6 +1,8 @@
 package utils
 
 import (
+	"bytes"
+	"strings"
 	"testing"
 )
 
@@ -35,3 +37,130 @@ func TestGenerateFmtString(t *testing.T) {
 		})
 	}
 }
+
+func TestBatesStyleDescription(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*BatesStyle)
+		want   string
+	}{
+		{
+			"default",
+			func(s *BatesStyle) {},
+			"font:Helvetica, points:12, scale:1 abs, pos:br, rot:0, ma:2, fillc:#000000, offset:-20 5, op:1, bgcolor:#ffffff, border:1 #000000",
+		},
+		{
+			"top left without border",
+			func(s *BatesStyle) { s.Position = "tl"; s.BorderWidth = 0 },
+			"font:Helvetica, points:12, scale:1 abs, pos:tl, rot:0, ma:2, fillc:#000000, offset:20 -5, op:1, bgcolor:#ffffff",
+		},
+		{
+			"bottom center transparent",
+			func(s *BatesStyle) { s.Position = "bc"; s.BgColor = ""; s.FontName = "Courier" },
+			"font:Courier, points:12, scale:1 abs, pos:bc, rot:0, ma:2, fillc:#000000, offset:0 5, op:1, border:1 #000000",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			style := DefaultBatesStyle()
+			tt.modify(&style)
+			if got := style.Description(); got != tt.want {
+				t.Errorf("Description() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOppositePosition(t *testing.T) {
+	tests := []struct {
+		pos  string
+		want string
+	}{
+		{"br", "bl"},
+		{"bl", "br"},
+		{"bc", "bl"},
+		{"tr", "tl"},
+		{"r", "l"},
+		{"c", "l"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pos, func(t *testing.T) {
+			if got := oppositePosition(tt.pos); got != tt.want {
+				t.Errorf("oppositePosition() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWatermarkOptionsDescription(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*WatermarkOptions)
+		want   string
+	}{
+		{
+			"default",
+			func(o *WatermarkOptions) {},
+			"font:Helvetica, points:48, scale:1 rel, op:0.2, fillc:#808080, d:1",
+		},
+		{
+			"absolute and rotated",
+			func(o *WatermarkOptions) { o.Scale = 0; o.FontSize = 30; o.Diagonal = false; o.Rotation = 90 },
+			"font:Helvetica, points:30, scale:1 abs, op:0.2, fillc:#808080, rot:90",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := DefaultWatermarkOptions("DRAFT")
+			tt.modify(&opts)
+			if got := opts.Description(); got != tt.want {
+				t.Errorf("Description() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestEscapePercent(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"Page 1", "Page 1"},
+		{"100%", "100%%"},
+		{"50% off", "50%% off"},
+		{"%p of %P", "%%\x01p of %%\x01P"},
+		{"%%t", "%%%%\x01t"},
+	}
+	for _, tt := range tests {
+		if got := escapePercent(tt.in); got != tt.want {
+			t.Errorf("escapePercent(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestStampPercent(t *testing.T) {
+	stamp := func(rs *bytes.Reader, w *bytes.Buffer) error {
+		return TextStampRS(rs, w, DefaultWatermarkOptions("50% DRAFT"))
+	}
+	endorse := func(rs *bytes.Reader, w *bytes.Buffer) error {
+		return BatesEndorseRS(rs, w, "ABC%04d", 1, "100% CONFIDENTIAL", DefaultBatesStyle())
+	}
+	tests := []struct {
+		name string
+		run  func(*bytes.Reader, *bytes.Buffer) error
+		want string
+	}{
+		{"stamp", stamp, "50% DRAFT"},
+		{"designation", endorse, "100% CONFIDENTIAL"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var b bytes.Buffer
+			if err := tt.run(bytes.NewReader(testPDF(1)), &b); err != nil {
+				t.Fatal(err)
+			}
+			if text, _ := pageText(t, readTestPDF(t, b.Bytes())); !strings.Contains(text, tt.want) {
+				t.Errorf("page text = %q, want %q", text, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// CheckVolumeLabel verifies that label names a volume directory of its
+// own: it must not be empty, "." or "..", or contain a path separator
+func CheckVolumeLabel(label string) error {
+	if label == "" || label == "." || label == ".." || strings.ContainsAny(label, `/\`) {
+		return fmt.Errorf("%w: volume label `%s` must name a directory, without path separators", ErrInvalidOption, label)
+	}
+	return nil
+}
+
+// ManifestEntry is the SHA-256 hash of one file of a production volume
+type ManifestEntry struct {
+	Path   string // slash separated path relative to the volume
+	SHA256 string
+}
+
+// Manifest returns the SHA-256 hash of each file under root, sorted by path
+func Manifest(root string) ([]ManifestEntry, error) {
+	entries := []ManifestEntry{}
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		hash, err := HashFile(p, sha256.New())
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ManifestEntry{filepath.ToSlash(rel), hash})
+		return nil
+	})
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Path < entries[j].Path })
+	return entries, err
+}
+
+// WriteManifest writes entries to w in the format of sha256sum, so that
+// the volume can be verified with `sha256sum -c`
+func WriteManifest(w io.Writer, entries []ManifestEntry) error {
+	for _, e := range entries {
+		if _, err := fmt.Fprintf(w, "%s  %s\n", e.SHA256, e.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ZipDirectory writes the directory root, including root itself, to w
+// as a ZIP archive with the given comment (e.g., the volume label)
+func ZipDirectory(w io.Writer, root string, comment string) error {
+	zw := zip.NewWriter(w)
+	if err := zw.SetComment(comment); err != nil {
+		return err
+	}
+	base := filepath.Base(root)
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		name := path.Join(base, filepath.ToSlash(rel))
+		if d.IsDir() {
+			_, err := zw.Create(name + "/")
+			return err
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		fh, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		fh.Name = name
+		fh.Method = zip.Deflate
+		fw, err := zw.CreateHeader(fh)
+		if err != nil {
+			return err
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		_, err = io.Copy(fw, f)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
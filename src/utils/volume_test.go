@@ -0,0 +1,71 @@
+package utils
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestManifestAndZip(t *testing.T) {
+	root := filepath.Join(t.TempDir(), "VOL001")
+	files := map[string]string{
+		"DATA/VOL001.dat":      "data",
+		"IMAGES/ABC_0001.pdf":  "abc",
+		"NATIVES/ABC_0002.xls": "",
+	}
+	for name, content := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	entries, err := Manifest(root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := WriteManifest(&b, entries); err != nil {
+		t.Fatal(err)
+	}
+	want := "3a6eb0790f39ac87c94f3856b2dd2c5d110e6811602261a9a923d3bb23adc8b7  DATA/VOL001.dat\n" +
+		"ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad  IMAGES/ABC_0001.pdf\n" +
+		"e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855  NATIVES/ABC_0002.xls\n"
+	if got := b.String(); got != want {
+		t.Errorf("WriteManifest() = %q, want %q", got, want)
+	}
+
+	b.Reset()
+	if err := ZipDirectory(&b, root, "VOL001"); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(b.Bytes()), int64(b.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if zr.Comment != "VOL001" {
+		t.Errorf("comment = %q, want %q", zr.Comment, "VOL001")
+	}
+	found := map[string]bool{}
+	for _, f := range zr.File {
+		found[f.Name] = true
+	}
+	for name := range files {
+		if !found["VOL001/"+name] {
+			t.Errorf("ZipDirectory() is missing VOL001/%s", name)
+		}
+	}
+}
+
+func TestCheckVolumeLabel(t *testing.T) {
+	for label, ok := range map[string]bool{"VOL001": true, "ABC 001": true, "": false, ".": false, "..": false, "../x": false, `a\b`: false, "a/b": false} {
+		if err := CheckVolumeLabel(label); (err == nil) != ok {
+			t.Errorf("CheckVolumeLabel(%q) = %v, want ok %v", label, err, ok)
+		}
+	}
+}